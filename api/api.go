@@ -0,0 +1,138 @@
+package api
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/common/protos"
+	"github.com/Cretezy/dSock/common/store"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"net/http"
+)
+
+/// Delivers a message to a worker running in the same process
+type LocalDelivery func(messageType string, message proto.Message)
+
+/// Called after API actions succeed. Hooks are called synchronously (in the request) and should not block
+type Hooks struct {
+	/// Called after a message is sent to the target's workers
+	OnSend func(target common.ResolveOptions, messageType protos.Message_MessageType, body []byte)
+	/// Called after a claim is created (including by the broker)
+	OnClaim func(claim *store.Claim)
+	/// Called after the target is disconnected
+	OnDisconnect func(target common.ResolveOptions, keepClaims bool)
+}
+
+type ServerOptions struct {
+	/// Options, usually from common.GetOptions
+	Options *common.DSockOptions
+	/// Defaults to a no-op logger
+	Logger *zap.Logger
+	/// Store shared with the workers. If nil, a store is created from the options (and closed on shutdown)
+	Store store.Store
+	Hooks Hooks
+}
+
+/// dSock API. Multiple servers can run in the same process (metrics are shared by all servers)
+type Server struct {
+	id        string
+	options   *common.DSockOptions
+	logger    *zap.Logger
+	dataStore store.Store
+	/// If the store was created by the server (closed on shutdown)
+	ownsStore bool
+	hooks     Hooks
+	tokens    *tokensState
+	/// HTTP client for direct messages to workers
+	directClient *http.Client
+
+	localWorkerId string
+	localDelivery LocalDelivery
+}
+
+func NewServer(serverOptions ServerOptions) *Server {
+	server := &Server{
+		id:        uuid.New().String(),
+		options:   serverOptions.Options,
+		logger:    serverOptions.Logger,
+		dataStore: serverOptions.Store,
+		hooks:     serverOptions.Hooks,
+		tokens:    newTokensState(serverOptions.Options),
+
+		directClient: common.NewDirectHttpClient(serverOptions.Options),
+	}
+
+	if server.logger == nil {
+		server.logger = zap.NewNop()
+	}
+
+	if server.dataStore == nil {
+		server.dataStore = store.New(server.options, server.logger)
+		server.ownsStore = true
+	}
+
+	return server
+}
+
+func (server *Server) Id() string {
+	return server.id
+}
+
+/// Delivers messages for a worker running in the same process directly, skipping the messaging method
+func (server *Server) SetLocalWorker(workerId string, delivery LocalDelivery) {
+	server.localWorkerId = workerId
+	server.localDelivery = delivery
+}
+
+/// Registers the API routes. Routes should be protected with the server's TokenMiddleware
+func (server *Server) RegisterRoutes(router gin.IRoutes) {
+	router.POST(common.PathSend, common.TracingMiddleware, server.scopeMiddleware(common.ScopeSend, resolveTokenTargets), server.rateLimitMiddleware("send", server.options.RateLimit.Send, resolveTarget), server.sendHandler)
+	router.POST(common.PathDisconnect, common.TracingMiddleware, server.scopeMiddleware(common.ScopeDisconnect, resolveTokenTargets), server.rateLimitMiddleware("disconnect", server.options.RateLimit.Disconnect, resolveTarget), server.disconnectHandler)
+	router.POST(common.PathClaim, common.TracingMiddleware, server.scopeMiddleware(common.ScopeClaim, claimTokenTargets), server.rateLimitMiddleware("claim", server.options.RateLimit.Claim, claimTarget), server.createClaimHandler)
+	router.POST(common.PathBroker, common.TracingMiddleware, server.scopeMiddleware(common.ScopeClaim, claimTokenTargets), server.rateLimitMiddleware("claim", server.options.RateLimit.Claim, claimTarget), server.brokerHandler)
+	router.POST(common.PathClaimRevoke, common.TracingMiddleware, server.scopeMiddleware(common.ScopeClaim, resolveTokenTargets), server.revokeClaimHandler)
+	router.GET(common.PathInfo, common.TracingMiddleware, server.scopeMiddleware(common.ScopeInfo, resolveTokenTargets), server.infoHandler)
+	router.GET(common.PathWorkers, common.TracingMiddleware, server.scopeMiddleware(common.ScopeInfo, nil), server.workersHandler)
+	// Not traced, as the stream lasts as long as the client is connected
+	router.GET(common.PathEvents, server.scopeMiddleware(common.ScopeInfo, resolveTokenTargets), server.eventsHandler)
+	router.POST(common.PathChannelSubscribe, common.TracingMiddleware, server.scopeMiddleware(common.ScopeChannel, resolveTokenTargets), server.getChannelHandler(protos.ChannelAction_SUBSCRIBE))
+	router.POST(common.PathChannelUnsubscribe, common.TracingMiddleware, server.scopeMiddleware(common.ScopeChannel, resolveTokenTargets), server.getChannelHandler(protos.ChannelAction_UNSUBSCRIBE))
+
+	if server.options.StoreTokens {
+		router.GET(common.PathTokens, server.mainTokenMiddleware, server.tokensHandler)
+		router.POST(common.PathTokens, server.mainTokenMiddleware, server.createTokenHandler)
+		router.POST(common.PathTokenRevoke, server.mainTokenMiddleware, server.revokeTokenHandler)
+	}
+}
+
+/// Returns the handler serving the API (including ping & metrics), protected by the tokens
+func (server *Server) Handler() http.Handler {
+	router := common.NewGinEngine(server.logger, server.options)
+	router.Use(common.RequestIdMiddleware)
+	router.Use(server.TokenMiddleware())
+
+	router.Any(common.PathPing, common.PingHandler)
+	common.RegisterMetricsRoute(router, server.options)
+	server.RegisterRoutes(router)
+
+	return router
+}
+
+/// Checks the connection to the store. The API has no background work, so this is only informative
+func (server *Server) Start() {
+	err := server.dataStore.Ping()
+	if err != nil {
+		server.logger.Error("Could not connect to store (ping)",
+			zap.Error(err),
+			zap.String("store", server.options.Store),
+		)
+	}
+}
+
+/// Closes the store if it was created by the server
+func (server *Server) Shutdown() {
+	if server.ownsStore {
+		_ = server.dataStore.Close()
+	}
+}
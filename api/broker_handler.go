@@ -0,0 +1,132 @@
+package api
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/common/store"
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/url"
+)
+
+type brokerOptions struct {
+	claimOptions
+	/// Preferred region of the worker
+	Region string `form:"region"`
+}
+
+/// Picks the least loaded worker able to accept connections, preferring workers in the region (if set).
+/// Returns nil if no worker is available
+func selectWorker(workers []*store.Worker, region string) *store.Worker {
+	candidates := make([]*store.Worker, 0, len(workers))
+	for _, worker := range workers {
+		if worker.PublicUrl == "" || worker.Status != common.WorkerStatusHealthy || worker.Load.AtCapacity {
+			continue
+		}
+
+		candidates = append(candidates, worker)
+	}
+
+	if region != "" {
+		regionCandidates := make([]*store.Worker, 0, len(candidates))
+		for _, worker := range candidates {
+			if worker.Region == region {
+				regionCandidates = append(regionCandidates, worker)
+			}
+		}
+
+		// Fallback to other regions when no worker is available in the region
+		if len(regionCandidates) != 0 {
+			candidates = regionCandidates
+		}
+	}
+
+	var selected *store.Worker
+	for _, worker := range candidates {
+		if selected == nil ||
+			worker.Load.Connections < selected.Load.Connections ||
+			(worker.Load.Connections == selected.Load.Connections && worker.Load.Cpu < selected.Load.Cpu) {
+			selected = worker
+		}
+	}
+
+	return selected
+}
+
+func (server *Server) brokerHandler(c *gin.Context) {
+	server.logger.Info("Getting broker request",
+		zap.String("requestId", requestid.Get(c)),
+		zap.String("id", c.Query("id")),
+		zap.String("user", c.Query("user")),
+		zap.String("session", c.Query("session")),
+		zap.String("channels", c.Query("channels")),
+		zap.String("region", c.Query("region")),
+	)
+
+	brokerOptions := brokerOptions{}
+
+	err := c.BindQuery(&brokerOptions)
+	if err != nil {
+		apiError := &common.ApiError{
+			InternalError: err,
+			ErrorCode:     common.ErrorBindingQueryParams,
+			StatusCode:    400,
+			RequestId:     requestid.Get(c),
+		}
+		apiError.Send(c)
+		return
+	}
+
+	workers, err := server.dataStore.ListWorkers()
+	if err != nil {
+		apiError := &common.ApiError{
+			InternalError: err,
+			ErrorCode:     common.ErrorGettingWorker,
+			StatusCode:    500,
+			RequestId:     requestid.Get(c),
+		}
+		apiError.Send(c)
+		return
+	}
+
+	worker := selectWorker(workers, brokerOptions.Region)
+	if worker == nil {
+		apiError := &common.ApiError{
+			ErrorCode:  common.ErrorNoWorkerAvailable,
+			StatusCode: 503,
+			RequestId:  requestid.Get(c),
+		}
+		apiError.Send(c)
+		return
+	}
+
+	// Only create the claim once a worker is found
+	claim, apiError := server.createClaim(brokerOptions.claimOptions, requestid.Get(c))
+	if apiError != nil {
+		apiError.Send(c)
+		return
+	}
+
+	server.logger.Info("Assigned worker",
+		zap.String("requestId", requestid.Get(c)),
+		zap.String("workerId", worker.Id),
+		zap.String("region", worker.Region),
+		zap.Int("connections", worker.Load.Connections),
+	)
+
+	workerResponse := gin.H{
+		"id":  worker.Id,
+		"url": worker.PublicUrl,
+	}
+
+	if worker.Region != "" {
+		workerResponse["region"] = worker.Region
+	}
+
+	c.AbortWithStatusJSON(200, map[string]interface{}{
+		"success": true,
+		"url":     worker.PublicUrl + common.PathConnect + "?claim=" + url.QueryEscape(claim["id"].(string)),
+		"worker":  workerResponse,
+		"claim":   claim,
+	})
+}
@@ -1,13 +1,11 @@
-package main
+package api
 
 import (
 	"github.com/Cretezy/dSock/common"
 	"github.com/Cretezy/dSock/common/protos"
 	"github.com/gin-contrib/requestid"
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v7"
 	"go.uber.org/zap"
-	"strings"
 )
 
 var actionTypeName = map[protos.ChannelAction_ChannelActionType]string{
@@ -15,11 +13,11 @@ var actionTypeName = map[protos.ChannelAction_ChannelActionType]string{
 	protos.ChannelAction_UNSUBSCRIBE: "unsubscribe",
 }
 
-func getChannelHandler(actionType protos.ChannelAction_ChannelActionType) gin.HandlerFunc {
+func (server *Server) getChannelHandler(actionType protos.ChannelAction_ChannelActionType) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		requestId := requestid.Get(c)
 
-		logger.Info("Getting channel request",
+		server.logger.Info("Getting channel request",
 			zap.String("requestId", requestId),
 			zap.String("action", actionTypeName[actionType]),
 			zap.String("id", c.Query("id")),
@@ -48,7 +46,7 @@ func getChannelHandler(actionType protos.ChannelAction_ChannelActionType) gin.Ha
 		ignoreClaims := c.Query("ignoreClaims") == "true"
 
 		// Get all worker IDs that the target(s) is connected to
-		workerIds, apiError := resolveWorkers(resolveOptions, requestId)
+		workerIds, apiError := server.resolveWorkers(c.Request.Context(), resolveOptions, requestId)
 		if apiError != nil {
 			apiError.Send(c)
 			return
@@ -56,64 +54,19 @@ func getChannelHandler(actionType protos.ChannelAction_ChannelActionType) gin.Ha
 
 		if !ignoreClaims {
 			// Add channel to all claims for the target
-			claimIds, apiError := resolveClaims(resolveOptions, requestId)
+			claimIds, apiError := server.resolveClaims(resolveOptions, requestId)
 
 			if apiError != nil {
 				apiError.Send(c)
 				return
 			}
 
-			var claimCmds = make([]*redis.StringStringMapCmd, len(claimIds))
-			_, err := redisClient.Pipelined(func(pipeliner redis.Pipeliner) error {
-				for index, claimId := range claimIds {
-					// HGetAll instead of HGet to be able to check if claim exist
-					claimCmds[index] = pipeliner.HGetAll("claim:" + claimId)
-				}
-
-				return nil
-			})
-
-			if err != nil {
-				apiError = &common.ApiError{
-					InternalError: err,
-					ErrorCode:     common.ErrorGettingClaim,
-					StatusCode:    500,
-					RequestId:     requestId,
-				}
-				apiError.Send(c)
-
-				return
+			if actionType == protos.ChannelAction_SUBSCRIBE {
+				err = server.dataStore.AddClaimsChannel(claimIds, channelChange)
+			} else {
+				err = server.dataStore.RemoveClaimsChannel(claimIds, channelChange)
 			}
 
-			_, err = redisClient.Pipelined(func(pipeliner redis.Pipeliner) error {
-				// Update all resolved claims
-				for index, claimId := range claimIds {
-					claimKey := "claim:" + claimId
-					claim := claimCmds[index]
-
-					if len(claim.Val()) == 0 {
-						// Claim doesn't exist
-						continue
-					}
-
-					channels := common.RemoveEmpty(strings.Split(claim.Val()["channels"], ","))
-
-					if actionType == protos.ChannelAction_SUBSCRIBE && !common.IncludesString(channels, channelChange) {
-						channels = append(channels, channelChange)
-						pipeliner.SAdd("claim-channel:"+channelChange, claimId)
-					} else if actionType != protos.ChannelAction_SUBSCRIBE && common.IncludesString(channels, channelChange) {
-						channels = common.RemoveString(channels, channelChange)
-						pipeliner.SRem("claim-channel:"+channelChange, claimId)
-					} else {
-						continue
-					}
-
-					pipeliner.HSet(claimKey, "channels", strings.Join(channels, ","))
-				}
-
-				return nil
-			})
-
 			if err != nil {
 				apiError = &common.ApiError{
 					InternalError: err,
@@ -140,13 +93,13 @@ func getChannelHandler(actionType protos.ChannelAction_ChannelActionType) gin.Ha
 		}
 
 		// Send to all workers
-		apiError = sendToWorkers(workerIds, message, ChannelMessageType, requestId)
+		apiError = server.sendToWorkers(c.Request.Context(), workerIds, message, common.ChannelMessageType, requestId)
 		if apiError != nil {
 			apiError.Send(c)
 			return
 		}
 
-		logger.Info("Set channel",
+		server.logger.Info("Set channel",
 			zap.String("requestId", requestId),
 			zap.String("action", actionTypeName[actionType]),
 			zap.String("id", resolveOptions.Connection),
@@ -1,7 +1,8 @@
-package main
+package api
 
 import (
 	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/common/store"
 	"github.com/gin-contrib/requestid"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -19,8 +20,8 @@ type claimOptions struct {
 	Duration   string `form:"duration"`
 }
 
-func createClaimHandler(c *gin.Context) {
-	logger.Info("Getting new claim request",
+func (server *Server) createClaimHandler(c *gin.Context) {
+	server.logger.Info("Getting new claim request",
 		zap.String("requestId", requestid.Get(c)),
 		zap.String("id", c.Query("id")),
 		zap.String("user", c.Query("user")),
@@ -44,6 +45,20 @@ func createClaimHandler(c *gin.Context) {
 		return
 	}
 
+	claim, apiError := server.createClaim(claimOptions, requestid.Get(c))
+	if apiError != nil {
+		apiError.Send(c)
+		return
+	}
+
+	c.AbortWithStatusJSON(200, map[string]interface{}{
+		"success": true,
+		"claim":   claim,
+	})
+}
+
+/// Creates a claim from the options, returning the claim's JSON representation
+func (server *Server) createClaim(claimOptions claimOptions, requestId string) (gin.H, *common.ApiError) {
 	channels := common.UniqueString(common.RemoveEmpty(
 		strings.Split(claimOptions.Channels, ","),
 	))
@@ -52,10 +67,9 @@ func createClaimHandler(c *gin.Context) {
 		apiError := common.ApiError{
 			ErrorCode:  common.ErrorUserIdRequired,
 			StatusCode: 400,
-			RequestId:  requestid.Get(c),
+			RequestId:  requestId,
 		}
-		apiError.Send(c)
-		return
+		return nil, &apiError
 	}
 
 	// Parses expiration time from expiration or duration
@@ -69,20 +83,18 @@ func createClaimHandler(c *gin.Context) {
 				InternalError: err,
 				ErrorCode:     common.ErrorInvalidExpiration,
 				StatusCode:    400,
-				RequestId:     requestid.Get(c),
+				RequestId:     requestId,
 			}
-			apiError.Send(c)
-			return
+			return nil, &apiError
 		}
 
 		if expiration < 1 {
 			apiError := common.ApiError{
 				ErrorCode:  common.ErrorNegativeExpiration,
 				StatusCode: 400,
-				RequestId:  requestid.Get(c),
+				RequestId:  requestId,
 			}
-			apiError.Send(c)
-			return
+			return nil, &apiError
 		}
 
 		expirationTime = time.Unix(int64(expiration), 0)
@@ -91,10 +103,9 @@ func createClaimHandler(c *gin.Context) {
 			apiError := common.ApiError{
 				ErrorCode:  common.ErrorInvalidExpiration,
 				StatusCode: 400,
-				RequestId:  requestid.Get(c),
+				RequestId:  requestId,
 			}
-			apiError.Send(c)
-			return
+			return nil, &apiError
 		}
 	} else if claimOptions.Duration != "" {
 		duration, err := strconv.Atoi(claimOptions.Duration)
@@ -104,20 +115,18 @@ func createClaimHandler(c *gin.Context) {
 				InternalError: err,
 				ErrorCode:     common.ErrorInvalidDuration,
 				StatusCode:    400,
-				RequestId:     requestid.Get(c),
+				RequestId:     requestId,
 			}
-			apiError.Send(c)
-			return
+			return nil, &apiError
 		}
 
 		if duration < 1 {
 			apiError := common.ApiError{
 				ErrorCode:  common.ErrorNegativeDuration,
 				StatusCode: 400,
-				RequestId:  requestid.Get(c),
+				RequestId:  requestId,
 			}
-			apiError.Send(c)
-			return
+			return nil, &apiError
 		}
 
 		expirationTime = time.Now().Add(time.Duration(duration) * time.Second)
@@ -129,27 +138,25 @@ func createClaimHandler(c *gin.Context) {
 	var id string
 
 	if claimOptions.Id != "" {
-		exists := redisClient.Exists("claim:" + claimOptions.Id)
+		exists, err := server.dataStore.ClaimExists(claimOptions.Id)
 
-		if exists.Err() != nil {
+		if err != nil {
 			apiError := common.ApiError{
-				InternalError: exists.Err(),
+				InternalError: err,
 				ErrorCode:     common.ErrorCheckingClaim,
 				StatusCode:    500,
-				RequestId:     requestid.Get(c),
+				RequestId:     requestId,
 			}
-			apiError.Send(c)
-			return
+			return nil, &apiError
 		}
 
-		if exists.Val() == 1 {
+		if exists {
 			apiError := common.ApiError{
 				ErrorCode:  common.ErrorClaimIdAlreadyUsed,
 				StatusCode: 400,
-				RequestId:  requestid.Get(c),
+				RequestId:  requestId,
 			}
-			apiError.Send(c)
-			return
+			return nil, &apiError
 		}
 
 		id = claimOptions.Id
@@ -157,39 +164,29 @@ func createClaimHandler(c *gin.Context) {
 		id = common.RandomString(32)
 	}
 
-	// Creates claim in Redis
-	claim := map[string]interface{}{
-		"user":       claimOptions.User,
-		"expiration": expirationTime.Format(time.RFC3339),
-	}
-
-	if claimOptions.Session != "" {
-		claim["session"] = claimOptions.Session
-	}
-
-	if len(channels) != 0 {
-		claim["channels"] = strings.Join(channels, ",")
+	claim := &store.Claim{
+		Id:         id,
+		User:       claimOptions.User,
+		Session:    claimOptions.Session,
+		Channels:   channels,
+		Expiration: expirationTime,
 	}
 
-	claimKey := "claim:" + id
-	redisClient.HSet(claimKey, claim)
-	redisClient.ExpireAt(claimKey, expirationTime)
+	// Creates claim in store (with user/session/channels claim)
+	err := server.dataStore.CreateClaim(claim)
 
-	// Create user/session claim
-	userKey := "claim-user:" + claimOptions.User
-	redisClient.SAdd(userKey, id, 0)
-
-	if claimOptions.Session != "" {
-		userSessionKey := "claim-user-session:" + claimOptions.User + "-" + claimOptions.Session
-		redisClient.SAdd(userSessionKey, id, 0)
-	}
-	for _, channel := range channels {
-		channelKey := "claim-channel:" + channel
-		redisClient.SAdd(channelKey, id, 0)
+	if err != nil {
+		apiError := common.ApiError{
+			InternalError: err,
+			ErrorCode:     common.ErrorCreatingClaim,
+			StatusCode:    500,
+			RequestId:     requestId,
+		}
+		return nil, &apiError
 	}
 
-	logger.Info("Created new claim",
-		zap.String("requestId", requestid.Get(c)),
+	server.logger.Info("Created new claim",
+		zap.String("requestId", requestId),
 		zap.String("id", id),
 		zap.String("user", claimOptions.User),
 		zap.Strings("channels", channels),
@@ -197,6 +194,10 @@ func createClaimHandler(c *gin.Context) {
 		zap.Time("expiration", expirationTime),
 	)
 
+	if server.hooks.OnClaim != nil {
+		server.hooks.OnClaim(claim)
+	}
+
 	claimResponse := gin.H{
 		"id":         id,
 		"expiration": expirationTime.Unix(),
@@ -212,8 +213,79 @@ func createClaimHandler(c *gin.Context) {
 		claimResponse["channels"] = channels
 	}
 
+	return claimResponse, nil
+}
+
+type revokeClaimOptions struct {
+	common.ResolveOptions
+	/// Claim ID to revoke
+	Claim string `form:"claim"`
+}
+
+/// Revokes (deletes) claims by ID or for a target (user & session, or channel), without affecting connections
+func (server *Server) revokeClaimHandler(c *gin.Context) {
+	server.logger.Info("Getting revoke claim request",
+		zap.String("requestId", requestid.Get(c)),
+		zap.String("claim", c.Query("claim")),
+		zap.String("user", c.Query("user")),
+		zap.String("session", c.Query("session")),
+		zap.String("channel", c.Query("channel")),
+	)
+
+	revokeOptions := revokeClaimOptions{}
+
+	err := c.BindQuery(&revokeOptions)
+	if err != nil {
+		apiError := &common.ApiError{
+			InternalError: err,
+			ErrorCode:     common.ErrorBindingQueryParams,
+			StatusCode:    400,
+			RequestId:     requestid.Get(c),
+		}
+		apiError.Send(c)
+		return
+	}
+
+	var claimIds []string
+
+	if revokeOptions.Claim != "" {
+		claimIds = []string{revokeOptions.Claim}
+	} else if revokeOptions.User != "" || revokeOptions.Channel != "" {
+		var apiError *common.ApiError
+		claimIds, apiError = server.resolveClaims(revokeOptions.ResolveOptions, requestid.Get(c))
+		if apiError != nil {
+			apiError.Send(c)
+			return
+		}
+	} else {
+		apiError := &common.ApiError{
+			StatusCode: 400,
+			ErrorCode:  common.ErrorTarget,
+			RequestId:  requestid.Get(c),
+		}
+		apiError.Send(c)
+		return
+	}
+
+	err = server.dataStore.DeleteClaims(claimIds)
+	if err != nil {
+		apiError := &common.ApiError{
+			InternalError: err,
+			ErrorCode:     common.ErrorDeletingClaim,
+			StatusCode:    500,
+			RequestId:     requestid.Get(c),
+		}
+		apiError.Send(c)
+		return
+	}
+
+	server.logger.Info("Revoked claims",
+		zap.String("requestId", requestid.Get(c)),
+		zap.Strings("claimIds", claimIds),
+	)
+
 	c.AbortWithStatusJSON(200, map[string]interface{}{
 		"success": true,
-		"claim":   claimResponse,
+		"claims":  len(claimIds),
 	})
 }
@@ -1,4 +1,4 @@
-package main
+package api
 
 import (
 	"github.com/Cretezy/dSock/common"
@@ -8,8 +8,8 @@ import (
 	"go.uber.org/zap"
 )
 
-func disconnectHandler(c *gin.Context) {
-	logger.Info("Getting disconnect request",
+func (server *Server) disconnectHandler(c *gin.Context) {
+	server.logger.Info("Getting disconnect request",
 		zap.String("requestId", requestid.Get(c)),
 		zap.String("id", c.Query("id")),
 		zap.String("user", c.Query("user")),
@@ -35,7 +35,7 @@ func disconnectHandler(c *gin.Context) {
 	keepClaims := c.Query("keepClaims") == "true"
 
 	// Get all worker IDs that the target is connected to
-	workerIds, apiError := resolveWorkers(resolveOptions, requestid.Get(c))
+	workerIds, apiError := server.resolveWorkers(c.Request.Context(), resolveOptions, requestid.Get(c))
 	if apiError != nil {
 		apiError.Send(c)
 		return
@@ -43,7 +43,7 @@ func disconnectHandler(c *gin.Context) {
 
 	if !keepClaims {
 		// Expire claims instantly, must resolve all claims for target
-		claimIds, apiError := resolveClaims(resolveOptions, requestid.Get(c))
+		claimIds, apiError := server.resolveClaims(resolveOptions, requestid.Get(c))
 
 		if apiError != nil {
 			apiError.Send(c)
@@ -51,20 +51,18 @@ func disconnectHandler(c *gin.Context) {
 		}
 
 		// Delete all resolved claims
-		claimKeys := make([]string, len(claimIds))
-		for index, claim := range claimIds {
-			claimKeys[index] = "claim:" + claim
-		}
+		err = server.dataStore.DeleteClaims(claimIds)
 
-		redisClient.SRem("claim-user:"+resolveOptions.User, claimIds)
-		if resolveOptions.Session != "" {
-			redisClient.SRem("claim-user-session:"+resolveOptions.User+"-"+resolveOptions.Session, claimIds)
-		}
-		if resolveOptions.Channel != "" {
-			redisClient.SRem("claim-channel:"+resolveOptions.Channel, claimIds)
+		if err != nil {
+			apiError := &common.ApiError{
+				InternalError: err,
+				ErrorCode:     common.ErrorDeletingClaim,
+				StatusCode:    500,
+				RequestId:     requestid.Get(c),
+			}
+			apiError.Send(c)
+			return
 		}
-
-		redisClient.Del(claimKeys...)
 	}
 
 	// Prepare message for worker
@@ -79,13 +77,13 @@ func disconnectHandler(c *gin.Context) {
 	}
 
 	// Send to all workers
-	apiError = sendToWorkers(workerIds, message, MessageMessageType, requestid.Get(c))
+	apiError = server.sendToWorkers(c.Request.Context(), workerIds, message, common.MessageMessageType, requestid.Get(c))
 	if apiError != nil {
 		apiError.Send(c)
 		return
 	}
 
-	logger.Info("Disconnected",
+	server.logger.Info("Disconnected",
 		zap.String("requestId", requestid.Get(c)),
 		zap.Strings("workerIds", workerIds),
 		zap.String("id", resolveOptions.Connection),
@@ -95,6 +93,10 @@ func disconnectHandler(c *gin.Context) {
 		zap.Bool("keepClaims", keepClaims),
 	)
 
+	if server.hooks.OnDisconnect != nil {
+		server.hooks.OnDisconnect(resolveOptions, keepClaims)
+	}
+
 	c.AbortWithStatusJSON(200, map[string]interface{}{
 		"success": true,
 	})
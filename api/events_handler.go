@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Cretezy/dSock/common"
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"io"
+	"time"
+)
+
+/// Events buffered per stream. Events are dropped when a client reads slower than they're published
+const eventsBufferSize = 256
+
+/// Interval of keep-alive comments sent on idle event streams
+const eventsKeepAliveInterval = time.Second * 15
+
+/// Streams connection events published by workers (with publish_events) as server-sent events, optionally filtered by target
+func (server *Server) eventsHandler(c *gin.Context) {
+	server.logger.Info("Getting events request",
+		zap.String("requestId", requestid.Get(c)),
+		zap.String("id", c.Query("id")),
+		zap.String("user", c.Query("user")),
+		zap.String("session", c.Query("session")),
+		zap.String("channel", c.Query("channel")),
+	)
+
+	resolveOptions := common.ResolveOptions{}
+
+	err := c.BindQuery(&resolveOptions)
+	if err != nil {
+		apiError := &common.ApiError{
+			InternalError: err,
+			ErrorCode:     common.ErrorBindingQueryParams,
+			StatusCode:    400,
+			RequestId:     requestid.Get(c),
+		}
+		apiError.Send(c)
+		return
+	}
+
+	events := make(chan *common.Event, eventsBufferSize)
+
+	subscription, err := server.dataStore.SubscribeEvents(func(payload []byte) {
+		var event common.Event
+
+		err := json.Unmarshal(payload, &event)
+		if err != nil {
+			server.logger.Error("Could not parse event",
+				zap.String("requestId", requestid.Get(c)),
+				zap.Error(err),
+			)
+			return
+		}
+
+		if !event.Matches(resolveOptions) {
+			return
+		}
+
+		select {
+		case events <- &event:
+		default:
+			server.logger.Warn("Events stream is full, dropping event",
+				zap.String("requestId", requestid.Get(c)),
+				zap.String("type", event.Type),
+				zap.String("id", event.Connection),
+			)
+		}
+	}, func(component string, err error) {
+		if err != nil {
+			server.logger.Warn("Events subscription degraded, events may be missed",
+				zap.String("requestId", requestid.Get(c)),
+				zap.String("component", component),
+				zap.Error(err),
+			)
+		}
+	})
+	if err != nil {
+		apiError := &common.ApiError{
+			InternalError: err,
+			ErrorCode:     common.ErrorSubscribingEvents,
+			StatusCode:    500,
+			RequestId:     requestid.Get(c),
+		}
+		apiError.Send(c)
+		return
+	}
+
+	defer subscription.Close()
+
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(200)
+	c.Writer.Flush()
+
+	c.Stream(func(writer io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event := <-events:
+			c.SSEvent(event.Type, event)
+		case <-keepAlive.C:
+			_, err := writer.Write([]byte(":\n\n"))
+			if err != nil {
+				return false
+			}
+		}
+
+		return true
+	})
+
+	server.logger.Info("Closed events stream",
+		zap.String("requestId", requestid.Get(c)),
+	)
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	messagesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dsock_api_messages_total",
+		Help: "Messages delivered to workers, by message type (message, or channel for channel actions)",
+	}, []string{"message_type"})
+	messageBytesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dsock_api_message_bytes_total",
+		Help: "Bytes of messages delivered to workers (once per delivery), by message type (message, or channel for channel actions)",
+	}, []string{"message_type"})
+	fanoutWorkers = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dsock_api_fanout_workers",
+		Help:    "Number of workers a message is delivered to, by message type (message, or channel for channel actions)",
+		Buckets: []float64{0, 1, 2, 5, 10, 25, 50, 100, 250},
+	}, []string{"message_type"})
+	sendToWorkersDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dsock_api_send_to_workers_duration_seconds",
+		Help:    "Duration of delivering a message to workers, by messaging method",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"messaging_method"})
+	requestRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dsock_api_request_rejections_total",
+		Help: "Requests rejected by authentication, token scopes or rate limits, by error code",
+	}, []string{"error_code"})
+)
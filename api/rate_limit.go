@@ -0,0 +1,85 @@
+package api
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"math"
+	"strconv"
+)
+
+/// Gets the target of a request to count rate limits per target
+type rateLimitTarget func(c *gin.Context) string
+
+/// Target of /send and /disconnect (connection, channel or user, in targeting precedence order)
+func resolveTarget(c *gin.Context) string {
+	if connection := c.Query("id"); connection != "" {
+		return "connection:" + connection
+	}
+
+	if channel := c.Query("channel"); channel != "" {
+		return "channel:" + channel
+	}
+
+	if user := c.Query("user"); user != "" {
+		return "user:" + user
+	}
+
+	return ""
+}
+
+/// Target of /claim and /broker (user)
+func claimTarget(c *gin.Context) string {
+	return "user:" + c.Query("user")
+}
+
+/// Limits requests to the endpoint to `limit` per `rate_limit_window`, counted per token (and target).
+/// Must be after the token middleware
+func (server *Server) rateLimitMiddleware(endpoint string, limit int, target rateLimitTarget) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit <= 0 {
+			return
+		}
+
+		// Tokens are hashed to not store them in the store
+		key := endpoint + ":" + common.HashToken(c.GetString(common.TokenContextKey))[:16]
+
+		if server.options.RateLimit.ByTarget {
+			key = key + ":" + target(c)
+		}
+
+		rateLimit, err := server.dataStore.RateLimit(key, limit, server.options.RateLimit.Window)
+		if err != nil {
+			// Fail open, the store being unavailable shouldn't block all requests
+			server.logger.Error("Could not check rate limit",
+				zap.String("requestId", requestid.Get(c)),
+				zap.String("endpoint", endpoint),
+				zap.Error(err),
+			)
+			return
+		}
+
+		resetSeconds := strconv.Itoa(int(math.Ceil(rateLimit.Reset.Seconds())))
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(rateLimit.Remaining))
+		c.Header("X-RateLimit-Reset", resetSeconds)
+
+		if !rateLimit.Allowed {
+			server.logger.Warn("Rate limited request",
+				zap.String("requestId", requestid.Get(c)),
+				zap.String("endpoint", endpoint),
+				zap.String("target", target(c)),
+			)
+
+			c.Header("Retry-After", resetSeconds)
+
+			rejectRequest(c, &common.ApiError{
+				ErrorCode:  common.ErrorRateLimited,
+				StatusCode: 429,
+				RequestId:  requestid.Get(c),
+			})
+		}
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package api
 
 import (
 	"github.com/Cretezy/dSock/common"
@@ -9,8 +9,8 @@ import (
 	"io/ioutil"
 )
 
-func sendHandler(c *gin.Context) {
-	logger.Info("Getting send request",
+func (server *Server) sendHandler(c *gin.Context) {
+	server.logger.Info("Getting send request",
 		zap.String("requestId", requestid.Get(c)),
 		zap.String("id", c.Query("id")),
 		zap.String("user", c.Query("user")),
@@ -32,11 +32,21 @@ func sendHandler(c *gin.Context) {
 		return
 	}
 
-	// Get all worker IDs that the target(s) is connected to
-	workerIds, apiError := resolveWorkers(resolveOptions, requestid.Get(c))
-	if apiError != nil {
-		apiError.Send(c)
-		return
+	// With pubsub channel fan-out, channel messages are published once to the channel's topic,
+	// without resolving the channel's connections
+	channelFanout := server.options.ChannelFanout == common.ChannelFanoutPubSub &&
+		resolveOptions.Connection == "" && resolveOptions.Channel != ""
+
+	var workerIds []string
+	var apiError *common.ApiError
+
+	if !channelFanout {
+		// Get all worker IDs that the target(s) is connected to
+		workerIds, apiError = server.resolveWorkers(c.Request.Context(), resolveOptions, requestid.Get(c))
+		if apiError != nil {
+			apiError.Send(c)
+			return
+		}
 	}
 
 	parsedMessageType := ParseMessageType(c.Query("type"))
@@ -77,14 +87,18 @@ func sendHandler(c *gin.Context) {
 		},
 	}
 
-	// Send to all workers
-	apiError = sendToWorkers(workerIds, message, MessageMessageType, requestid.Get(c))
+	if channelFanout {
+		apiError = server.sendToChannel(c.Request.Context(), resolveOptions.Channel, message, requestid.Get(c))
+	} else {
+		// Send to all workers
+		apiError = server.sendToWorkers(c.Request.Context(), workerIds, message, common.MessageMessageType, requestid.Get(c))
+	}
 	if apiError != nil {
 		apiError.Send(c)
 		return
 	}
 
-	logger.Info("Sent message",
+	server.logger.Info("Sent message",
 		zap.String("requestId", requestid.Get(c)),
 		zap.Strings("workerIds", workerIds),
 		zap.String("id", resolveOptions.Connection),
@@ -94,6 +108,10 @@ func sendHandler(c *gin.Context) {
 		zap.Int("bodyLength", len(body)),
 	)
 
+	if server.hooks.OnSend != nil {
+		server.hooks.OnSend(resolveOptions, parsedMessageType, body)
+	}
+
 	c.AbortWithStatusJSON(200, map[string]interface{}{
 		"success": true,
 	})
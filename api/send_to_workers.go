@@ -1,23 +1,52 @@
-package main
+package api
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"github.com/Cretezy/dSock/common"
-	"github.com/go-redis/redis/v7"
+	"github.com/Cretezy/dSock/common/protos"
+	"github.com/Cretezy/dSock/common/store"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/proto"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"sync"
 	"time"
 )
 
-const (
-	MessageMessageType = "message"
-	ChannelMessageType = "channel"
-)
+/// Sets the trace context sent with the message to workers
+func setTraceContext(message proto.Message, traceContext map[string]string) {
+	switch message := message.(type) {
+	case *protos.Message:
+		message.TraceContext = traceContext
+	case *protos.ChannelAction:
+		message.TraceContext = traceContext
+	}
+}
+
+func (server *Server) sendToWorkers(ctx context.Context, workerIds []string, message proto.Message, messageType string, requestId string) (apiError *common.ApiError) {
+	defer func(start time.Time) {
+		sendToWorkersDuration.WithLabelValues(server.options.MessagingMethod).Observe(time.Since(start).Seconds())
+	}(time.Now())
+
+	ctx, span := common.Tracer.Start(ctx, "sendToWorkers", trace.WithAttributes(
+		attribute.String("dsock.message_type", messageType),
+		attribute.String("dsock.messaging_method", server.options.MessagingMethod),
+		attribute.Int("dsock.workers", len(workerIds)),
+	))
+	defer func() {
+		common.EndSpan(span, apiError)
+	}()
+
+	// Continued by the workers, down to writing to the connections
+	setTraceContext(message, common.InjectTraceContext(ctx))
 
-func sendToWorkers(workerIds []string, message proto.Message, messageType string, requestId string) *common.ApiError {
 	rawMessage, err := proto.Marshal(message)
 
 	if err != nil {
@@ -29,36 +58,56 @@ func sendToWorkers(workerIds []string, message proto.Message, messageType string
 		}
 	}
 
+	messagesTotal.WithLabelValues(messageType).Inc()
+	messageBytesTotal.WithLabelValues(messageType).Add(float64(len(rawMessage)))
+	fanoutWorkers.WithLabelValues(messageType).Observe(float64(len(workerIds)))
+
+	if server.localDelivery != nil {
+		remoteWorkerIds := make([]string, 0, len(workerIds))
+
+		for _, workerId := range workerIds {
+			if workerId != server.localWorkerId {
+				remoteWorkerIds = append(remoteWorkerIds, workerId)
+				continue
+			}
+
+			server.logger.Info("Delivering to local worker",
+				zap.String("requestId", requestId),
+				zap.String("workerId", workerId),
+				zap.String("messageType", messageType),
+			)
+
+			server.localDelivery(messageType, message)
+		}
+
+		workerIds = remoteWorkerIds
+
+		if len(workerIds) == 0 {
+			return nil
+		}
+	}
+
 	errs := make([]error, 0)
 	errsLock := sync.Mutex{}
 
 	addError := func(err error) {
 		errsLock.Lock()
-		defer errsLock.Lock()
+		defer errsLock.Unlock()
 
 		errs = append(errs, err)
 	}
 
-	if options.MessagingMethod == common.MessageMethodRedis {
-		_, err := redisClient.Pipelined(func(pipeliner redis.Pipeliner) error {
-			for _, workerId := range workerIds {
-				redisChannel := workerId
-				if messageType == ChannelMessageType {
-					redisChannel = redisChannel + ":channel"
-				}
-
-				logger.Info("Publishing to worker",
-					zap.String("requestId", requestId),
-					zap.String("workerId", workerId),
-					zap.String("messageType", messageType),
-					zap.String("redisChannel", redisChannel),
-				)
-
-				pipeliner.Publish(redisChannel, rawMessage)
-			}
+	if server.options.MessagingMethod == common.MessageMethodRedis || server.options.MessagingMethod == common.MessageMethodRedisStreams {
+		server.logger.Info("Publishing to workers",
+			zap.String("requestId", requestId),
+			zap.Strings("workerIds", workerIds),
+			zap.String("messageType", messageType),
+			zap.String("messagingMethod", server.options.MessagingMethod),
+		)
 
-			return nil
-		})
+		_, publishSpan := common.Tracer.Start(ctx, "store.Publish", trace.WithSpanKind(trace.SpanKindProducer))
+		err := server.dataStore.Publish(workerIds, messageType, rawMessage)
+		publishSpan.End()
 
 		if err != nil {
 			return &common.ApiError{
@@ -68,16 +117,8 @@ func sendToWorkers(workerIds []string, message proto.Message, messageType string
 				RequestId:     requestId,
 			}
 		}
-
 	} else {
-		var workerCmds = make([]*redis.StringStringMapCmd, len(workerIds))
-		_, err := redisClient.Pipelined(func(pipeliner redis.Pipeliner) error {
-			for index, workerId := range workerIds {
-				workerCmds[index] = pipeliner.HGetAll("worker:" + workerId)
-			}
-
-			return nil
-		})
+		resolvedWorkers, err := server.dataStore.GetWorkers(workerIds)
 
 		if err != nil {
 			return &common.ApiError{
@@ -88,30 +129,34 @@ func sendToWorkers(workerIds []string, message proto.Message, messageType string
 			}
 		}
 
+		workers := make(map[string]*store.Worker, len(resolvedWorkers))
+		for _, worker := range resolvedWorkers {
+			workers[worker.Id] = worker
+		}
+
 		var workersWaitGroup sync.WaitGroup
 		workersWaitGroup.Add(len(workerIds))
 
-		for index, workerId := range workerIds {
-			index := index
+		for _, workerId := range workerIds {
 			workerId := workerId
 
 			go func() {
 				defer workersWaitGroup.Done()
 
-				worker := workerCmds[index]
+				worker, workerExists := workers[workerId]
 
-				if len(worker.Val()) == 0 {
-					logger.Error("Found empty worker in Redis",
+				if !workerExists {
+					server.logger.Error("Found empty worker in Redis",
 						zap.String("requestId", requestId),
 						zap.String("workerId", workerId),
 					)
 					return
 				}
 
-				ip := worker.Val()["ip"]
+				workerUrl := worker.DirectMessageUrl()
 
-				if ip == "" {
-					logger.Error("Found worker with no IP in Redis (is the worker not configured for direct access?)",
+				if workerUrl == "" {
+					server.logger.Error("Found worker with no direct messaging URL in Redis (is the worker not configured for direct access?)",
 						zap.String("requestId", requestId),
 						zap.String("workerId", workerId),
 					)
@@ -119,13 +164,19 @@ func sendToWorkers(workerIds []string, message proto.Message, messageType string
 				}
 
 				path := common.PathReceiveMessage
-				if messageType == ChannelMessageType {
+				if messageType == common.ChannelMessageType {
 					path = common.PathReceiveChannelMessage
 				}
 
-				url := "http://" + ip + path
+				url := workerUrl + path
+
+				ctx, requestSpan := common.Tracer.Start(ctx, "POST "+path,
+					trace.WithSpanKind(trace.SpanKindClient),
+					trace.WithAttributes(attribute.String("dsock.worker_id", workerId)),
+				)
+				defer requestSpan.End()
 
-				logger.Info("Starting request to worker",
+				server.logger.Info("Starting request to worker",
 					zap.String("requestId", requestId),
 					zap.String("workerId", workerId),
 					zap.String("messageType", messageType),
@@ -133,12 +184,10 @@ func sendToWorkers(workerIds []string, message proto.Message, messageType string
 				)
 
 				// Non-standardized Content-Type used here.
-				// Future: Add HTTPS options? Maybe store full direct path in Redis instead of "ip",
-				// which here is hostname + port.
-				// Also, no error can be returned on the worker side, so only 200 can be handled.
+				// No error can be returned on the worker side, so only 200 can be handled.
 				req, err := http.NewRequest("POST", url, bytes.NewReader(rawMessage))
 				if err != nil {
-					logger.Error("Could create request",
+					server.logger.Error("Could create request",
 						zap.String("requestId", requestId),
 						zap.String("workerId", workerId),
 						zap.String("url", url),
@@ -146,7 +195,7 @@ func sendToWorkers(workerIds []string, message proto.Message, messageType string
 						zap.Error(err),
 					)
 					addError(&common.ApiError{
-						InternalError: worker.Err(),
+						InternalError: err,
 						StatusCode:    500,
 						ErrorCode:     common.ErrorReachingWorker,
 					})
@@ -155,13 +204,15 @@ func sendToWorkers(workerIds []string, message proto.Message, messageType string
 
 				req.Header.Set("Content-Type", common.ProtobufContentType)
 				req.Header.Set("X-Request-ID", requestId)
+				common.AuthorizeDirectRequest(server.options, req, path, rawMessage)
+				otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 				beforeRequestTime := time.Now()
-				resp, err := http.DefaultClient.Do(req)
+				resp, err := server.directClient.Do(req)
 				requestTime := time.Now().Sub(beforeRequestTime)
 
 				if err != nil {
-					logger.Error("Could not reach worker",
+					server.logger.Error("Could not reach worker",
 						zap.String("requestId", requestId),
 						zap.String("workerId", workerId),
 						zap.String("url", url),
@@ -170,15 +221,19 @@ func sendToWorkers(workerIds []string, message proto.Message, messageType string
 						zap.Error(err),
 					)
 					addError(&common.ApiError{
-						InternalError: worker.Err(),
+						InternalError: err,
 						StatusCode:    500,
 						ErrorCode:     common.ErrorReachingWorker,
 					})
 					return
 				}
 
+				defer resp.Body.Close()
+				// Read the body to reuse the connection
+				_, _ = io.Copy(ioutil.Discard, resp.Body)
+
 				if resp.StatusCode != 200 {
-					logger.Error("Worker could not handle request",
+					server.logger.Error("Worker could not handle request",
 						zap.String("requestId", requestId),
 						zap.String("workerId", workerId),
 						zap.String("url", url),
@@ -188,13 +243,13 @@ func sendToWorkers(workerIds []string, message proto.Message, messageType string
 						zap.Duration("requestTime", requestTime),
 					)
 					addError(&common.ApiError{
-						InternalError: worker.Err(),
+						InternalError: errors.New(resp.Status),
 						StatusCode:    500,
 						ErrorCode:     common.ErrorReachingWorker,
 					})
 				}
 
-				logger.Info("Finished request to worker",
+				server.logger.Info("Finished request to worker",
 					zap.String("requestId", requestId),
 					zap.String("workerId", workerId),
 					zap.String("url", url),
@@ -228,3 +283,45 @@ func sendToWorkers(workerIds []string, message proto.Message, messageType string
 
 	return nil
 }
+
+/// Publishes a message to the channel's topic, received by all workers holding connections in the channel
+func (server *Server) sendToChannel(ctx context.Context, channel string, message proto.Message, requestId string) (apiError *common.ApiError) {
+	ctx, span := common.Tracer.Start(ctx, "sendToChannel", trace.WithSpanKind(trace.SpanKindProducer))
+	defer func() {
+		common.EndSpan(span, apiError)
+	}()
+
+	setTraceContext(message, common.InjectTraceContext(ctx))
+
+	rawMessage, err := proto.Marshal(message)
+
+	if err != nil {
+		return &common.ApiError{
+			InternalError: err,
+			ErrorCode:     common.ErrorMarshallingMessage,
+			StatusCode:    500,
+			RequestId:     requestId,
+		}
+	}
+
+	messagesTotal.WithLabelValues(common.MessageMessageType).Inc()
+	messageBytesTotal.WithLabelValues(common.MessageMessageType).Add(float64(len(rawMessage)))
+
+	server.logger.Info("Publishing to channel topic",
+		zap.String("requestId", requestId),
+		zap.String("channel", channel),
+	)
+
+	err = server.dataStore.PublishChannel(channel, common.MessageMessageType, rawMessage)
+
+	if err != nil {
+		return &common.ApiError{
+			InternalError: err,
+			ErrorCode:     common.ErrorDeliveringMessage,
+			StatusCode:    500,
+			RequestId:     requestId,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,433 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/Cretezy/dSock/common"
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"strings"
+	"sync"
+	"time"
+)
+
+/// Context key of the API token (with scopes) the request was authorized with
+const apiTokenContextKey = "apiToken"
+
+/// Token looked up in the store
+type cachedToken struct {
+	token      *common.ApiToken
+	expiration time.Time
+}
+
+/// API tokens from the config & store, by the hash of their secret
+type tokensState struct {
+	/// Main token (token option), with all scopes
+	main *common.ApiToken
+	/// Tokens from the config (tokens option)
+	config map[string]*common.ApiToken
+	/// Tokens found in the store. Tokens not found aren't cached, so that they can be used as soon as created
+	cache      map[string]cachedToken
+	cacheMutex sync.Mutex
+}
+
+func newTokensState(options *common.DSockOptions) *tokensState {
+	tokens := &tokensState{
+		main: &common.ApiToken{
+			Name:   "main",
+			Token:  options.Token,
+			Scopes: common.Scopes,
+		},
+		config: make(map[string]*common.ApiToken),
+		cache:  make(map[string]cachedToken),
+	}
+
+	for index := range options.Tokens {
+		token := &options.Tokens[index]
+		tokens.config[common.HashToken(token.Token)] = token
+	}
+
+	return tokens
+}
+
+/// Finds the token for the secret (main token, then config tokens, then stored tokens). Returns nil if not found
+func (server *Server) findToken(secret string) (*common.ApiToken, error) {
+	tokens := server.tokens
+
+	// Without other tokens, an empty main token allows all requests without a token
+	if secret == server.options.Token &&
+		(secret != "" || (len(tokens.config) == 0 && !server.options.StoreTokens)) {
+		return tokens.main, nil
+	}
+
+	if secret == "" {
+		return nil, nil
+	}
+
+	hash := common.HashToken(secret)
+
+	if token, exists := tokens.config[hash]; exists {
+		return token, nil
+	}
+
+	if !server.options.StoreTokens {
+		return nil, nil
+	}
+
+	tokens.cacheMutex.Lock()
+	cached, exists := tokens.cache[hash]
+	tokens.cacheMutex.Unlock()
+
+	if exists && cached.expiration.After(time.Now()) {
+		return cached.token, nil
+	}
+
+	token, err := server.dataStore.GetToken(hash)
+	if err != nil || token == nil {
+		return nil, err
+	}
+
+	tokens.cacheMutex.Lock()
+	tokens.cache[hash] = cachedToken{
+		token:      token,
+		expiration: time.Now().Add(server.options.TokenCacheDuration),
+	}
+	tokens.cacheMutex.Unlock()
+
+	return token, nil
+}
+
+/// Removes the stored token with the name from this node's cache (other nodes expire it after token_cache_duration)
+func (tokens *tokensState) uncache(name string) {
+	tokens.cacheMutex.Lock()
+	defer tokens.cacheMutex.Unlock()
+
+	for hash, cached := range tokens.cache {
+		if cached.token.Name == name {
+			delete(tokens.cache, hash)
+		}
+	}
+}
+
+/// Gets the request's token. Without the server's token middleware (such as with common.TokenMiddleware),
+/// requests are authorized with the main token
+func (server *Server) getApiToken(c *gin.Context) *common.ApiToken {
+	if token, ok := c.Get(apiTokenContextKey); ok {
+		return token.(*common.ApiToken)
+	}
+
+	return server.tokens.main
+}
+
+/// Sends the error for a request rejected by authentication, token scopes or rate limits, counting it in metrics
+func rejectRequest(c *gin.Context, apiError *common.ApiError) {
+	requestRejectionsTotal.WithLabelValues(apiError.ErrorCode).Inc()
+
+	apiError.Send(c)
+}
+
+/// Validates that the token from query parameter or from Authorization header is the main token,
+/// or a token from the config or store. Routes then check the token's scope
+func (server *Server) TokenMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secret := common.GetRequestToken(c)
+
+		token, err := server.findToken(secret)
+		if err != nil {
+			apiError := &common.ApiError{
+				InternalError: err,
+				ErrorCode:     common.ErrorGettingToken,
+				StatusCode:    500,
+				RequestId:     requestid.Get(c),
+			}
+			apiError.Send(c)
+			return
+		}
+
+		if token == nil {
+			rejectRequest(c, &common.ApiError{
+				StatusCode: 400,
+				ErrorCode:  common.ErrorInvalidAuthorization,
+				RequestId:  requestid.Get(c),
+			})
+			return
+		}
+
+		c.Set(common.TokenContextKey, secret)
+		c.Set(apiTokenContextKey, token)
+	}
+}
+
+/// Targets of a request, checked against the restrictions of the token
+type tokenTargets struct {
+	/// If the request targets connections or claims by ID (not allowed for restricted tokens)
+	byId     bool
+	user     string
+	channels []string
+}
+
+/// Gets the targets of a request to check them against the token's restrictions
+type tokenTargetsGetter func(c *gin.Context) tokenTargets
+
+/// Targets of requests targeting connections/claims (connection or claim ID, user, channel, and the channel changed)
+func resolveTokenTargets(c *gin.Context) tokenTargets {
+	return tokenTargets{
+		byId:     c.Query("id") != "" || c.Query("claim") != "",
+		user:     c.Query("user"),
+		channels: common.RemoveEmpty([]string{c.Query("channel"), c.Param("channel")}),
+	}
+}
+
+/// Targets of /claim and /broker (user, and the claim's channels)
+func claimTokenTargets(c *gin.Context) tokenTargets {
+	return tokenTargets{
+		user:     c.Query("user"),
+		channels: common.RemoveEmpty(strings.Split(c.Query("channels"), ",")),
+	}
+}
+
+/// Checks that the token can act on the targets. Restricted tokens must target a user or channel, which must be allowed
+func tokenAllowsTargets(token *common.ApiToken, targets tokenTargets) bool {
+	if !token.Restricted() {
+		return true
+	}
+
+	if targets.byId || (targets.user == "" && len(targets.channels) == 0) {
+		return false
+	}
+
+	if targets.user != "" && !token.AllowsUser(targets.user) {
+		return false
+	}
+
+	for _, channel := range targets.channels {
+		if !token.AllowsChannel(channel) {
+			return false
+		}
+	}
+
+	return true
+}
+
+/// Checks that the request's token has the scope, and is allowed to act on the request's targets (if targets is set).
+/// Must be after the token middleware
+func (server *Server) scopeMiddleware(scope string, targets tokenTargetsGetter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := server.getApiToken(c)
+
+		if !token.HasScope(scope) {
+			server.logger.Warn("Token missing scope",
+				zap.String("requestId", requestid.Get(c)),
+				zap.String("token", token.Name),
+				zap.String("scope", scope),
+			)
+
+			rejectRequest(c, &common.ApiError{
+				ErrorCode:  common.ErrorMissingScope,
+				StatusCode: 403,
+				RequestId:  requestid.Get(c),
+			})
+			return
+		}
+
+		if targets != nil && !tokenAllowsTargets(token, targets(c)) {
+			server.logger.Warn("Token not allowed to target",
+				zap.String("requestId", requestid.Get(c)),
+				zap.String("token", token.Name),
+				zap.String("user", c.Query("user")),
+				zap.String("channel", c.Query("channel")),
+			)
+
+			rejectRequest(c, &common.ApiError{
+				ErrorCode:  common.ErrorTargetNotAllowed,
+				StatusCode: 403,
+				RequestId:  requestid.Get(c),
+			})
+			return
+		}
+	}
+}
+
+/// Only allows the main token (managing tokens)
+func (server *Server) mainTokenMiddleware(c *gin.Context) {
+	if server.getApiToken(c) != server.tokens.main {
+		rejectRequest(c, &common.ApiError{
+			ErrorCode:          common.ErrorMissingScope,
+			CustomErrorMessage: "Managing tokens requires the main token",
+			StatusCode:         403,
+			RequestId:          requestid.Get(c),
+		})
+	}
+}
+
+type createTokenOptions struct {
+	Name         string `form:"name"`
+	Scopes       string `form:"scopes"`
+	Channels     string `form:"channels"`
+	UserPrefixes string `form:"userPrefixes"`
+}
+
+/// Lists the tokens in the store (without their secret)
+func (server *Server) tokensHandler(c *gin.Context) {
+	server.logger.Info("Getting tokens request",
+		zap.String("requestId", requestid.Get(c)),
+	)
+
+	tokens, err := server.dataStore.ListTokens()
+	if err != nil {
+		apiError := &common.ApiError{
+			InternalError: err,
+			ErrorCode:     common.ErrorGettingToken,
+			StatusCode:    500,
+			RequestId:     requestid.Get(c),
+		}
+		apiError.Send(c)
+		return
+	}
+
+	c.AbortWithStatusJSON(200, map[string]interface{}{
+		"success": true,
+		"tokens":  tokens,
+	})
+}
+
+/// Creates a token in the store, with a generated secret (only returned in the response)
+func (server *Server) createTokenHandler(c *gin.Context) {
+	server.logger.Info("Getting create token request",
+		zap.String("requestId", requestid.Get(c)),
+		zap.String("name", c.Query("name")),
+		zap.String("scopes", c.Query("scopes")),
+		zap.String("channels", c.Query("channels")),
+		zap.String("userPrefixes", c.Query("userPrefixes")),
+	)
+
+	tokenOptions := createTokenOptions{}
+
+	err := c.BindQuery(&tokenOptions)
+	if err != nil {
+		apiError := &common.ApiError{
+			InternalError: err,
+			ErrorCode:     common.ErrorBindingQueryParams,
+			StatusCode:    400,
+			RequestId:     requestid.Get(c),
+		}
+		apiError.Send(c)
+		return
+	}
+
+	secret := make([]byte, 32)
+	_, err = rand.Read(secret)
+	if err != nil {
+		apiError := &common.ApiError{
+			InternalError: err,
+			ErrorCode:     common.ErrorCreatingToken,
+			StatusCode:    500,
+			RequestId:     requestid.Get(c),
+		}
+		apiError.Send(c)
+		return
+	}
+
+	token := &common.ApiToken{
+		Name:         tokenOptions.Name,
+		Token:        hex.EncodeToString(secret),
+		Scopes:       common.UniqueString(common.RemoveEmpty(strings.Split(tokenOptions.Scopes, ","))),
+		Channels:     common.UniqueString(common.RemoveEmpty(strings.Split(tokenOptions.Channels, ","))),
+		UserPrefixes: common.UniqueString(common.RemoveEmpty(strings.Split(tokenOptions.UserPrefixes, ","))),
+	}
+
+	err = token.Validate()
+	if err != nil {
+		apiError := &common.ApiError{
+			InternalError:      err,
+			ErrorCode:          common.ErrorInvalidToken,
+			CustomErrorMessage: "Invalid token: " + err.Error(),
+			StatusCode:         400,
+			RequestId:          requestid.Get(c),
+		}
+		apiError.Send(c)
+		return
+	}
+
+	created, err := server.dataStore.CreateToken(token)
+	if err != nil {
+		apiError := &common.ApiError{
+			InternalError: err,
+			ErrorCode:     common.ErrorCreatingToken,
+			StatusCode:    500,
+			RequestId:     requestid.Get(c),
+		}
+		apiError.Send(c)
+		return
+	}
+
+	if !created {
+		apiError := &common.ApiError{
+			ErrorCode:  common.ErrorTokenNameAlreadyUsed,
+			StatusCode: 400,
+			RequestId:  requestid.Get(c),
+		}
+		apiError.Send(c)
+		return
+	}
+
+	server.logger.Info("Created token",
+		zap.String("requestId", requestid.Get(c)),
+		zap.String("name", token.Name),
+	)
+
+	c.AbortWithStatusJSON(200, map[string]interface{}{
+		"success": true,
+		"token": gin.H{
+			"name":         token.Name,
+			"token":        token.Token,
+			"scopes":       token.Scopes,
+			"channels":     token.Channels,
+			"userPrefixes": token.UserPrefixes,
+		},
+	})
+}
+
+/// Deletes a token from the store
+func (server *Server) revokeTokenHandler(c *gin.Context) {
+	server.logger.Info("Getting revoke token request",
+		zap.String("requestId", requestid.Get(c)),
+		zap.String("name", c.Query("name")),
+	)
+
+	name := c.Query("name")
+
+	deleted, err := server.dataStore.DeleteToken(name)
+	if err != nil {
+		apiError := &common.ApiError{
+			InternalError: err,
+			ErrorCode:     common.ErrorDeletingToken,
+			StatusCode:    500,
+			RequestId:     requestid.Get(c),
+		}
+		apiError.Send(c)
+		return
+	}
+
+	if !deleted {
+		apiError := &common.ApiError{
+			ErrorCode:  common.ErrorMissingToken,
+			StatusCode: 404,
+			RequestId:  requestid.Get(c),
+		}
+		apiError.Send(c)
+		return
+	}
+
+	server.tokens.uncache(name)
+
+	server.logger.Info("Revoked token",
+		zap.String("requestId", requestid.Get(c)),
+		zap.String("name", name),
+	)
+
+	c.AbortWithStatusJSON(200, map[string]interface{}{
+		"success": true,
+	})
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/common/store"
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func formatWorker(worker *store.Worker) gin.H {
+	workerMap := gin.H{
+		"id":       worker.Id,
+		"status":   worker.Status,
+		"lastPing": worker.LastPing.Unix(),
+		"load": gin.H{
+			"connections": worker.Load.Connections,
+			"goroutines":  worker.Load.Goroutines,
+			"memory":      worker.Load.Memory,
+			"cpu":         worker.Load.Cpu,
+			"queueDepth":  worker.Load.QueueDepth,
+			"atCapacity":  worker.Load.AtCapacity,
+		},
+	}
+
+	if worker.Ip != "" {
+		workerMap["ip"] = worker.Ip
+	}
+
+	if worker.DirectUrl != "" {
+		workerMap["directUrl"] = worker.DirectUrl
+	}
+
+	if worker.PublicUrl != "" {
+		workerMap["url"] = worker.PublicUrl
+	}
+
+	if worker.Region != "" {
+		workerMap["region"] = worker.Region
+	}
+
+	return workerMap
+}
+
+func (server *Server) workersHandler(c *gin.Context) {
+	server.logger.Info("Getting workers request",
+		zap.String("requestId", requestid.Get(c)),
+	)
+
+	resolvedWorkers, err := server.dataStore.ListWorkers()
+	if err != nil {
+		apiError := &common.ApiError{
+			InternalError: err,
+			ErrorCode:     common.ErrorGettingWorker,
+			StatusCode:    500,
+			RequestId:     requestid.Get(c),
+		}
+		apiError.Send(c)
+		return
+	}
+
+	workers := make([]gin.H, len(resolvedWorkers))
+
+	for index, worker := range resolvedWorkers {
+		workers[index] = formatWorker(worker)
+	}
+
+	c.AbortWithStatusJSON(200, map[string]interface{}{
+		"success": true,
+		"workers": workers,
+	})
+}
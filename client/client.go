@@ -0,0 +1,382 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Cretezy/dSock/common"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Options struct {
+	/// URL of the API (without the path)
+	Url string
+	/// API token, sent in the Authorization header
+	Token string
+	/// Timeout of each request attempt. Defaults to 30 seconds. Does not apply to event streams
+	Timeout time.Duration
+	/// Maximum retries of requests that failed because of a network error before a response was received,
+	/// rate limiting (429) or an unavailable API (502, 503 & 504). Requests that received a successful response aren't retried,
+	/// even if it couldn't be read or decoded. Messages may be sent more than once when retrying after a network error.
+	/// Defaults to 0 (no retries)
+	MaxRetries int
+	/// Minimum & maximum delay between retries (doubling on each retry), unless the API responds with Retry-After.
+	/// Default to 100 milliseconds & 5 seconds
+	RetryMinBackoff time.Duration
+	RetryMaxBackoff time.Duration
+	/// HTTP client used for requests. Defaults to http.DefaultClient
+	HttpClient *http.Client
+}
+
+type Client struct {
+	options Options
+}
+
+func New(options Options) *Client {
+	options.Url = strings.TrimSuffix(options.Url, "/")
+
+	if options.Timeout == 0 {
+		options.Timeout = time.Second * 30
+	}
+
+	if options.RetryMinBackoff == 0 {
+		options.RetryMinBackoff = time.Millisecond * 100
+	}
+
+	if options.RetryMaxBackoff == 0 {
+		options.RetryMaxBackoff = time.Second * 5
+	}
+
+	if options.HttpClient == nil {
+		options.HttpClient = http.DefaultClient
+	}
+
+	return &Client{
+		options: options,
+	}
+}
+
+/// Creates an authenticated request to the API
+func (client *Client) newRequest(ctx context.Context, method string, path string, query url.Values, body []byte) (*http.Request, error) {
+	requestUrl := client.options.Url + path
+	if len(query) != 0 {
+		requestUrl += "?" + query.Encode()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, requestUrl, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if client.options.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+client.options.Token)
+	}
+
+	return request, nil
+}
+
+/// Sends a request to the API (retrying if enabled), decoding the JSON response into response (if not nil)
+func (client *Client) request(ctx context.Context, method string, path string, query url.Values, body []byte, response interface{}) error {
+	backoff := common.Backoff{
+		Min: client.options.RetryMinBackoff,
+		Max: client.options.RetryMaxBackoff,
+	}
+
+	for attempt := 0; ; attempt++ {
+		retryable, err := client.attempt(ctx, method, path, query, body, response)
+		if err == nil || attempt >= client.options.MaxRetries || !retryable {
+			return err
+		}
+
+		retryIn := backoff.Next()
+
+		var apiError *Error
+		if errors.As(err, &apiError) && apiError.RetryAfter != 0 {
+			retryIn = apiError.RetryAfter
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(retryIn):
+		}
+	}
+}
+
+/// Sends the request once. Returns whether the request can be retried if it failed
+func (client *Client) attempt(ctx context.Context, method string, path string, query url.Values, body []byte, response interface{}) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, client.options.Timeout)
+	defer cancel()
+
+	request, err := client.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := client.options.HttpClient.Do(request)
+	if err != nil {
+		// Network error, before a response was received
+		return true, err
+	}
+
+	defer resp.Body.Close()
+
+	// The API received the request, so errors from now on are final (retrying could send messages twice)
+	rawResponse, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode != 200 {
+		return retryableStatus(resp.StatusCode), parseError(resp, rawResponse)
+	}
+
+	if response != nil {
+		err = json.Unmarshal(rawResponse, response)
+		if err != nil {
+			return false, fmt.Errorf("dsock: could not parse response: %w", err)
+		}
+	}
+
+	return false, nil
+}
+
+/// Parses an error response from the API
+func parseError(resp *http.Response, body []byte) error {
+	apiError := &Error{
+		StatusCode: resp.StatusCode,
+	}
+
+	response := struct {
+		ErrorCode string `json:"errorCode"`
+		Error     string `json:"error"`
+		RequestId string `json:"requestId"`
+	}{}
+
+	err := json.Unmarshal(body, &response)
+	if err != nil || response.ErrorCode == "" {
+		apiError.Message = strings.TrimSpace(string(body))
+		if apiError.Message == "" {
+			apiError.Message = resp.Status
+		}
+	} else {
+		apiError.Code = response.ErrorCode
+		apiError.Message = response.Error
+		apiError.RequestId = response.RequestId
+	}
+
+	retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err == nil && retryAfter > 0 {
+		apiError.RetryAfter = time.Duration(retryAfter) * time.Second
+	}
+
+	return apiError
+}
+
+/// Whether the request can be retried after an error response with the status code
+func retryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+func targetQuery(target common.ResolveOptions) url.Values {
+	query := url.Values{}
+
+	setQuery(query, "id", target.Connection)
+	setQuery(query, "user", target.User)
+	setQuery(query, "session", target.Session)
+	setQuery(query, "channel", target.Channel)
+
+	return query
+}
+
+/// Sets the query parameter, if the value isn't empty
+func setQuery(query url.Values, key string, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
+
+func claimQuery(options ClaimOptions) url.Values {
+	query := url.Values{}
+
+	setQuery(query, "id", options.Id)
+	setQuery(query, "user", options.User)
+	setQuery(query, "session", options.Session)
+	setQuery(query, "channels", strings.Join(options.Channels, ","))
+
+	if !options.Expiration.IsZero() {
+		query.Set("expiration", strconv.FormatInt(options.Expiration.Unix(), 10))
+	} else if options.Duration != 0 {
+		query.Set("duration", strconv.FormatInt(int64(options.Duration/time.Second), 10))
+	}
+
+	return query
+}
+
+/// Sends a message to the target (connection ID, user & optional session, or channel)
+func (client *Client) Send(ctx context.Context, target common.ResolveOptions, messageType MessageType, message []byte) error {
+	query := targetQuery(target)
+	query.Set("type", string(messageType))
+
+	return client.request(ctx, "POST", common.PathSend, query, message, nil)
+}
+
+/// Creates a claim for a client to connect with
+func (client *Client) CreateClaim(ctx context.Context, options ClaimOptions) (*Claim, error) {
+	response := struct {
+		Claim *Claim `json:"claim"`
+	}{}
+
+	err := client.request(ctx, "POST", common.PathClaim, claimQuery(options), nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Claim, nil
+}
+
+/// Creates a claim on the least loaded worker, returning the URL to connect to
+func (client *Client) Broker(ctx context.Context, options BrokerOptions) (*Broker, error) {
+	query := claimQuery(options.ClaimOptions)
+	setQuery(query, "region", options.Region)
+
+	response := &Broker{}
+
+	err := client.request(ctx, "POST", common.PathBroker, query, nil, response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+/// Revokes claims (by ID, or for a user & optional session, or channel), returning the number of claims revoked
+func (client *Client) RevokeClaims(ctx context.Context, options RevokeOptions) (int, error) {
+	query := url.Values{}
+	setQuery(query, "claim", options.Claim)
+	setQuery(query, "user", options.User)
+	setQuery(query, "session", options.Session)
+	setQuery(query, "channel", options.Channel)
+
+	response := struct {
+		Claims int `json:"claims"`
+	}{}
+
+	err := client.request(ctx, "POST", common.PathClaimRevoke, query, nil, &response)
+	if err != nil {
+		return 0, err
+	}
+
+	return response.Claims, nil
+}
+
+/// Gets the open connections & non-expired claims of the target
+func (client *Client) Info(ctx context.Context, target common.ResolveOptions) (*Info, error) {
+	response := &Info{}
+
+	err := client.request(ctx, "GET", common.PathInfo, targetQuery(target), nil, response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+/// Lists the registered workers
+func (client *Client) Workers(ctx context.Context) ([]Worker, error) {
+	response := struct {
+		Workers []Worker `json:"workers"`
+	}{}
+
+	err := client.request(ctx, "GET", common.PathWorkers, nil, nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Workers, nil
+}
+
+/// Subscribes the target to the channel. Unless ignoreClaims, the channel is also added to the target's claims
+func (client *Client) Subscribe(ctx context.Context, target common.ResolveOptions, channel string, ignoreClaims bool) error {
+	return client.channelAction(ctx, common.PathChannelSubscribe, target, channel, ignoreClaims)
+}
+
+/// Unsubscribes the target from the channel. Unless ignoreClaims, the channel is also removed from the target's claims
+func (client *Client) Unsubscribe(ctx context.Context, target common.ResolveOptions, channel string, ignoreClaims bool) error {
+	return client.channelAction(ctx, common.PathChannelUnsubscribe, target, channel, ignoreClaims)
+}
+
+func (client *Client) channelAction(ctx context.Context, path string, target common.ResolveOptions, channel string, ignoreClaims bool) error {
+	query := targetQuery(target)
+	if ignoreClaims {
+		query.Set("ignoreClaims", "true")
+	}
+
+	path = strings.Replace(path, ":channel", url.PathEscape(channel), 1)
+
+	return client.request(ctx, "POST", path, query, nil, nil)
+}
+
+/// Disconnects the target. Unless keepClaims, the target's claims are also deleted
+func (client *Client) Disconnect(ctx context.Context, target common.ResolveOptions, keepClaims bool) error {
+	query := targetQuery(target)
+	if keepClaims {
+		query.Set("keepClaims", "true")
+	}
+
+	return client.request(ctx, "POST", common.PathDisconnect, query, nil, nil)
+}
+
+/// Lists the tokens in the store (without their secret). Requires the main token and store_tokens
+func (client *Client) Tokens(ctx context.Context) ([]Token, error) {
+	response := struct {
+		Tokens []Token `json:"tokens"`
+	}{}
+
+	err := client.request(ctx, "GET", common.PathTokens, nil, nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Tokens, nil
+}
+
+/// Creates a token in the store, returning it with its generated secret. Requires the main token and store_tokens
+func (client *Client) CreateToken(ctx context.Context, options TokenOptions) (*Token, error) {
+	query := url.Values{}
+	setQuery(query, "name", options.Name)
+	setQuery(query, "scopes", strings.Join(options.Scopes, ","))
+	setQuery(query, "channels", strings.Join(options.Channels, ","))
+	setQuery(query, "userPrefixes", strings.Join(options.UserPrefixes, ","))
+
+	response := struct {
+		Token *Token `json:"token"`
+	}{}
+
+	err := client.request(ctx, "POST", common.PathTokens, query, nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Token, nil
+}
+
+/// Deletes the token with the name from the store. Requires the main token and store_tokens
+func (client *Client) RevokeToken(ctx context.Context, name string) error {
+	query := url.Values{}
+	query.Set("name", name)
+
+	return client.request(ctx, "POST", common.PathTokenRevoke, query, nil, nil)
+}
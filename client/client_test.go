@@ -0,0 +1,610 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Cretezy/dSock/api"
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/common/store"
+	"github.com/Cretezy/dSock/worker"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const token = "abc123"
+const analyticsToken = "analytics123"
+
+/// Runs the client against the API & a worker (standalone, with the memory store)
+type ClientSuite struct {
+	suite.Suite
+	server    *httptest.Server
+	dataStore store.Store
+	options   *common.DSockOptions
+	api       *api.Server
+	worker    *worker.Server
+	client    *client.Client
+	/// Messages received from connections, by the worker's OnMessage hook
+	messages chan string
+}
+
+func TestClientSuite(t *testing.T) {
+	suite.Run(t, new(ClientSuite))
+}
+
+func (suite *ClientSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+
+	options, err := common.DefaultOptions(true)
+	suite.Require().NoError(err)
+
+	options.Store = common.StoreMemory
+	options.Token = token
+	// Faster shutdown (draining connections)
+	options.DrainWindow = time.Second
+	options.PublishEvents = true
+	options.Tokens = []common.ApiToken{{
+		Name:   "analytics",
+		Token:  analyticsToken,
+		Scopes: []string{common.ScopeInfo},
+	}}
+	options.StoreTokens = true
+
+	suite.options = options
+	suite.dataStore = store.NewMemoryStore()
+	suite.messages = make(chan string, 16)
+
+	suite.api = api.NewServer(api.ServerOptions{
+		Options: options,
+		Store:   suite.dataStore,
+	})
+	suite.worker = worker.NewServer(worker.ServerOptions{
+		Options: options,
+		Store:   suite.dataStore,
+		Hooks: worker.Hooks{
+			OnMessage: func(connection *store.Connection, messageType int, data []byte) {
+				suite.messages <- connection.User + ":" + string(data)
+			},
+		},
+	})
+	suite.api.SetLocalWorker(suite.worker.Id(), suite.worker.Deliver)
+
+	router := common.NewGinEngine(zap.NewNop(), options)
+	router.Use(common.RequestIdMiddleware)
+	suite.worker.RegisterRoutes(router)
+	suite.api.RegisterRoutes(router.Group("", suite.api.TokenMiddleware()))
+
+	suite.server = httptest.NewServer(router)
+
+	// Registered with the worker, for the connect broker
+	options.PublicUrl = suite.server.URL
+	suite.worker.Start()
+
+	suite.client = client.New(client.Options{
+		Url:   suite.server.URL,
+		Token: token,
+	})
+}
+
+func (suite *ClientSuite) TearDownSuite() {
+	suite.worker.Shutdown()
+	suite.server.Close()
+	_ = suite.dataStore.Close()
+}
+
+/// Connects a WebSocket client with a new claim for the user
+func (suite *ClientSuite) connect(user string, channels ...string) *websocket.Conn {
+	claim, err := suite.client.CreateClaim(context.Background(), client.ClaimOptions{
+		User:     user,
+		Channels: channels,
+	})
+	if !suite.NoError(err, "Error during claim creation") {
+		return nil
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(suite.wsUrl(common.PathConnect+"?claim="+claim.Id), nil)
+	if !suite.NoError(err, "Error during connection") {
+		return nil
+	}
+
+	// Connections are set in the store right after upgrading
+	time.Sleep(time.Millisecond * 10)
+
+	return conn
+}
+
+func (suite *ClientSuite) wsUrl(path string) string {
+	return "ws" + strings.TrimPrefix(suite.server.URL, "http") + path
+}
+
+func (suite *ClientSuite) receive(conn *websocket.Conn) string {
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	_, data, err := conn.ReadMessage()
+	if !suite.NoError(err, "Error during receiving message") {
+		return ""
+	}
+
+	return string(data)
+}
+
+func (suite *ClientSuite) TestClaim() {
+	expiration := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	claim, err := suite.client.CreateClaim(context.Background(), client.ClaimOptions{
+		Id:         "client_claim",
+		User:       "client_claim",
+		Session:    "session",
+		Channels:   []string{"a", "b"},
+		Expiration: expiration,
+	})
+	if !suite.NoError(err) {
+		return
+	}
+
+	suite.Equal("client_claim", claim.Id)
+	suite.Equal("client_claim", claim.User)
+	suite.Equal("session", claim.Session)
+	suite.Equal([]string{"a", "b"}, claim.Channels)
+	suite.True(expiration.Equal(claim.Expiration), "Incorrect expiration")
+
+	info, err := suite.client.Info(context.Background(), common.ResolveOptions{User: "client_claim"})
+	if !suite.NoError(err) {
+		return
+	}
+
+	if suite.Len(info.Claims, 1) {
+		suite.Equal("client_claim", info.Claims[0].Id)
+		suite.True(expiration.Equal(info.Claims[0].Expiration), "Incorrect expiration")
+	}
+	suite.Len(info.Connections, 0)
+
+	_, err = suite.client.CreateClaim(context.Background(), client.ClaimOptions{
+		Id:   "client_claim",
+		User: "client_claim",
+	})
+	suite.True(errors.Is(err, client.ErrClaimIdAlreadyUsed), "Incorrect error: %v", err)
+
+	revoked, err := suite.client.RevokeClaims(context.Background(), client.RevokeOptions{Claim: "client_claim"})
+	if !suite.NoError(err) {
+		return
+	}
+
+	suite.Equal(1, revoked)
+
+	info, err = suite.client.Info(context.Background(), common.ResolveOptions{User: "client_claim"})
+	if !suite.NoError(err) {
+		return
+	}
+
+	suite.Len(info.Claims, 0)
+}
+
+func (suite *ClientSuite) TestSend() {
+	conn := suite.connect("client_send")
+	if conn == nil {
+		return
+	}
+
+	defer conn.Close()
+
+	err := suite.client.Send(context.Background(), common.ResolveOptions{User: "client_send"}, client.MessageTypeText, []byte("Hello world!"))
+	if !suite.NoError(err) {
+		return
+	}
+
+	suite.Equal("Hello world!", suite.receive(conn))
+}
+
+func (suite *ClientSuite) TestChannels() {
+	conn := suite.connect("client_channel")
+	if conn == nil {
+		return
+	}
+
+	defer conn.Close()
+
+	err := suite.client.Subscribe(context.Background(), common.ResolveOptions{User: "client_channel"}, "client_channel", false)
+	if !suite.NoError(err) {
+		return
+	}
+
+	info, err := suite.client.Info(context.Background(), common.ResolveOptions{Channel: "client_channel"})
+	if !suite.NoError(err) {
+		return
+	}
+
+	if suite.Len(info.Connections, 1) {
+		suite.Equal("client_channel", info.Connections[0].User)
+		suite.Equal(suite.worker.Id(), info.Connections[0].Worker)
+		suite.Equal([]string{"client_channel"}, info.Connections[0].Channels)
+	}
+
+	err = suite.client.Send(context.Background(), common.ResolveOptions{Channel: "client_channel"}, client.MessageTypeText, []byte("Hello channel!"))
+	if !suite.NoError(err) {
+		return
+	}
+
+	suite.Equal("Hello channel!", suite.receive(conn))
+
+	err = suite.client.Unsubscribe(context.Background(), common.ResolveOptions{User: "client_channel"}, "client_channel", false)
+	if !suite.NoError(err) {
+		return
+	}
+
+	info, err = suite.client.Info(context.Background(), common.ResolveOptions{Channel: "client_channel"})
+	if !suite.NoError(err) {
+		return
+	}
+
+	suite.Len(info.Connections, 0)
+}
+
+func (suite *ClientSuite) TestDisconnect() {
+	conn := suite.connect("client_disconnect")
+	if conn == nil {
+		return
+	}
+
+	defer conn.Close()
+
+	err := suite.client.Disconnect(context.Background(), common.ResolveOptions{User: "client_disconnect"}, false)
+	if !suite.NoError(err) {
+		return
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = conn.ReadMessage()
+	suite.True(websocket.IsCloseError(err, websocket.CloseNormalClosure), "Incorrect close: %v", err)
+}
+
+func (suite *ClientSuite) TestMessageHook() {
+	conn := suite.connect("client_message_hook")
+	if conn == nil {
+		return
+	}
+
+	defer conn.Close()
+
+	err := conn.WriteMessage(websocket.TextMessage, []byte("Hello world!"))
+	if !suite.NoError(err) {
+		return
+	}
+
+	select {
+	case message := <-suite.messages:
+		suite.Equal("client_message_hook:Hello world!", message)
+	case <-time.After(time.Second):
+		suite.Fail("Message not received by hook")
+	}
+}
+
+/// Runs a second worker in the same process, receiving messages through the store
+func (suite *ClientSuite) TestSecondWorker() {
+	secondWorker := worker.NewServer(worker.ServerOptions{
+		Options: suite.options,
+		Store:   suite.dataStore,
+	})
+	secondServer := httptest.NewServer(secondWorker.Handler())
+	secondWorker.Start()
+
+	defer secondServer.Close()
+	defer secondWorker.Shutdown()
+
+	claim, err := suite.client.CreateClaim(context.Background(), client.ClaimOptions{
+		User: "client_second_worker",
+	})
+	if !suite.NoError(err) {
+		return
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(secondServer.URL, "http")+common.PathConnect+"?claim="+claim.Id, nil)
+	if !suite.NoError(err, "Error during connection") {
+		return
+	}
+
+	defer conn.Close()
+
+	time.Sleep(time.Millisecond * 10)
+
+	info, err := suite.client.Info(context.Background(), common.ResolveOptions{User: "client_second_worker"})
+	if !suite.NoError(err) || !suite.Len(info.Connections, 1) {
+		return
+	}
+
+	suite.Equal(secondWorker.Id(), info.Connections[0].Worker)
+
+	err = suite.client.Send(context.Background(), common.ResolveOptions{User: "client_second_worker"}, client.MessageTypeText, []byte("Hello world!"))
+	if !suite.NoError(err) {
+		return
+	}
+
+	suite.Equal("Hello world!", suite.receive(conn))
+}
+
+func (suite *ClientSuite) TestWorkersAndBroker() {
+	workers, err := suite.client.Workers(context.Background())
+	if !suite.NoError(err) {
+		return
+	}
+
+	if suite.Len(workers, 1) {
+		suite.Equal(suite.worker.Id(), workers[0].Id)
+		suite.Equal(common.WorkerStatusHealthy, workers[0].Status)
+		suite.Equal(suite.server.URL, workers[0].Url)
+	}
+
+	broker, err := suite.client.Broker(context.Background(), client.BrokerOptions{
+		ClaimOptions: client.ClaimOptions{
+			User:     "client_broker",
+			Duration: time.Minute,
+		},
+	})
+	if !suite.NoError(err) {
+		return
+	}
+
+	suite.Equal(suite.worker.Id(), broker.Worker.Id)
+	suite.Equal("client_broker", broker.Claim.User)
+	suite.Equal(suite.server.URL+common.PathConnect+"?claim="+broker.Claim.Id, broker.Url)
+}
+
+func (suite *ClientSuite) TestEvents() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := suite.client.Events(ctx, common.ResolveOptions{User: "client_events"})
+	if !suite.NoError(err) {
+		return
+	}
+
+	defer events.Close()
+
+	// Events from other users are filtered out
+	otherConn := suite.connect("client_events_other")
+	if otherConn == nil {
+		return
+	}
+
+	defer otherConn.Close()
+
+	conn := suite.connect("client_events")
+	if conn == nil {
+		return
+	}
+
+	defer conn.Close()
+
+	event, err := events.Next()
+	if !suite.NoError(err) {
+		return
+	}
+
+	suite.Equal(common.EventConnect, event.Type)
+	suite.Equal("client_events", event.User)
+	suite.Equal(suite.worker.Id(), event.Worker)
+}
+
+func (suite *ClientSuite) TestErrors() {
+	_, err := suite.client.CreateClaim(context.Background(), client.ClaimOptions{})
+	suite.True(errors.Is(err, client.ErrUserIdRequired), "Incorrect error: %v", err)
+
+	var apiError *client.Error
+	if suite.True(errors.As(err, &apiError)) {
+		suite.Equal(400, apiError.StatusCode)
+		suite.Equal(common.ErrorMessages[common.ErrorUserIdRequired], apiError.Message)
+		suite.NotEmpty(apiError.RequestId)
+	}
+
+	err = suite.client.Send(context.Background(), common.ResolveOptions{}, client.MessageTypeText, []byte{})
+	suite.True(errors.Is(err, client.ErrTarget), "Incorrect error: %v", err)
+
+	err = suite.client.Send(context.Background(), common.ResolveOptions{User: "client_errors"}, "invalid", []byte{})
+	suite.True(errors.Is(err, client.ErrInvalidMessageType), "Incorrect error: %v", err)
+
+	_, err = suite.client.RevokeClaims(context.Background(), client.RevokeOptions{})
+	suite.True(errors.Is(err, client.ErrTarget), "Incorrect error: %v", err)
+
+	unauthorizedClient := client.New(client.Options{
+		Url:   suite.server.URL,
+		Token: "invalid",
+	})
+
+	_, err = unauthorizedClient.Workers(context.Background())
+	suite.True(errors.Is(err, client.ErrInvalidAuthorization), "Incorrect error: %v", err)
+}
+
+func (suite *ClientSuite) TestConfigToken() {
+	analyticsClient := client.New(client.Options{
+		Url:   suite.server.URL,
+		Token: analyticsToken,
+	})
+
+	_, err := analyticsClient.Info(context.Background(), common.ResolveOptions{User: "client_config_token"})
+	suite.NoError(err)
+
+	err = analyticsClient.Disconnect(context.Background(), common.ResolveOptions{User: "client_config_token"}, false)
+	suite.True(errors.Is(err, client.ErrMissingScope), "Incorrect error: %v", err)
+
+	_, err = analyticsClient.Tokens(context.Background())
+	suite.True(errors.Is(err, client.ErrMissingScope), "Incorrect error: %v", err)
+}
+
+func (suite *ClientSuite) TestStoredToken() {
+	storedToken, err := suite.client.CreateToken(context.Background(), client.TokenOptions{
+		Name:         "client_stored_token",
+		Scopes:       []string{common.ScopeSend, common.ScopeInfo},
+		Channels:     []string{"client_stored_token"},
+		UserPrefixes: []string{"client_stored_token_"},
+	})
+	if !suite.NoError(err) {
+		return
+	}
+	suite.NotEmpty(storedToken.Token, "Token should have a secret")
+
+	_, err = suite.client.CreateToken(context.Background(), client.TokenOptions{
+		Name:   "client_stored_token",
+		Scopes: []string{common.ScopeInfo},
+	})
+	suite.True(errors.Is(err, client.ErrTokenNameAlreadyUsed), "Incorrect error: %v", err)
+
+	_, err = suite.client.CreateToken(context.Background(), client.TokenOptions{
+		Name:   "client_invalid_token",
+		Scopes: []string{"invalid"},
+	})
+	suite.True(errors.Is(err, client.ErrInvalidToken), "Incorrect error: %v", err)
+
+	tokens, err := suite.client.Tokens(context.Background())
+	if suite.NoError(err) && suite.Len(tokens, 1) {
+		suite.Equal("client_stored_token", tokens[0].Name)
+		suite.Empty(tokens[0].Token, "Listed tokens should not have their secret")
+	}
+
+	storedClient := client.New(client.Options{
+		Url:   suite.server.URL,
+		Token: storedToken.Token,
+	})
+
+	conn := suite.connect("client_stored_token_user")
+	defer conn.Close()
+
+	err = storedClient.Send(context.Background(), common.ResolveOptions{User: "client_stored_token_user"}, client.MessageTypeText, []byte("Hello token!"))
+	if suite.NoError(err) {
+		suite.Equal("Hello token!", suite.receive(conn))
+	}
+
+	_, err = storedClient.Info(context.Background(), common.ResolveOptions{Channel: "client_stored_token"})
+	suite.NoError(err)
+
+	_, err = storedClient.Info(context.Background(), common.ResolveOptions{User: "client_other_user"})
+	suite.True(errors.Is(err, client.ErrTargetNotAllowed), "Incorrect error: %v", err)
+
+	_, err = storedClient.Info(context.Background(), common.ResolveOptions{Channel: "client_other_channel"})
+	suite.True(errors.Is(err, client.ErrTargetNotAllowed), "Incorrect error: %v", err)
+
+	_, err = storedClient.Info(context.Background(), common.ResolveOptions{Connection: "client_stored_token"})
+	suite.True(errors.Is(err, client.ErrTargetNotAllowed), "Incorrect error: %v", err)
+
+	_, err = storedClient.CreateClaim(context.Background(), client.ClaimOptions{User: "client_stored_token_user"})
+	suite.True(errors.Is(err, client.ErrMissingScope), "Incorrect error: %v", err)
+
+	err = suite.client.RevokeToken(context.Background(), "client_stored_token")
+	suite.NoError(err)
+
+	err = suite.client.RevokeToken(context.Background(), "client_stored_token")
+	suite.True(errors.Is(err, client.ErrMissingToken), "Incorrect error: %v", err)
+
+	_, err = storedClient.Info(context.Background(), common.ResolveOptions{Channel: "client_stored_token"})
+	suite.True(errors.Is(err, client.ErrInvalidAuthorization), "Incorrect error: %v", err)
+}
+
+func (suite *ClientSuite) TestRetry() {
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(503)
+			_, _ = writer.Write([]byte(`{"success":false,"errorCode":"NO_WORKER_AVAILABLE","error":"No worker is available to connect to"}`))
+			return
+		}
+
+		_, _ = writer.Write([]byte(`{"success":true,"workers":[]}`))
+	}))
+	defer server.Close()
+
+	retryingClient := client.New(client.Options{
+		Url:             server.URL,
+		MaxRetries:      2,
+		RetryMinBackoff: time.Millisecond,
+	})
+
+	_, err := retryingClient.Workers(context.Background())
+	suite.NoError(err)
+	suite.Equal(int32(3), atomic.LoadInt32(&attempts))
+
+	atomic.StoreInt32(&attempts, 0)
+
+	_, err = client.New(client.Options{Url: server.URL}).Workers(context.Background())
+	suite.True(errors.Is(err, client.ErrNoWorkerAvailable), "Incorrect error: %v", err)
+	suite.Equal(int32(1), atomic.LoadInt32(&attempts), "Should not retry by default")
+}
+
+func (suite *ClientSuite) TestRetryNetworkError() {
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 2 {
+			// Close the connection without a response
+			conn, _, err := writer.(http.Hijacker).Hijack()
+			if err == nil {
+				_ = conn.Close()
+			}
+			return
+		}
+
+		_, _ = writer.Write([]byte(`{"success":true,"workers":[]}`))
+	}))
+	defer server.Close()
+
+	retryingClient := client.New(client.Options{
+		Url:             server.URL,
+		MaxRetries:      2,
+		RetryMinBackoff: time.Millisecond,
+	})
+
+	_, err := retryingClient.Workers(context.Background())
+	suite.NoError(err)
+	suite.Equal(int32(2), atomic.LoadInt32(&attempts))
+}
+
+func (suite *ClientSuite) TestNoRetryAfterSuccess() {
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+
+		// Successful response that can't be decoded (the message was sent)
+		_, _ = writer.Write([]byte(`{"success":`))
+	}))
+	defer server.Close()
+
+	retryingClient := client.New(client.Options{
+		Url:             server.URL,
+		MaxRetries:      2,
+		RetryMinBackoff: time.Millisecond,
+	})
+
+	_, err := retryingClient.Workers(context.Background())
+	suite.Error(err, "Invalid response should fail")
+	suite.Equal(int32(1), atomic.LoadInt32(&attempts), "Should not retry after a successful response")
+}
+
+func (suite *ClientSuite) TestTimeout() {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		select {
+		case <-request.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	timeoutClient := client.New(client.Options{
+		Url:     server.URL,
+		Timeout: time.Millisecond * 50,
+	})
+
+	start := time.Now()
+	_, err := timeoutClient.Workers(context.Background())
+	suite.Error(err)
+	suite.True(errors.Is(err, context.DeadlineExceeded), "Incorrect error: %v", err)
+	suite.Less(int64(time.Since(start)), int64(time.Millisecond*500))
+}
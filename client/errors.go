@@ -0,0 +1,99 @@
+package client
+
+import (
+	"fmt"
+	"github.com/Cretezy/dSock/common"
+	"time"
+)
+
+/// Error returned by the API. Use errors.Is with the Err variables to check the error code
+type Error struct {
+	/// HTTP status code
+	StatusCode int
+	/// Error code (from common.ErrorMessages)
+	Code string
+	/// Error message
+	Message string
+	/// Request ID, to find the request in the API's logs
+	RequestId string
+	/// How long to wait before retrying, if the API responded with a Retry-After header
+	RetryAfter time.Duration
+}
+
+func (err *Error) Error() string {
+	message := fmt.Sprintf("dsock: %s (%s, HTTP %d)", err.Message, err.Code, err.StatusCode)
+	if err.RequestId != "" {
+		message += ", request ID " + err.RequestId
+	}
+
+	return message
+}
+
+/// Matches errors with the same code
+func (err *Error) Is(target error) bool {
+	targetError, ok := target.(*Error)
+
+	return ok && targetError.Code == err.Code
+}
+
+/// Errors by code, for all codes the API can respond with
+var codeErrors = make(map[string]*Error)
+
+func newCodeError(code string) *Error {
+	err := &Error{
+		Code:    code,
+		Message: common.ErrorMessages[code],
+	}
+
+	codeErrors[code] = err
+
+	return err
+}
+
+/// Errors for each error code, to be used with errors.Is
+var (
+	ErrUserIdRequired        = newCodeError(common.ErrorUserIdRequired)
+	ErrInvalidExpiration     = newCodeError(common.ErrorInvalidExpiration)
+	ErrNegativeExpiration    = newCodeError(common.ErrorNegativeExpiration)
+	ErrInvalidDuration       = newCodeError(common.ErrorInvalidDuration)
+	ErrNegativeDuration      = newCodeError(common.ErrorNegativeDuration)
+	ErrGettingConnection     = newCodeError(common.ErrorGettingConnection)
+	ErrGettingUser           = newCodeError(common.ErrorGettingUser)
+	ErrGettingChannel        = newCodeError(common.ErrorGettingChannel)
+	ErrTarget                = newCodeError(common.ErrorTarget)
+	ErrInvalidAuthorization  = newCodeError(common.ErrorInvalidAuthorization)
+	ErrMissingAuthentication = newCodeError(common.ErrorMissingAuthentication)
+	ErrInvalidJwt            = newCodeError(common.ErrorInvalidJwt)
+	ErrClaimIdAlreadyUsed    = newCodeError(common.ErrorClaimIdAlreadyUsed)
+	ErrCheckingClaim         = newCodeError(common.ErrorCheckingClaim)
+	ErrGettingClaim          = newCodeError(common.ErrorGettingClaim)
+	ErrCreatingClaim         = newCodeError(common.ErrorCreatingClaim)
+	ErrDeletingClaim         = newCodeError(common.ErrorDeletingClaim)
+	ErrMissingClaim          = newCodeError(common.ErrorMissingClaim)
+	ErrExpiredClaim          = newCodeError(common.ErrorExpiredClaim)
+	ErrReadingMessage        = newCodeError(common.ErrorReadingMessage)
+	ErrMarshallingMessage    = newCodeError(common.ErrorMarshallingMessage)
+	ErrInvalidMessageType    = newCodeError(common.ErrorInvalidMessageType)
+	ErrBindingQueryParams    = newCodeError(common.ErrorBindingQueryParams)
+	ErrGettingWorker         = newCodeError(common.ErrorGettingWorker)
+	ErrReachingWorker        = newCodeError(common.ErrorReachingWorker)
+	ErrDeliveringMessage     = newCodeError(common.ErrorDeliveringMessage)
+	ErrInvalidContentType    = newCodeError(common.ErrorInvalidContentType)
+	ErrReadingBody           = newCodeError(common.ErrorReadingBody)
+	ErrWorkerDraining        = newCodeError(common.ErrorWorkerDraining)
+	ErrConnectionLimit       = newCodeError(common.ErrorConnectionLimit)
+	ErrWorkerAtCapacity      = newCodeError(common.ErrorWorkerAtCapacity)
+	ErrNoWorkerAvailable     = newCodeError(common.ErrorNoWorkerAvailable)
+	ErrRateLimited           = newCodeError(common.ErrorRateLimited)
+	ErrSubscribingEvents     = newCodeError(common.ErrorSubscribingEvents)
+	ErrMissingScope          = newCodeError(common.ErrorMissingScope)
+	ErrTargetNotAllowed      = newCodeError(common.ErrorTargetNotAllowed)
+	ErrGettingToken          = newCodeError(common.ErrorGettingToken)
+	ErrInvalidToken          = newCodeError(common.ErrorInvalidToken)
+	ErrTokenNameAlreadyUsed  = newCodeError(common.ErrorTokenNameAlreadyUsed)
+	ErrCreatingToken         = newCodeError(common.ErrorCreatingToken)
+	ErrDeletingToken         = newCodeError(common.ErrorDeletingToken)
+	ErrMissingToken          = newCodeError(common.ErrorMissingToken)
+	ErrInvalidSignature      = newCodeError(common.ErrorInvalidSignature)
+	ErrBodyTooLarge          = newCodeError(common.ErrorBodyTooLarge)
+)
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"errors"
+	"github.com/Cretezy/dSock/common"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type ErrorSuite struct {
+	suite.Suite
+}
+
+func TestErrorSuite(t *testing.T) {
+	suite.Run(t, new(ErrorSuite))
+}
+
+func (suite *ErrorSuite) TestAllCodes() {
+	for code := range common.ErrorMessages {
+		suite.Containsf(codeErrors, code, "Missing error for code %s", code)
+	}
+
+	suite.Len(codeErrors, len(common.ErrorMessages))
+}
+
+func (suite *ErrorSuite) TestIs() {
+	err := error(&Error{
+		StatusCode: 429,
+		Code:       common.ErrorRateLimited,
+		Message:    "Too many requests, try again later",
+		RequestId:  "request",
+	})
+
+	suite.True(errors.Is(err, ErrRateLimited))
+	suite.False(errors.Is(err, ErrTarget))
+}
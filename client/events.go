@@ -0,0 +1,89 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Cretezy/dSock/common"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+/// Stream of connection events. Must be closed
+type EventStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+/// Streams connection events (published by workers with publish_events), optionally filtered by target.
+/// The stream lasts until closed, or until the context is done
+func (client *Client) Events(ctx context.Context, target common.ResolveOptions) (*EventStream, error) {
+	request, err := client.newRequest(ctx, "GET", common.PathEvents, targetQuery(target), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Accept", "text/event-stream")
+
+	resp, err := client.options.HttpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		return nil, parseError(resp, body)
+	}
+
+	return &EventStream{
+		body:    resp.Body,
+		scanner: bufio.NewScanner(resp.Body),
+	}, nil
+}
+
+/// Waits for the next event. Returns io.EOF if the API closed the stream
+func (stream *EventStream) Next() (*common.Event, error) {
+	// Server-sent events: "data" lines are dispatched on empty lines. Other fields and comments are ignored
+	var data strings.Builder
+
+	for stream.scanner.Scan() {
+		line := stream.scanner.Text()
+
+		if strings.HasPrefix(line, "data:") {
+			if data.Len() != 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			continue
+		}
+
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+
+		event := &common.Event{}
+
+		err := json.Unmarshal([]byte(data.String()), event)
+		if err != nil {
+			return nil, fmt.Errorf("dsock: could not parse event: %w", err)
+		}
+
+		return event, nil
+	}
+
+	err := stream.scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+func (stream *EventStream) Close() error {
+	return stream.body.Close()
+}
@@ -0,0 +1,176 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type MessageType string
+
+const (
+	MessageTypeText   MessageType = "text"
+	MessageTypeBinary MessageType = "binary"
+)
+
+type ClaimOptions struct {
+	/// Claim ID. Generated if empty
+	Id      string
+	User    string
+	Session string
+	/// Channels the connection is subscribed to when connecting
+	Channels []string
+	/// Expiration time of the claim. Takes precedence over Duration
+	Expiration time.Time
+	/// Duration of the claim (rounded to seconds). Defaults to 1 minute if neither Expiration or Duration is set
+	Duration time.Duration
+}
+
+type BrokerOptions struct {
+	ClaimOptions
+	/// Preferred region of the worker
+	Region string
+}
+
+type TokenOptions struct {
+	Name string
+	/// Scopes (common.ScopeSend, etc.) the token can use
+	Scopes []string
+	/// Channels the token can target. Empty to not restrict channels (unless UserPrefixes is set)
+	Channels []string
+	/// Prefixes of users the token can target. Empty to not restrict users (unless Channels is set)
+	UserPrefixes []string
+}
+
+type RevokeOptions struct {
+	/// Claim ID to revoke
+	Claim   string
+	User    string
+	Session string
+	Channel string
+}
+
+type Claim struct {
+	Id         string    `json:"id"`
+	Expiration time.Time `json:"expiration"`
+	User       string    `json:"user"`
+	Session    string    `json:"session,omitempty"`
+	Channels   []string  `json:"channels"`
+}
+
+func (claim *Claim) UnmarshalJSON(data []byte) error {
+	// Times are Unix seconds in responses
+	type claimFields Claim
+	response := struct {
+		*claimFields
+		Expiration int64 `json:"expiration"`
+	}{claimFields: (*claimFields)(claim)}
+
+	err := json.Unmarshal(data, &response)
+	if err != nil {
+		return err
+	}
+
+	claim.Expiration = time.Unix(response.Expiration, 0)
+
+	return nil
+}
+
+type Connection struct {
+	Id string `json:"id"`
+	/// Worker holding the connection
+	Worker   string    `json:"worker"`
+	LastPing time.Time `json:"lastPing"`
+	User     string    `json:"user"`
+	Session  string    `json:"session,omitempty"`
+	Channels []string  `json:"channels"`
+}
+
+func (connection *Connection) UnmarshalJSON(data []byte) error {
+	type connectionFields Connection
+	response := struct {
+		*connectionFields
+		LastPing int64 `json:"lastPing"`
+	}{connectionFields: (*connectionFields)(connection)}
+
+	err := json.Unmarshal(data, &response)
+	if err != nil {
+		return err
+	}
+
+	connection.LastPing = time.Unix(response.LastPing, 0)
+
+	return nil
+}
+
+/// Open connections and non-expired claims of a target
+type Info struct {
+	Connections []Connection `json:"connections"`
+	Claims      []Claim      `json:"claims"`
+}
+
+type Worker struct {
+	Id string `json:"id"`
+	/// healthy or degraded
+	Status   string    `json:"status"`
+	LastPing time.Time `json:"lastPing"`
+	/// Hostname + port of the worker, when using direct messaging
+	Ip string `json:"ip,omitempty"`
+	/// URL (with the scheme) the API sends direct messages to, when using direct messaging
+	DirectUrl string `json:"directUrl,omitempty"`
+	/// URL clients connect to (without the path)
+	Url    string     `json:"url,omitempty"`
+	Region string     `json:"region,omitempty"`
+	Load   WorkerLoad `json:"load"`
+}
+
+func (worker *Worker) UnmarshalJSON(data []byte) error {
+	type workerFields Worker
+	response := struct {
+		*workerFields
+		LastPing int64 `json:"lastPing"`
+	}{workerFields: (*workerFields)(worker)}
+
+	err := json.Unmarshal(data, &response)
+	if err != nil {
+		return err
+	}
+
+	worker.LastPing = time.Unix(response.LastPing, 0)
+
+	return nil
+}
+
+type WorkerLoad struct {
+	Connections int `json:"connections"`
+	Goroutines  int `json:"goroutines"`
+	/// Memory obtained from the OS, in bytes
+	Memory uint64 `json:"memory"`
+	/// CPU usage, in percent of all cores
+	Cpu        float64 `json:"cpu"`
+	QueueDepth int     `json:"queueDepth"`
+	AtCapacity bool    `json:"atCapacity"`
+}
+
+/// Worker assigned by the connect broker, with a claim to connect with
+type Broker struct {
+	/// URL to connect to (including the claim)
+	Url    string       `json:"url"`
+	Worker BrokerWorker `json:"worker"`
+	Claim  Claim        `json:"claim"`
+}
+
+type BrokerWorker struct {
+	Id     string `json:"id"`
+	Url    string `json:"url"`
+	Region string `json:"region,omitempty"`
+}
+
+/// API token stored in the store
+type Token struct {
+	Name string `json:"name"`
+	/// Secret to authenticate with. Only returned when creating the token
+	Token        string   `json:"token,omitempty"`
+	Scopes       []string `json:"scopes"`
+	Channels     []string `json:"channels,omitempty"`
+	UserPrefixes []string `json:"userPrefixes,omitempty"`
+}
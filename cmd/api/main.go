@@ -2,11 +2,9 @@ package main
 
 import (
 	"context"
+	"github.com/Cretezy/dSock/api"
 	"github.com/Cretezy/dSock/common"
-	"github.com/Cretezy/dSock/common/protos"
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v7"
-	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"net/http"
 	"os"
@@ -15,10 +13,6 @@ import (
 	"time"
 )
 
-var apiId = uuid.New().String()
-
-var redisClient *redis.Client
-
 var options *common.DSockOptions
 var logger *zap.Logger
 
@@ -32,11 +26,7 @@ func init() {
 		panic(err)
 	}
 
-	if options.Debug {
-		logger, err = zap.NewDevelopment()
-	} else {
-		logger, err = zap.NewProduction()
-	}
+	logger, err = common.NewLogger(options)
 
 	if err != nil {
 		println("Could not create logger")
@@ -45,21 +35,24 @@ func init() {
 }
 
 func main() {
+	server := api.NewServer(api.ServerOptions{
+		Options: options,
+		Logger:  logger,
+	})
+
 	logger.Info("Starting dSock API",
 		zap.String("version", common.DSockVersion),
-		zap.String("apiId", apiId),
+		zap.String("apiId", server.Id()),
 		zap.Int("port", options.Port),
 		zap.String("DEPRECATED.address", options.Address),
 	)
 
-	// Setup application
-	redisClient = redis.NewClient(options.RedisOptions)
-
-	_, err := redisClient.Ping().Result()
+	shutdownTracing, err := common.SetupTracing(options, "dsock-api", logger)
 	if err != nil {
-		logger.Error("Could not connect to Redis (ping)",
+		logger.Error("Could not setup tracing",
 			zap.Error(err),
 		)
+		shutdownTracing = func() {}
 	}
 
 	if options.Debug {
@@ -68,29 +61,31 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	router := common.NewGinEngine(logger, options)
-	router.Use(common.RequestIdMiddleware)
-	router.Use(common.TokenMiddleware(options.Token))
-
-	router.Any(common.PathPing, common.PingHandler)
-	router.POST(common.PathSend, sendHandler)
-	router.POST(common.PathDisconnect, disconnectHandler)
-	router.POST(common.PathClaim, createClaimHandler)
-	router.GET(common.PathInfo, infoHandler)
-	router.POST(common.PathChannelSubscribe, getChannelHandler(protos.ChannelAction_SUBSCRIBE))
-	router.POST(common.PathChannelUnsubscribe, getChannelHandler(protos.ChannelAction_UNSUBSCRIBE))
+	common.ServeMetrics(options, logger)
 
 	// Start HTTP server
 	srv := &http.Server{
 		Addr:    options.Address,
-		Handler: router,
+		Handler: server.Handler(),
 	}
 
+	if options.Tls.CertFile != "" {
+		srv.TLSConfig, err = common.NewServerTls(options.Tls, logger)
+		if err != nil {
+			logger.Error("Could not load TLS certificate",
+				zap.Error(err),
+			)
+			panic(err)
+		}
+	}
+
+	server.Start()
+
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := common.ListenAndServe(srv); err != nil && err != http.ErrServerClosed {
 			logger.Error("Failed listening",
 				zap.Error(err),
-				zap.String("apiId", apiId),
+				zap.String("apiId", server.Id()),
 			)
 			options.QuitChannel <- struct{}{}
 		}
@@ -98,6 +93,7 @@ func main() {
 
 	logger.Info("Listening",
 		zap.String("address", options.Address),
+		zap.Bool("tls", srv.TLSConfig != nil),
 	)
 
 	signalQuit := make(chan os.Signal, 1)
@@ -110,11 +106,9 @@ func main() {
 	case <-signalQuit:
 	}
 
-	signalQuit = nil
-
 	// Server shutdown
 	logger.Info("Shutting down",
-		zap.String("apiId", apiId),
+		zap.String("apiId", server.Id()),
 	)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -122,12 +116,15 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		logger.Error("Error during server shutdown",
 			zap.Error(err),
-			zap.String("apiId", apiId),
+			zap.String("apiId", server.Id()),
 		)
 	}
 
+	server.Shutdown()
+	shutdownTracing()
+
 	logger.Info("Stopped",
-		zap.String("apiId", apiId),
+		zap.String("apiId", server.Id()),
 	)
 	_ = logger.Sync()
 }
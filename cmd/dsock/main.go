@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"github.com/Cretezy/dSock/api"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/common/store"
+	"github.com/Cretezy/dSock/worker"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var options *common.DSockOptions
+var logger *zap.Logger
+
+func init() {
+	var err error
+
+	// Worker options are a superset of the API options
+	options, err = common.GetOptions(true)
+
+	if err != nil {
+		println("Could not get options. Make sure your config is valid!")
+		panic(err)
+	}
+
+	logger, err = common.NewLogger(options)
+
+	if err != nil {
+		println("Could not create logger")
+		panic(err)
+	}
+}
+
+/// Runs the API and a worker in a single process, sharing the same port and store
+func main() {
+	// Setup application
+	dataStore := store.New(options, logger)
+
+	apiServer := api.NewServer(api.ServerOptions{
+		Options: options,
+		Logger:  logger,
+		Store:   dataStore,
+	})
+	workerServer := worker.NewServer(worker.ServerOptions{
+		Options: options,
+		Logger:  logger,
+		Store:   dataStore,
+	})
+
+	// Messages for the local worker skip the messaging method
+	apiServer.SetLocalWorker(workerServer.Id(), workerServer.Deliver)
+
+	logger.Info("Starting dSock (standalone)",
+		zap.String("version", common.DSockVersion),
+		zap.String("apiId", apiServer.Id()),
+		zap.String("workerId", workerServer.Id()),
+		zap.Int("port", options.Port),
+		zap.String("DEPRECATED.address", options.Address),
+	)
+
+	shutdownTracing, err := common.SetupTracing(options, "dsock", logger)
+	if err != nil {
+		logger.Error("Could not setup tracing",
+			zap.Error(err),
+		)
+		shutdownTracing = func() {}
+	}
+
+	if options.Debug {
+		gin.SetMode(gin.DebugMode)
+	} else {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	router := common.NewGinEngine(logger, options)
+	router.Use(common.RequestIdMiddleware)
+
+	router.Any(common.PathPing, common.PingHandler)
+	common.RegisterMetricsRoute(router, options)
+	common.ServeMetrics(options, logger)
+	workerServer.RegisterRoutes(router)
+
+	// Only the API routes are protected by the token
+	apiServer.RegisterRoutes(router.Group("", apiServer.TokenMiddleware()))
+
+	// Start HTTP server
+	srv := &http.Server{
+		Addr:    options.Address,
+		Handler: router,
+	}
+
+	if options.Tls.CertFile != "" {
+		srv.TLSConfig, err = common.NewServerTls(options.Tls, logger)
+		if err != nil {
+			logger.Error("Could not load TLS certificate",
+				zap.Error(err),
+			)
+			panic(err)
+		}
+	}
+
+	apiServer.Start()
+	workerServer.Start()
+
+	go func() {
+		if err := common.ListenAndServe(srv); err != nil && err != http.ErrServerClosed {
+			logger.Error("Failed listening",
+				zap.Error(err),
+				zap.String("workerId", workerServer.Id()),
+			)
+			options.QuitChannel <- struct{}{}
+		}
+	}()
+
+	logger.Info("Listening",
+		zap.String("address", options.Address),
+		zap.Bool("tls", srv.TLSConfig != nil),
+		zap.String("workerId", workerServer.Id()),
+	)
+
+	directSrv := workerServer.ServeDirect()
+
+	signalQuit := make(chan os.Signal, 1)
+
+	// Listen for signal or message in quit channel
+	signal.Notify(signalQuit, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case <-options.QuitChannel:
+	case receivedSignal := <-signalQuit:
+		if receivedSignal == syscall.SIGTERM {
+			// Gradually close connections (asking clients to reconnect) before shutting down
+			workerServer.Drain()
+		}
+	}
+
+	// Server shutdown
+	logger.Info("Shutting down",
+		zap.String("apiId", apiServer.Id()),
+		zap.String("workerId", workerServer.Id()),
+	)
+
+	workerServer.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error("Error during server shutdown",
+			zap.Error(err),
+			zap.String("workerId", workerServer.Id()),
+		)
+	}
+
+	if directSrv != nil {
+		if err := directSrv.Shutdown(ctx); err != nil {
+			logger.Error("Error during direct server shutdown",
+				zap.Error(err),
+				zap.String("workerId", workerServer.Id()),
+			)
+		}
+	}
+
+	_ = dataStore.Close()
+	shutdownTracing()
+
+	logger.Info("Stopped",
+		zap.String("apiId", apiServer.Id()),
+		zap.String("workerId", workerServer.Id()),
+	)
+	_ = logger.Sync()
+}
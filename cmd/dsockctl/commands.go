@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func formatTime(value time.Time) string {
+	return value.Format(time.RFC3339)
+}
+
+/// Prints the success message, or the success response with JSON output
+func (ctl *ctl) printSuccess(message string) error {
+	if ctl.output == outputJson {
+		return printJson(map[string]interface{}{
+			"success": true,
+		})
+	}
+
+	fmt.Println(message)
+	return nil
+}
+
+func sendCommand(ctl *ctl, args []string) error {
+	flags := flag.NewFlagSet("send", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dsockctl send [flags] [message]")
+		fmt.Fprintln(flags.Output(), "Sends the message from the arguments, the file, or stdin")
+		flags.PrintDefaults()
+	}
+	target := targetFlags(flags)
+	messageType := flags.String("type", string(client.MessageTypeText), "Message type: text or binary")
+	file := flags.String("file", "", "File to send the contents of (- for stdin)")
+	_ = flags.Parse(args)
+
+	err := requireTarget(target)
+	if err != nil {
+		return err
+	}
+
+	var message []byte
+
+	if flags.NArg() != 0 {
+		if *file != "" {
+			return errors.New("can not send both a message and a file")
+		}
+
+		message = []byte(strings.Join(flags.Args(), " "))
+	} else if *file != "" && *file != "-" {
+		message, err = ioutil.ReadFile(*file)
+	} else {
+		message, err = ioutil.ReadAll(os.Stdin)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = ctl.client.Send(context.Background(), *target, client.MessageType(*messageType), message)
+	if err != nil {
+		return err
+	}
+
+	return ctl.printSuccess("Sent message")
+}
+
+/// Gets the connections & claims of the target
+func (ctl *ctl) info(name string, args []string) (*client.Info, error) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	target := targetFlags(flags)
+	_ = flags.Parse(args)
+
+	err := requireTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	return ctl.client.Info(context.Background(), *target)
+}
+
+func connectionsCommand(ctl *ctl, args []string) error {
+	info, err := ctl.info("connections", args)
+	if err != nil {
+		return err
+	}
+
+	if ctl.output == outputJson {
+		return printJson(info.Connections)
+	}
+
+	table := newTable("ID", "USER", "SESSION", "CHANNELS", "WORKER", "LAST PING")
+	for _, connection := range info.Connections {
+		table.Row(
+			connection.Id,
+			connection.User,
+			connection.Session,
+			strings.Join(connection.Channels, ","),
+			connection.Worker,
+			formatTime(connection.LastPing),
+		)
+	}
+
+	return table.Flush()
+}
+
+func claimsCommand(ctl *ctl, args []string) error {
+	info, err := ctl.info("claims", args)
+	if err != nil {
+		return err
+	}
+
+	if ctl.output == outputJson {
+		return printJson(info.Claims)
+	}
+
+	return printClaims(info.Claims...)
+}
+
+func printClaims(claims ...client.Claim) error {
+	table := newTable("ID", "USER", "SESSION", "CHANNELS", "EXPIRATION")
+	for _, claim := range claims {
+		table.Row(
+			claim.Id,
+			claim.User,
+			claim.Session,
+			strings.Join(claim.Channels, ","),
+			formatTime(claim.Expiration),
+		)
+	}
+
+	return table.Flush()
+}
+
+func workersCommand(ctl *ctl, args []string) error {
+	flags := flag.NewFlagSet("workers", flag.ExitOnError)
+	_ = flags.Parse(args)
+
+	workers, err := ctl.client.Workers(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if ctl.output == outputJson {
+		return printJson(workers)
+	}
+
+	table := newTable("ID", "STATUS", "REGION", "CONNECTIONS", "CPU", "MEMORY", "QUEUE", "AT CAPACITY", "URL", "LAST PING")
+	for _, worker := range workers {
+		workerUrl := worker.Url
+		if workerUrl == "" {
+			workerUrl = worker.DirectUrl
+		}
+		if workerUrl == "" {
+			workerUrl = worker.Ip
+		}
+
+		table.Row(
+			worker.Id,
+			worker.Status,
+			worker.Region,
+			strconv.Itoa(worker.Load.Connections),
+			strconv.FormatFloat(worker.Load.Cpu, 'f', 2, 64)+"%",
+			strconv.FormatUint(worker.Load.Memory/1024/1024, 10)+"MB",
+			strconv.Itoa(worker.Load.QueueDepth),
+			strconv.FormatBool(worker.Load.AtCapacity),
+			workerUrl,
+			formatTime(worker.LastPing),
+		)
+	}
+
+	return table.Flush()
+}
+
+func claimCommand(ctl *ctl, args []string) error {
+	flags := flag.NewFlagSet("claim", flag.ExitOnError)
+	id := flags.String("id", "", "Claim ID (generated if empty)")
+	user := flags.String("user", "", "User ID (required)")
+	session := flags.String("session", "", "User session")
+	channels := flags.String("channels", "", "Channels to subscribe to, comma separated")
+	duration := flags.Int("duration", 0, "Duration of the claim, in seconds")
+	expiration := flags.Int64("expiration", 0, "Expiration time of the claim (Unix time)")
+	_ = flags.Parse(args)
+
+	if *user == "" {
+		return errors.New("a user is required (-user)")
+	}
+
+	claimOptions := client.ClaimOptions{
+		Id:       *id,
+		User:     *user,
+		Session:  *session,
+		Channels: common.RemoveEmpty(strings.Split(*channels, ",")),
+		Duration: time.Duration(*duration) * time.Second,
+	}
+	if *expiration != 0 {
+		claimOptions.Expiration = time.Unix(*expiration, 0)
+	}
+
+	claim, err := ctl.client.CreateClaim(context.Background(), claimOptions)
+	if err != nil {
+		return err
+	}
+
+	if ctl.output == outputJson {
+		return printJson(claim)
+	}
+
+	return printClaims(*claim)
+}
+
+func revokeCommand(ctl *ctl, args []string) error {
+	flags := flag.NewFlagSet("revoke", flag.ExitOnError)
+	revokeOptions := client.RevokeOptions{}
+	flags.StringVar(&revokeOptions.Claim, "claim", "", "Claim ID to revoke")
+	flags.StringVar(&revokeOptions.User, "user", "", "Revoke the user's claims")
+	flags.StringVar(&revokeOptions.Session, "session", "", "Revoke the user session's claims (with user)")
+	flags.StringVar(&revokeOptions.Channel, "channel", "", "Revoke the claims subscribing to the channel")
+	_ = flags.Parse(args)
+
+	if revokeOptions.Claim == "" && revokeOptions.User == "" && revokeOptions.Channel == "" {
+		return errors.New("a claim or target is required (-claim, -user or -channel)")
+	}
+
+	revoked, err := ctl.client.RevokeClaims(context.Background(), revokeOptions)
+	if err != nil {
+		return err
+	}
+
+	if ctl.output == outputJson {
+		return printJson(map[string]interface{}{
+			"success": true,
+			"claims":  revoked,
+		})
+	}
+
+	fmt.Printf("Revoked %d claim(s)\n", revoked)
+	return nil
+}
+
+/// Creates the subscribe or unsubscribe command
+func channelCommand(subscribe bool) func(ctl *ctl, args []string) error {
+	name := "unsubscribe"
+	if subscribe {
+		name = "subscribe"
+	}
+
+	return func(ctl *ctl, args []string) error {
+		flags := flag.NewFlagSet(name, flag.ExitOnError)
+		flags.Usage = func() {
+			fmt.Fprintf(flags.Output(), "Usage: dsockctl %s [flags] <channel>\n", name)
+			flags.PrintDefaults()
+		}
+		target := targetFlags(flags)
+		ignoreClaims := flags.Bool("ignore-claims", false, "Don't add the channel to (or remove it from) the target's claims")
+		_ = flags.Parse(args)
+
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return errors.New("a channel is required")
+		}
+
+		err := requireTarget(target)
+		if err != nil {
+			return err
+		}
+
+		channel := flags.Arg(0)
+
+		if subscribe {
+			err = ctl.client.Subscribe(context.Background(), *target, channel, *ignoreClaims)
+			if err != nil {
+				return err
+			}
+
+			return ctl.printSuccess("Subscribed to " + channel)
+		}
+
+		err = ctl.client.Unsubscribe(context.Background(), *target, channel, *ignoreClaims)
+		if err != nil {
+			return err
+		}
+
+		return ctl.printSuccess("Unsubscribed from " + channel)
+	}
+}
+
+func disconnectCommand(ctl *ctl, args []string) error {
+	flags := flag.NewFlagSet("disconnect", flag.ExitOnError)
+	target := targetFlags(flags)
+	keepClaims := flags.Bool("keep-claims", false, "Keep the target's claims, allowing them to reconnect")
+	_ = flags.Parse(args)
+
+	err := requireTarget(target)
+	if err != nil {
+		return err
+	}
+
+	err = ctl.client.Disconnect(context.Background(), *target, *keepClaims)
+	if err != nil {
+		return err
+	}
+
+	return ctl.printSuccess("Disconnected")
+}
+
+func tokensCommand(ctl *ctl, args []string) error {
+	flags := flag.NewFlagSet("tokens", flag.ExitOnError)
+	_ = flags.Parse(args)
+
+	tokens, err := ctl.client.Tokens(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if ctl.output == outputJson {
+		return printJson(tokens)
+	}
+
+	return printTokens(tokens...)
+}
+
+func printTokens(tokens ...client.Token) error {
+	table := newTable("NAME", "SCOPES", "CHANNELS", "USER PREFIXES")
+	for _, token := range tokens {
+		table.Row(
+			token.Name,
+			strings.Join(token.Scopes, ","),
+			strings.Join(token.Channels, ","),
+			strings.Join(token.UserPrefixes, ","),
+		)
+	}
+
+	return table.Flush()
+}
+
+func tokenCommand(ctl *ctl, args []string) error {
+	flags := flag.NewFlagSet("token", flag.ExitOnError)
+	name := flags.String("name", "", "Token name (required)")
+	scopes := flags.String("scopes", "", "Scopes (send, claim, info, disconnect and channel), comma separated (required)")
+	channels := flags.String("channels", "", "Channels the token can target, comma separated")
+	userPrefixes := flags.String("user-prefixes", "", "Prefixes of users the token can target, comma separated")
+	_ = flags.Parse(args)
+
+	if *name == "" || *scopes == "" {
+		return errors.New("a name and scopes are required (-name and -scopes)")
+	}
+
+	token, err := ctl.client.CreateToken(context.Background(), client.TokenOptions{
+		Name:         *name,
+		Scopes:       common.RemoveEmpty(strings.Split(*scopes, ",")),
+		Channels:     common.RemoveEmpty(strings.Split(*channels, ",")),
+		UserPrefixes: common.RemoveEmpty(strings.Split(*userPrefixes, ",")),
+	})
+	if err != nil {
+		return err
+	}
+
+	if ctl.output == outputJson {
+		return printJson(token)
+	}
+
+	err = printTokens(*token)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nToken (only shown once): %s\n", token.Token)
+	return nil
+}
+
+func revokeTokenCommand(ctl *ctl, args []string) error {
+	flags := flag.NewFlagSet("revoke-token", flag.ExitOnError)
+	name := flags.String("name", "", "Name of the token to revoke (required)")
+	_ = flags.Parse(args)
+
+	if *name == "" {
+		return errors.New("a name is required (-name)")
+	}
+
+	err := ctl.client.RevokeToken(context.Background(), *name)
+	if err != nil {
+		return err
+	}
+
+	return ctl.printSuccess("Revoked token " + *name)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+)
+
+type ctl struct {
+	client *client.Client
+	output string
+}
+
+/// Adds the target flags (id, user, session & channel) to the flag set
+func targetFlags(flags *flag.FlagSet) *common.ResolveOptions {
+	target := &common.ResolveOptions{}
+
+	flags.StringVar(&target.Connection, "id", "", "Target connection ID")
+	flags.StringVar(&target.User, "user", "", "Target user ID")
+	flags.StringVar(&target.Session, "session", "", "Target user session (with user)")
+	flags.StringVar(&target.Channel, "channel", "", "Target channel")
+
+	return target
+}
+
+var errMissingTarget = errors.New("a target is required (-id, -user or -channel)")
+
+func requireTarget(target *common.ResolveOptions) error {
+	if target.Connection == "" && target.User == "" && target.Channel == "" {
+		return errMissingTarget
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+	"os"
+	"time"
+)
+
+const usage = `dsockctl is a command-line tool for administrating dSock through the API.
+
+Usage:
+  dsockctl [flags] <command> [command flags] [arguments]
+
+Commands:
+  send          Send a message to a target, from the arguments, a file or stdin
+  connections   List connections of a target
+  claims        List claims of a target
+  workers       List workers
+  claim         Create a claim
+  revoke        Revoke claims (by ID or target)
+  subscribe     Subscribe a target to a channel
+  unsubscribe   Unsubscribe a target from a channel
+  disconnect    Disconnect a target
+  tail          Stream live connection events (requires publish_events on workers)
+  tokens        List tokens in the store (requires the main token and store_tokens)
+  token         Create a token in the store
+  revoke-token  Revoke a token from the store
+
+Run "dsockctl <command> -h" for the command's flags.
+
+Flags:
+`
+
+var commands = map[string]func(ctl *ctl, args []string) error{
+	"send":         sendCommand,
+	"connections":  connectionsCommand,
+	"claims":       claimsCommand,
+	"workers":      workersCommand,
+	"claim":        claimCommand,
+	"revoke":       revokeCommand,
+	"subscribe":    channelCommand(true),
+	"unsubscribe":  channelCommand(false),
+	"disconnect":   disconnectCommand,
+	"tail":         tailCommand,
+	"tokens":       tokensCommand,
+	"token":        tokenCommand,
+	"revoke-token": revokeTokenCommand,
+}
+
+func main() {
+	// Config is read like the API and workers (config file & DSOCK_ environment variables)
+	options, err := common.GetCtlOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not get options. Make sure your config is valid!")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	flags := flag.NewFlagSet("dsockctl", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+
+	url := flags.String("url", options.ApiUrl, "URL of the API (api_url option)")
+	token := flags.String("token", options.Token, "API token (token option)")
+	output := flags.String("o", outputTable, "Output format: table or json")
+	timeout := flags.Duration("timeout", time.Second*30, "Request timeout (not applied to tail)")
+
+	_ = flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if *output != outputTable && *output != outputJson {
+		fmt.Fprintln(os.Stderr, "Invalid output format, must be table or json")
+		os.Exit(2)
+	}
+
+	command, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", flags.Arg(0))
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctl := &ctl{
+		client: client.New(client.Options{
+			Url:     *url,
+			Token:   *token,
+			Timeout: *timeout,
+		}),
+		output: *output,
+	}
+
+	err = command(ctl, flags.Args()[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const outputTable = "table"
+const outputJson = "json"
+
+/// Prints the value as indented JSON
+func printJson(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(value)
+}
+
+/// Table printed with aligned columns
+type table struct {
+	writer *tabwriter.Writer
+}
+
+func newTable(headers ...string) *table {
+	table := &table{
+		writer: tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0),
+	}
+
+	table.Row(headers...)
+
+	return table
+}
+
+/// Replaces empty values with a dash, to keep columns readable
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
+
+func (table *table) Row(columns ...string) {
+	for index, column := range columns {
+		columns[index] = orDash(column)
+	}
+
+	_, _ = table.writer.Write([]byte(strings.Join(columns, "\t") + "\n"))
+}
+
+func (table *table) Flush() error {
+	return table.writer.Flush()
+}
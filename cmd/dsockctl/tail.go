@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+/// Events are printed as they're received, so columns have fixed widths instead of a table
+const tailFormat = "%-25s  %-18s  %-36s  %-16s  %-16s  %-16s  %s\n"
+
+func tailCommand(ctl *ctl, args []string) error {
+	flags := flag.NewFlagSet("tail", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dsockctl tail [flags]")
+		fmt.Fprintln(flags.Output(), "Streams connection events (optionally filtered by target) until interrupted.")
+		fmt.Fprintln(flags.Output(), "Workers must have publish_events enabled")
+		flags.PrintDefaults()
+	}
+	target := targetFlags(flags)
+	_ = flags.Parse(args)
+
+	events, err := ctl.client.Events(context.Background(), *target)
+	if err != nil {
+		return err
+	}
+
+	defer events.Close()
+
+	if ctl.output == outputTable {
+		fmt.Printf(tailFormat, "TIME", "EVENT", "ID", "USER", "SESSION", "CHANNEL", "WORKER")
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+
+	for {
+		event, err := events.Next()
+		if err == io.EOF {
+			return errors.New("event stream closed by the API")
+		} else if err != nil {
+			return err
+		}
+
+		if ctl.output == outputJson {
+			// One event per line
+			err = encoder.Encode(event)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		eventType := event.Type
+		if event.CloseCode != 0 {
+			eventType += " (" + strconv.Itoa(event.CloseCode) + ")"
+		}
+
+		fmt.Printf(tailFormat,
+			time.Unix(0, event.Time*int64(time.Millisecond)).Format(time.RFC3339),
+			eventType,
+			event.Connection,
+			orDash(event.User),
+			orDash(event.Session),
+			orDash(event.Channel),
+			event.Worker,
+		)
+	}
+}
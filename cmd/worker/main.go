@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/worker"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var options *common.DSockOptions
+var logger *zap.Logger
+
+func init() {
+	var err error
+
+	options, err = common.GetOptions(true)
+
+	if err != nil {
+		println("Could not get options. Make sure your config is valid!")
+		panic(err)
+	}
+
+	logger, err = common.NewLogger(options)
+
+	if err != nil {
+		println("Could not create logger")
+		panic(err)
+	}
+}
+
+func main() {
+	server := worker.NewServer(worker.ServerOptions{
+		Options: options,
+		Logger:  logger,
+	})
+
+	logger.Info("Starting dSock worker",
+		zap.String("version", common.DSockVersion),
+		zap.String("workerId", server.Id()),
+		zap.Int("port", options.Port),
+		zap.String("DEPRECATED.address", options.Address),
+	)
+
+	shutdownTracing, err := common.SetupTracing(options, "dsock-worker", logger)
+	if err != nil {
+		logger.Error("Could not setup tracing",
+			zap.Error(err),
+		)
+		shutdownTracing = func() {}
+	}
+
+	if options.Debug {
+		gin.SetMode(gin.DebugMode)
+	} else {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	common.ServeMetrics(options, logger)
+
+	// Start HTTP server
+	srv := &http.Server{
+		Addr:    options.Address,
+		Handler: server.Handler(),
+	}
+
+	if options.Tls.CertFile != "" {
+		tlsOptions := options.Tls
+		// Client certificates are only verified by the API
+		tlsOptions.ClientCaFile = ""
+
+		srv.TLSConfig, err = common.NewServerTls(tlsOptions, logger)
+		if err != nil {
+			logger.Error("Could not load TLS certificate",
+				zap.Error(err),
+			)
+			panic(err)
+		}
+	}
+
+	server.Start()
+
+	go func() {
+		if err := common.ListenAndServe(srv); err != nil && err != http.ErrServerClosed {
+			logger.Error("Failed listening",
+				zap.Error(err),
+				zap.String("workerId", server.Id()),
+			)
+			options.QuitChannel <- struct{}{}
+		}
+	}()
+
+	logger.Info("Listening",
+		zap.String("address", options.Address),
+		zap.Bool("tls", srv.TLSConfig != nil),
+		zap.String("workerId", server.Id()),
+	)
+
+	directSrv := server.ServeDirect()
+
+	signalQuit := make(chan os.Signal, 1)
+
+	// Listen for signal or message in quit channel
+	signal.Notify(signalQuit, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case <-options.QuitChannel:
+	case receivedSignal := <-signalQuit:
+		if receivedSignal == syscall.SIGTERM {
+			// Gradually close connections (asking clients to reconnect) before shutting down
+			server.Drain()
+		}
+	}
+
+	// Server shutdown
+	logger.Info("Shutting down",
+		zap.String("workerId", server.Id()),
+	)
+
+	server.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error("Error during server shutdown",
+			zap.Error(err),
+			zap.String("workerId", server.Id()),
+		)
+	}
+
+	if directSrv != nil {
+		if err := directSrv.Shutdown(ctx); err != nil {
+			logger.Error("Error during direct server shutdown",
+				zap.Error(err),
+				zap.String("workerId", server.Id()),
+			)
+		}
+	}
+
+	shutdownTracing()
+
+	logger.Info("Stopped",
+		zap.String("workerId", server.Id()),
+	)
+	_ = logger.Sync()
+}
@@ -0,0 +1,31 @@
+package common
+
+import (
+	"time"
+)
+
+/// Exponential backoff, doubling from Min up to Max on each attempt
+type Backoff struct {
+	Min     time.Duration
+	Max     time.Duration
+	attempt uint
+}
+
+/// Returns the duration to wait before the next attempt
+func (backoff *Backoff) Next() time.Duration {
+	duration := backoff.Min << backoff.attempt
+
+	if duration <= 0 || duration > backoff.Max {
+		// Capped (or overflowed)
+		return backoff.Max
+	}
+
+	backoff.attempt++
+
+	return duration
+}
+
+/// Resets the backoff after a successful attempt
+func (backoff *Backoff) Reset() {
+	backoff.attempt = 0
+}
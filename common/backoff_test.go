@@ -0,0 +1,42 @@
+package common_test
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+type BackoffSuite struct {
+	suite.Suite
+}
+
+func TestBackoffSuite(t *testing.T) {
+	suite.Run(t, new(BackoffSuite))
+}
+
+func (suite *BackoffSuite) TestNext() {
+	backoff := common.Backoff{
+		Min: time.Second,
+		Max: time.Second * 5,
+	}
+
+	suite.Equal(time.Second, backoff.Next())
+	suite.Equal(time.Second*2, backoff.Next())
+	suite.Equal(time.Second*4, backoff.Next())
+	suite.Equal(time.Second*5, backoff.Next())
+	suite.Equal(time.Second*5, backoff.Next())
+}
+
+func (suite *BackoffSuite) TestReset() {
+	backoff := common.Backoff{
+		Min: time.Second,
+		Max: time.Second * 5,
+	}
+
+	backoff.Next()
+	backoff.Next()
+	backoff.Reset()
+
+	suite.Equal(time.Second, backoff.Next())
+}
@@ -0,0 +1,92 @@
+package common
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+/// Parses the comma-delimited IPs & CIDRs (such as "10.0.0.0/8,192.168.1.1")
+func ParseTrustedProxies(value string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0)
+
+	for _, entry := range RemoveEmpty(strings.Split(value, ",")) {
+		entry = strings.TrimSpace(entry)
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, errors.New("invalid trusted proxy: " + entry)
+			}
+
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, errors.New("invalid trusted proxy: " + entry)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func trusted(ip net.IP, trustedProxies []*net.IPNet) bool {
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/// Returns the IP of the client that sent the request. The X-Forwarded-For and X-Real-IP headers are only used when
+/// the request comes from a trusted proxy (as clients can set them), taking the last IP not from a trusted proxy
+func ClientIp(request *http.Request, trustedProxies []*net.IPNet) string {
+	remoteIp, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		remoteIp = request.RemoteAddr
+	}
+
+	ip := net.ParseIP(remoteIp)
+	if ip == nil || !trusted(ip, trustedProxies) {
+		return remoteIp
+	}
+
+	forwardedFor := strings.Split(request.Header.Get("X-Forwarded-For"), ",")
+	clientIp := ""
+
+	// Added by each proxy, so the rightmost IPs are from (trusted) proxies
+	for index := len(forwardedFor) - 1; index >= 0; index-- {
+		forwardedIp := net.ParseIP(strings.TrimSpace(forwardedFor[index]))
+		if forwardedIp == nil {
+			break
+		}
+
+		clientIp = forwardedIp.String()
+
+		if !trusted(forwardedIp, trustedProxies) {
+			return clientIp
+		}
+	}
+
+	if clientIp != "" {
+		return clientIp
+	}
+
+	if realIp := net.ParseIP(strings.TrimSpace(request.Header.Get("X-Real-IP"))); realIp != nil {
+		return realIp.String()
+	}
+
+	return remoteIp
+}
@@ -0,0 +1,66 @@
+package common_test
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"testing"
+)
+
+type ClientIpSuite struct {
+	suite.Suite
+}
+
+func TestClientIpSuite(t *testing.T) {
+	suite.Run(t, new(ClientIpSuite))
+}
+
+func (suite *ClientIpSuite) clientIp(remoteAddr string, headers map[string]string, trustedProxies string) string {
+	proxies, err := common.ParseTrustedProxies(trustedProxies)
+	suite.Require().NoError(err)
+
+	request, err := http.NewRequest("GET", "/", nil)
+	suite.Require().NoError(err)
+	request.RemoteAddr = remoteAddr
+
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	return common.ClientIp(request, proxies)
+}
+
+func (suite *ClientIpSuite) TestUntrusted() {
+	suite.Equal("1.2.3.4", suite.clientIp("1.2.3.4:1234", nil, ""))
+	suite.Equal("1.2.3.4", suite.clientIp("1.2.3.4:1234", map[string]string{
+		"X-Forwarded-For": "5.6.7.8",
+		"X-Real-IP":       "5.6.7.8",
+	}, ""), "Forwarded headers from clients should be ignored")
+	suite.Equal("1.2.3.4", suite.clientIp("1.2.3.4:1234", map[string]string{
+		"X-Forwarded-For": "5.6.7.8",
+	}, "10.0.0.0/8"), "Forwarded headers from untrusted proxies should be ignored")
+}
+
+func (suite *ClientIpSuite) TestTrusted() {
+	suite.Equal("5.6.7.8", suite.clientIp("10.0.0.1:1234", map[string]string{
+		"X-Forwarded-For": "5.6.7.8",
+	}, "10.0.0.0/8"))
+	suite.Equal("5.6.7.8", suite.clientIp("10.0.0.1:1234", map[string]string{
+		// The first IP is set by the client
+		"X-Forwarded-For": "9.9.9.9, 5.6.7.8, 10.0.0.2",
+	}, "10.0.0.0/8"), "Should take the last IP not from a trusted proxy")
+	suite.Equal("5.6.7.8", suite.clientIp("10.0.0.1:1234", map[string]string{
+		"X-Real-IP": "5.6.7.8",
+	}, "10.0.0.1"))
+	suite.Equal("10.0.0.1", suite.clientIp("10.0.0.1:1234", map[string]string{
+		"X-Forwarded-For": "invalid",
+	}, "10.0.0.1"))
+}
+
+func (suite *ClientIpSuite) TestInvalidTrustedProxies() {
+	_, err := common.ParseTrustedProxies("10.0.0.0/33")
+	suite.Error(err)
+
+	_, err = common.ParseTrustedProxies("proxy")
+	suite.Error(err)
+}
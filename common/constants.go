@@ -2,15 +2,47 @@ package common
 
 const (
 	PathPing                  = "/ping"
+	PathHealth                = "/health"
+	PathDrain                 = "/drain"
+	PathMetrics               = "/metrics"
 	PathSend                  = "/send"
 	PathConnect               = "/connect"
 	PathClaim                 = "/claim"
+	PathClaimRevoke           = "/claim/revoke"
+	PathBroker                = "/broker"
 	PathInfo                  = "/info"
+	PathWorkers               = "/workers"
+	PathEvents                = "/events"
 	PathDisconnect            = "/disconnect"
 	PathChannelSubscribe      = "/channel/subscribe/:channel"
 	PathChannelUnsubscribe    = "/channel/unsubscribe/:channel"
+	PathTokens                = "/tokens"
+	PathTokenRevoke           = "/tokens/revoke"
 	PathReceiveMessage        = "/_/message"
 	PathReceiveChannelMessage = "/_/message/channel"
 )
 
 const ProtobufContentType = "application/protobuf"
+
+/// Status of a worker able to accept connections (stored in the worker's status)
+const WorkerStatusHealthy = "healthy"
+
+/// Message types between the API and workers
+const (
+	MessageMessageType = "message"
+	ChannelMessageType = "channel"
+)
+
+/// WebSocket close codes used by dSock (4000-4999 is reserved for applications)
+const (
+	/// The connection's send queue was full (send_queue_policy is disconnect)
+	CloseCodeSendQueueFull = 4000
+	/// The worker is draining, the client should reconnect (to another worker)
+	CloseCodeReconnect = 4001
+	/// No message was sent or received for longer than idle_timeout
+	CloseCodeIdleTimeout = 4002
+	/// No message or pong was received for longer than ping_interval + pong_timeout (dead peer)
+	CloseCodePongTimeout = 4003
+	/// Evicted by a newer connection of the same user or session (connection_limit_policy is evict-oldest)
+	CloseCodeConnectionLimit = 4004
+)
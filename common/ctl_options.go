@@ -0,0 +1,60 @@
+package common
+
+import (
+	"errors"
+	"github.com/spf13/viper"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/// Options of dsockctl
+type CtlOptions struct {
+	/// URL of the API (without the path)
+	ApiUrl string
+	Token  string
+}
+
+/// Gets dsockctl's options from the same config file & environment variables as the API and workers.
+/// Unlike GetOptions, doesn't write a config file when none is found, and only validates dsockctl's options
+func GetCtlOptions() (*CtlOptions, error) {
+	config := viper.New()
+	setupConfigSources(config)
+
+	config.SetDefault("port", 6241)
+	config.SetDefault("api_url", "")
+	config.SetDefault("token", "")
+
+	err := config.ReadInConfig()
+	if err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			return nil, err
+		}
+	}
+
+	apiUrl := strings.TrimSuffix(config.GetString("api_url"), "/")
+	if apiUrl == "" {
+		port := config.GetInt("port")
+
+		if os.Getenv("PORT") != "" {
+			port, err = strconv.Atoi(os.Getenv("PORT"))
+
+			if err != nil {
+				return nil, errors.New("invalid port: could not parse integer")
+			}
+		}
+
+		apiUrl = "http://localhost:" + strconv.Itoa(port)
+	}
+
+	parsedApiUrl, err := url.Parse(apiUrl)
+	if err != nil || (parsedApiUrl.Scheme != "http" && parsedApiUrl.Scheme != "https") || parsedApiUrl.Host == "" {
+		return nil, errors.New("invalid api_url: must be an http or https URL")
+	}
+
+	return &CtlOptions{
+		ApiUrl: apiUrl,
+		Token:  config.GetString("token"),
+	}, nil
+}
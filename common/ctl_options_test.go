@@ -0,0 +1,77 @@
+package common_test
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type CtlOptionsSuite struct {
+	suite.Suite
+	dir        string
+	workingDir string
+}
+
+func TestCtlOptionsSuite(t *testing.T) {
+	suite.Run(t, new(CtlOptionsSuite))
+}
+
+func (suite *CtlOptionsSuite) SetupTest() {
+	var err error
+
+	suite.workingDir, err = os.Getwd()
+	suite.Require().NoError(err)
+
+	suite.dir, err = ioutil.TempDir("", "dsock-ctl-options")
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(os.Chdir(suite.dir))
+}
+
+func (suite *CtlOptionsSuite) TearDownTest() {
+	_ = os.Chdir(suite.workingDir)
+	_ = os.RemoveAll(suite.dir)
+}
+
+func (suite *CtlOptionsSuite) TestWithoutConfig() {
+	options, err := common.GetCtlOptions()
+	suite.Require().NoError(err)
+
+	suite.Equal("http://localhost:6241", options.ApiUrl, "Incorrect default API URL")
+	suite.Equal("", options.Token, "Incorrect default token")
+
+	suite.NoFileExists(filepath.Join(suite.dir, "config.toml"), "Config file should not be written")
+}
+
+func (suite *CtlOptionsSuite) TestConfig() {
+	// Server-only options (such as an invalid send queue policy) are ignored
+	config := "api_url = \"https://dsock.example.com/\"\ntoken = \"abc\"\nsend_queue_policy = \"invalid\"\n"
+	suite.Require().NoError(ioutil.WriteFile(filepath.Join(suite.dir, "config.toml"), []byte(config), 0600))
+
+	options, err := common.GetCtlOptions()
+	suite.Require().NoError(err)
+
+	suite.Equal("https://dsock.example.com", options.ApiUrl, "Incorrect API URL")
+	suite.Equal("abc", options.Token, "Incorrect token")
+}
+
+func (suite *CtlOptionsSuite) TestEnvironment() {
+	suite.Require().NoError(os.Setenv("DSOCK_TOKEN", "from_env"))
+	defer os.Unsetenv("DSOCK_TOKEN")
+
+	options, err := common.GetCtlOptions()
+	suite.Require().NoError(err)
+
+	suite.Equal("from_env", options.Token, "Incorrect token")
+}
+
+func (suite *CtlOptionsSuite) TestInvalidApiUrl() {
+	suite.Require().NoError(os.Setenv("DSOCK_API_URL", "localhost"))
+	defer os.Unsetenv("DSOCK_API_URL")
+
+	_, err := common.GetCtlOptions()
+	suite.Error(err, "Invalid API URL should be rejected")
+}
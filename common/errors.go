@@ -20,6 +20,8 @@ const (
 	ErrorClaimIdAlreadyUsed    = "CLAIM_ID_ALREADY_USED"
 	ErrorCheckingClaim         = "ERROR_CHECKING_CLAIM"
 	ErrorGettingClaim          = "ERROR_GETTING_CLAIM"
+	ErrorCreatingClaim         = "ERROR_CREATING_CLAIM"
+	ErrorDeletingClaim         = "ERROR_DELETING_CLAIM"
 	ErrorMissingClaim          = "MISSING_CLAIM"
 	ErrorExpiredClaim          = "EXPIRED_CLAIM"
 	ErrorReadingMessage        = "ERROR_READING_MESSAGE"
@@ -31,6 +33,22 @@ const (
 	ErrorDeliveringMessage     = "ERROR_DELIVERING_MESSAGING"
 	ErrorInvalidContentType    = "INVALID_CONTENT_TYPE"
 	ErrorReadingBody           = "ERROR_READING_BODY"
+	ErrorWorkerDraining        = "WORKER_DRAINING"
+	ErrorConnectionLimit       = "CONNECTION_LIMIT_REACHED"
+	ErrorWorkerAtCapacity      = "WORKER_AT_CAPACITY"
+	ErrorNoWorkerAvailable     = "NO_WORKER_AVAILABLE"
+	ErrorRateLimited           = "RATE_LIMITED"
+	ErrorSubscribingEvents     = "ERROR_SUBSCRIBING_EVENTS"
+	ErrorMissingScope          = "MISSING_SCOPE"
+	ErrorTargetNotAllowed      = "TARGET_NOT_ALLOWED"
+	ErrorGettingToken          = "ERROR_GETTING_TOKEN"
+	ErrorInvalidToken          = "INVALID_TOKEN"
+	ErrorTokenNameAlreadyUsed  = "TOKEN_NAME_ALREADY_USED"
+	ErrorCreatingToken         = "ERROR_CREATING_TOKEN"
+	ErrorDeletingToken         = "ERROR_DELETING_TOKEN"
+	ErrorMissingToken          = "MISSING_TOKEN"
+	ErrorInvalidSignature      = "INVALID_SIGNATURE"
+	ErrorBodyTooLarge          = "BODY_TOO_LARGE"
 )
 
 var ErrorMessages = map[string]string{
@@ -49,6 +67,8 @@ var ErrorMessages = map[string]string{
 	ErrorClaimIdAlreadyUsed:    "Claim ID is already used",
 	ErrorCheckingClaim:         "Error checking if claim already exists",
 	ErrorGettingClaim:          "Error getting claim",
+	ErrorCreatingClaim:         "Error creating claim",
+	ErrorDeletingClaim:         "Error deleting claim",
 	ErrorMissingClaim:          "Could not find claim",
 	ErrorExpiredClaim:          "Claim has expired",
 	ErrorReadingMessage:        "Error reading message",
@@ -60,6 +80,22 @@ var ErrorMessages = map[string]string{
 	ErrorDeliveringMessage:     "Error delivering message",
 	ErrorInvalidContentType:    "Invalid Content-Type",
 	ErrorReadingBody:           "Error reading body",
+	ErrorWorkerDraining:        "Worker is draining, connect to another worker",
+	ErrorConnectionLimit:       "Maximum number of connections reached for user or session",
+	ErrorWorkerAtCapacity:      "Worker is at capacity, connect to another worker",
+	ErrorNoWorkerAvailable:     "No worker is available to connect to",
+	ErrorRateLimited:           "Too many requests, try again later",
+	ErrorSubscribingEvents:     "Error subscribing to events",
+	ErrorMissingScope:          "Token does not have the scope required for this request",
+	ErrorTargetNotAllowed:      "Token is not allowed to target this user or channel",
+	ErrorGettingToken:          "Error getting token",
+	ErrorInvalidToken:          "Invalid token, must have a name and valid scopes",
+	ErrorTokenNameAlreadyUsed:  "Token name is already used",
+	ErrorCreatingToken:         "Error creating token",
+	ErrorDeletingToken:         "Error deleting token",
+	ErrorMissingToken:          "Could not find token",
+	ErrorInvalidSignature:      "Invalid or expired signature",
+	ErrorBodyTooLarge:          "Body is too large",
 }
 
 type ApiError struct {
@@ -76,7 +112,7 @@ type ApiError struct {
 }
 
 func (apiError *ApiError) Error() string {
-	if apiError.InternalError != nil {
+	if apiError.InternalError == nil {
 		return apiError.ErrorCode
 	}
 
@@ -0,0 +1,48 @@
+package common
+
+/// Connection event types, published by workers when publish_events is enabled
+const (
+	EventConnect     = "connect"
+	EventDisconnect  = "disconnect"
+	EventSubscribe   = "subscribe"
+	EventUnsubscribe = "unsubscribe"
+)
+
+/// Connection event, streamed to API clients (as JSON) on /events
+type Event struct {
+	Type string `json:"type"`
+	/// Unix time (milliseconds) of the event
+	Time       int64  `json:"time"`
+	Worker     string `json:"worker"`
+	Connection string `json:"id"`
+	User       string `json:"user"`
+	Session    string `json:"session,omitempty"`
+	/// Channels of the connection (after the event)
+	Channels []string `json:"channels"`
+	/// Channel subscribed to or unsubscribed from
+	Channel string `json:"channel,omitempty"`
+	/// WebSocket close code, for disconnect events
+	CloseCode int `json:"closeCode,omitempty"`
+}
+
+/// Whether the event is for a connection matching the target (connection ID, user, session and/or channel).
+/// Channel targets also match the channel subscribed to or unsubscribed from
+func (event *Event) Matches(target ResolveOptions) bool {
+	if target.Connection != "" && target.Connection != event.Connection {
+		return false
+	}
+
+	if target.User != "" && target.User != event.User {
+		return false
+	}
+
+	if target.Session != "" && target.Session != event.Session {
+		return false
+	}
+
+	if target.Channel != "" && target.Channel != event.Channel && !IncludesString(event.Channels, target.Channel) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,48 @@
+package common_test
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type EventSuite struct {
+	suite.Suite
+}
+
+func TestEventSuite(t *testing.T) {
+	suite.Run(t, new(EventSuite))
+}
+
+func (suite *EventSuite) TestMatches() {
+	event := common.Event{
+		Type:       common.EventSubscribe,
+		Connection: "connection",
+		User:       "user",
+		Session:    "session",
+		Channels:   []string{"channel"},
+		Channel:    "channel",
+	}
+
+	suite.True(event.Matches(common.ResolveOptions{}))
+	suite.True(event.Matches(common.ResolveOptions{Connection: "connection"}))
+	suite.True(event.Matches(common.ResolveOptions{User: "user", Session: "session"}))
+	suite.True(event.Matches(common.ResolveOptions{Channel: "channel"}))
+
+	suite.False(event.Matches(common.ResolveOptions{Connection: "other_connection"}))
+	suite.False(event.Matches(common.ResolveOptions{User: "other_user"}))
+	suite.False(event.Matches(common.ResolveOptions{User: "user", Session: "other_session"}))
+	suite.False(event.Matches(common.ResolveOptions{Channel: "other_channel"}))
+}
+
+func (suite *EventSuite) TestMatchesUnsubscribe() {
+	event := common.Event{
+		Type:       common.EventUnsubscribe,
+		Connection: "connection",
+		User:       "user",
+		Channels:   []string{},
+		Channel:    "channel",
+	}
+
+	suite.True(event.Matches(common.ResolveOptions{Channel: "channel"}), "Should match the channel unsubscribed from")
+}
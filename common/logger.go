@@ -0,0 +1,12 @@
+package common
+
+import "go.uber.org/zap"
+
+/// Creates a development logger in debug mode, or a production logger otherwise
+func NewLogger(options *DSockOptions) (*zap.Logger, error) {
+	if options.Debug {
+		return zap.NewDevelopment()
+	}
+
+	return zap.NewProduction()
+}
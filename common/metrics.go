@@ -0,0 +1,43 @@
+package common
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+/// Serves Prometheus metrics on `/metrics`, authenticated with the token.
+/// Does nothing when `metrics_port` is set (see ServeMetrics)
+func RegisterMetricsRoute(router gin.IRoutes, options *DSockOptions) {
+	if options.MetricsPort == 0 {
+		router.GET(PathMetrics, TokenMiddleware(options.Token), gin.WrapH(promhttp.Handler()))
+	}
+}
+
+/// When `metrics_port` is set, serves Prometheus metrics on that port, without authentication.
+/// Metrics are shared by all servers of the process, so this should only be called once
+func ServeMetrics(options *DSockOptions, logger *zap.Logger) {
+	if options.MetricsPort == 0 {
+		return
+	}
+
+	address := ":" + strconv.Itoa(options.MetricsPort)
+
+	metricsRouter := http.NewServeMux()
+	metricsRouter.Handle(PathMetrics, promhttp.Handler())
+
+	go func() {
+		if err := http.ListenAndServe(address, metricsRouter); err != nil {
+			logger.Error("Failed listening for metrics",
+				zap.Error(err),
+				zap.String("address", address),
+			)
+		}
+	}()
+
+	logger.Info("Listening for metrics",
+		zap.String("address", address),
+	)
+}
@@ -2,8 +2,10 @@ package common
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"github.com/go-redis/redis/v7"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 	"net"
 	"os"
@@ -13,59 +15,279 @@ import (
 )
 
 const MessageMethodRedis = "redis"
+const MessageMethodRedisStreams = "redis-streams"
 const MessageMethodDirect = "direct"
 
+const StoreRedis = "redis"
+const StoreMemory = "memory"
+
+const ChannelFanoutMembers = "members"
+const ChannelFanoutPubSub = "pubsub"
+
+const SendQueuePolicyDropNewest = "drop-newest"
+const SendQueuePolicyDropOldest = "drop-oldest"
+const SendQueuePolicyDisconnect = "disconnect"
+
+const ConnectionLimitPolicyReject = "reject"
+const ConnectionLimitPolicyEvictOldest = "evict-oldest"
+
+const DirectAuthToken = "token"
+const DirectAuthHmac = "hmac"
+
+const TlsClientAuthRequire = "require"
+const TlsClientAuthVerifyIfGiven = "verify-if-given"
+
+const RedisModeSingle = "single"
+const RedisModeSentinel = "sentinel"
+const RedisModeCluster = "cluster"
+
 type JwtOptions struct {
 	JwtSecret string
 }
 
+type TracingOptions struct {
+	/// OTLP (HTTP) endpoint (host:port) to export traces to. Empty to disable exporting
+	Endpoint string
+	/// Export without TLS
+	Insecure bool
+	/// Ratio of traces sampled (for traces not started by the caller)
+	SampleRatio float64
+}
+
+type TlsOptions struct {
+	/// Certificate & key files to serve over HTTPS. Empty to serve over HTTP
+	CertFile string
+	KeyFile  string
+	/// CA file to verify client certificates with (API only). Empty to not verify client certificates
+	ClientCaFile string
+	/// If client certificates are required, or only verified when given (require or verify-if-given)
+	ClientAuth string
+	/// Minimum TLS version (tls.VersionTLS12, etc.)
+	MinVersion uint16
+	/// Cipher suites for TLS 1.2 and below. Empty to use Go's defaults
+	CipherSuites []uint16
+	/// How often to check the files for changes, on new connections. 0 to disable reloading
+	ReloadInterval time.Duration
+}
+
+type RateLimitOptions struct {
+	/// Duration of the sliding window requests are counted over
+	Window time.Duration
+	/// Maximum requests per window to /send. 0 to disable
+	Send int
+	/// Maximum requests per window to /claim (and /broker). 0 to disable
+	Claim int
+	/// Maximum requests per window to /disconnect. 0 to disable
+	Disconnect int
+	/// Count requests separately per target (user or channel)
+	ByTarget bool
+}
+
 type DSockOptions struct {
-	RedisOptions *redis.Options
-	Address      string
-	Port         int
-	QuitChannel  chan struct{}
-	Debug        bool
-	LogRequests  bool
-	/// Token for your API -> dSock and between dSock services
+	/// The state store (redis or memory)
+	Store string
+	/// How to connect to Redis (single, sentinel or cluster)
+	RedisMode    string
+	RedisOptions *redis.UniversalOptions
+	/// Password for the Sentinel nodes (sentinel mode), if different from the Redis password
+	RedisSentinelPassword string
+	Address               string
+	Port                  int
+	/// Port to serve metrics on, without authentication. 0 to serve them on the main port (authenticated with the token)
+	MetricsPort int
+	QuitChannel chan struct{}
+	Debug       bool
+	LogRequests bool
+	/// Token for your API -> dSock and between dSock services. Has all scopes
 	Token string
+	/// Additional API tokens with scopes (from the config)
+	Tokens []ApiToken
+	/// Also look up API tokens in the store (created with /tokens), so they can be rotated without restarting
+	StoreTokens bool
+	/// How long tokens looked up in the store are cached by each API node
+	TokenCacheDuration time.Duration
+	/// Trace exporting options
+	Tracing TracingOptions
+	/// Native TLS termination of the main port
+	Tls TlsOptions
+	/// API rate limits, counted per token (and per target if ByTarget)
+	RateLimit RateLimitOptions
 	/// JWT parsing/verifying options
 	Jwt JwtOptions
 	/// Default channels to subscribe on join
 	DefaultChannels []string
 	/// The message method between the API to the worker
 	MessagingMethod string
+	/// How messages are sent to channels (members or pubsub)
+	ChannelFanout string
 	/// The worker hostname
 	DirectHostname string
 	/// The worker port
 	DirectPort int
+	/// How the API authenticates to the worker's direct messaging endpoints (token or hmac)
+	DirectAuth string
+	/// Secret signing direct messages (hmac direct auth). Defaults to the token
+	DirectHmacSecret string
+	/// Maximum size (in bytes) of HMAC-signed direct message requests, read before verifying the signature. 0 to disable
+	DirectMaxBodySize int64
+	/// Address (host:port) to serve the direct messaging endpoints on, instead of the main port. Empty to use the main port
+	DirectListenAddress string
+	/// TLS config serving the direct messaging endpoints on direct_listen_address. Nil to serve them over HTTP
+	DirectTls *tls.Config
+	/// TLS config of direct messages to workers (CA verifying workers, and client certificate for mutual TLS). Nil to use the system's CAs
+	DirectClientTls *tls.Config
+	/// URL clients connect to the worker with (without the path), returned by the connect broker
+	PublicUrl string
+	/// Region label of the worker, used by the connect broker
+	Region string
+	/// Publish connection events (connect, disconnect, subscribe & unsubscribe), streamed by the API on /events
+	PublishEvents bool
 	/// Interval for refreshing expiring data
 	TtlDuration time.Duration
+	/// Approximate maximum length of a worker's stream (redis-streams messaging method). 0 to disable
+	StreamMaxLength int64
+	/// Maximum age of a worker's stream entries (redis-streams messaging method). 0 to disable
+	StreamMaxAge time.Duration
+	/// Disconnect all clients when the worker is degraded for longer than this. 0 to disable
+	DegradedDisconnectAfter time.Duration
+	/// Interval between pings sent to connections
+	PingInterval time.Duration
+	/// How long after a ping interval without receiving anything before a connection is considered dead
+	PongTimeout time.Duration
+	/// Disconnect connections without messages sent or received for longer than this. 0 to disable
+	IdleTimeout time.Duration
+	/// Maximum size of a message received from a client, in bytes. 0 to disable
+	MaxFrameSize int64
+	/// Maximum messages per second received from a connection. 0 to disable
+	MaxMessagesPerSecond int
+	/// Maximum connection attempts per client IP per ConnectRateWindow, across all workers. 0 to disable
+	MaxConnectsPerIp int
+	/// Proxies (IPs & CIDRs) allowed to set the client IP with the X-Forwarded-For & X-Real-IP headers
+	TrustedProxies []*net.IPNet
+	/// Duration of the sliding window connection attempts are counted over
+	ConnectRateWindow time.Duration
+	/// Maximum connections per user, across all workers. 0 to disable
+	MaxConnectionsPerUser int
+	/// Maximum connections per user session, across all workers. 0 to disable
+	MaxConnectionsPerSession int
+	/// What to do when a connection limit is reached (reject or evict-oldest)
+	ConnectionLimitPolicy string
+	/// Only keep the newest connection of each session, evicting the previous one
+	SingleConnectionPerSession bool
+	/// Maximum connections on this worker before new connections are rejected. 0 to disable
+	MaxConnections int
+	/// Maximum goroutines on this worker before new connections are rejected. 0 to disable
+	MaxGoroutines int
+	/// Maximum memory (in bytes) used (obtained from the OS and not released) before new connections are rejected. 0 to disable
+	MaxMemory uint64
+	/// Interval for publishing the worker's load
+	LoadReportInterval time.Duration
+	/// Window over which connections are gradually closed when draining
+	DrainWindow time.Duration
+	/// Maximum random delay hinted to clients before reconnecting when draining
+	DrainRetryJitter time.Duration
+	/// Maximum number of messages waiting to be sent per connection
+	SendQueueSize int
+	/// What to do when a connection's send queue is full (drop-newest, drop-oldest or disconnect)
+	SendQueuePolicy string
+}
+
+/// Reads the config from the config file (in the current directory, ~/.config/dsock or /etc/dsock)
+/// and DSOCK_ environment variables
+func setupConfigSources(config *viper.Viper) {
+	config.SetConfigName("config")
+	config.SetEnvPrefix("DSOCK")
+	config.AutomaticEnv()
+
+	config.AddConfigPath(".")
+	config.AddConfigPath("$HOME/.config/dsock")
+	config.AddConfigPath("/etc/dsock")
+}
+
+/// Sets the default value of each option
+func setConfigDefaults(config *viper.Viper) {
+	config.SetDefault("store", "redis")
+	config.SetDefault("redis_mode", "single")
+	config.SetDefault("redis_host", "localhost:6379")
+	config.SetDefault("redis_addresses", "")
+	config.SetDefault("redis_sentinel_master", "")
+	config.SetDefault("redis_sentinel_password", "")
+	config.SetDefault("redis_username", "")
+	config.SetDefault("redis_password", "")
+	config.SetDefault("redis_db", 0)
+	config.SetDefault("redis_max_retries", 10)
+	config.SetDefault("redis_tls", false)
+	config.SetDefault("port", 6241)
+	config.SetDefault("metrics_port", 0)
+	config.SetDefault("api_url", "")
+	config.SetDefault("default_channels", "")
+	config.SetDefault("token", "")
+	config.SetDefault("store_tokens", false)
+	config.SetDefault("token_cache_duration", "10s")
+	config.SetDefault("tracing_endpoint", "")
+	config.SetDefault("tracing_insecure", false)
+	config.SetDefault("tracing_sample_ratio", 1)
+	config.SetDefault("rate_limit_window", "1m")
+	config.SetDefault("rate_limit_send", 0)
+	config.SetDefault("rate_limit_claim", 0)
+	config.SetDefault("rate_limit_disconnect", 0)
+	config.SetDefault("rate_limit_by_target", false)
+	config.SetDefault("jwt_secret", "")
+	config.SetDefault("debug", false)
+	config.SetDefault("log_requests", false)
+	config.SetDefault("messaging_method", "redis")
+	config.SetDefault("channel_fanout", "members")
+	config.SetDefault("direct_message_hostname", "")
+	config.SetDefault("direct_message_port", "")
+	config.SetDefault("direct_auth", "token")
+	config.SetDefault("direct_hmac_secret", "")
+	config.SetDefault("direct_max_body_size", 10485760)
+	config.SetDefault("direct_listen_address", "")
+	config.SetDefault("tls_cert_file", "")
+	config.SetDefault("tls_key_file", "")
+	config.SetDefault("tls_client_ca_file", "")
+	config.SetDefault("tls_client_auth", "require")
+	config.SetDefault("tls_min_version", "1.2")
+	config.SetDefault("tls_cipher_suites", "")
+	config.SetDefault("tls_reload_interval", "10s")
+	config.SetDefault("direct_tls_cert_file", "")
+	config.SetDefault("direct_tls_key_file", "")
+	config.SetDefault("direct_tls_client_ca_file", "")
+	config.SetDefault("direct_tls_ca_file", "")
+	config.SetDefault("direct_tls_client_cert_file", "")
+	config.SetDefault("direct_tls_client_key_file", "")
+	config.SetDefault("public_url", "")
+	config.SetDefault("region", "")
+	config.SetDefault("publish_events", false)
+	config.SetDefault("ttl_duration", "60s")
+	config.SetDefault("redis_streams_max_length", 10000)
+	config.SetDefault("redis_streams_max_age", "0s")
+	config.SetDefault("degraded_disconnect_after", "0s")
+	config.SetDefault("ping_interval", "30s")
+	config.SetDefault("pong_timeout", "10s")
+	config.SetDefault("idle_timeout", "0s")
+	config.SetDefault("max_frame_size", 65536)
+	config.SetDefault("max_messages_per_second", 0)
+	config.SetDefault("max_connects_per_ip", 0)
+	config.SetDefault("trusted_proxies", "")
+	config.SetDefault("connect_rate_window", "1m")
+	config.SetDefault("max_connections_per_user", 0)
+	config.SetDefault("max_connections_per_session", 0)
+	config.SetDefault("connection_limit_policy", "reject")
+	config.SetDefault("single_connection_per_session", false)
+	config.SetDefault("max_connections", 0)
+	config.SetDefault("max_goroutines", 0)
+	config.SetDefault("max_memory_mb", 0)
+	config.SetDefault("load_report_interval", "10s")
+	config.SetDefault("drain_window", "30s")
+	config.SetDefault("drain_retry_jitter", "5s")
+	config.SetDefault("send_queue_size", 256)
+	config.SetDefault("send_queue_policy", "drop-oldest")
 }
 
 func SetupConfig() error {
-	viper.SetConfigName("config")
-	viper.SetEnvPrefix("DSOCK")
-	viper.AutomaticEnv()
-
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("$HOME/.config/dsock")
-	viper.AddConfigPath("/etc/dsock")
-
-	viper.SetDefault("redis_host", "localhost:6379")
-	viper.SetDefault("redis_password", "")
-	viper.SetDefault("redis_db", 0)
-	viper.SetDefault("redis_max_retries", 10)
-	viper.SetDefault("redis_tls", false)
-	viper.SetDefault("port", 6241)
-	viper.SetDefault("default_channels", "")
-	viper.SetDefault("token", "")
-	viper.SetDefault("jwt_secret", "")
-	viper.SetDefault("debug", false)
-	viper.SetDefault("log_requests", false)
-	viper.SetDefault("messaging_method", "redis")
-	viper.SetDefault("direct_message_hostname", "")
-	viper.SetDefault("direct_message_port", "")
-	viper.SetDefault("ttl_duration", "60s")
+	setupConfigSources(viper.GetViper())
+	setConfigDefaults(viper.GetViper())
 
 	err := viper.ReadInConfig()
 
@@ -84,59 +306,282 @@ func SetupConfig() error {
 	return nil
 }
 
+/// Gets the options from the config file & environment variables (creating the config file if none is found), validating them
 func GetOptions(worker bool) (*DSockOptions, error) {
 	err := SetupConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	port := viper.GetInt("port")
-
 	if os.Getenv("PORT") != "" {
-		port, err = strconv.Atoi(os.Getenv("PORT"))
+		port, err := strconv.Atoi(os.Getenv("PORT"))
 
 		if err != nil {
 			return nil, errors.New("invalid port: could not parse integer")
 		}
+
+		viper.Set("port", port)
 	}
 
+	return optionsFromConfig(viper.GetViper(), worker)
+}
+
+/// Returns the default options (as if no config file or environment variables were set), such as for embedding the
+/// API or a worker. Fields changed afterwards aren't validated
+func DefaultOptions(worker bool) (*DSockOptions, error) {
+	config := viper.New()
+	setConfigDefaults(config)
+
+	return optionsFromConfig(config, worker)
+}
+
+/// Parses & validates the options from the config
+func optionsFromConfig(config *viper.Viper, worker bool) (*DSockOptions, error) {
+	port := config.GetInt("port")
+
 	address := ":" + strconv.Itoa(port)
 
-	if viper.IsSet("address") {
+	if config.IsSet("address") {
 		println("DEPRECATED: address is deprecated, use port")
-		address = viper.GetString("address")
+		address = config.GetString("address")
 	}
 
-	redisOptions := redis.Options{
-		Addr:       viper.GetString("redis_host"),
-		Password:   viper.GetString("redis_password"),
-		DB:         viper.GetInt("redis_db"),
-		MaxRetries: viper.GetInt("redis_max_retries"),
+	redisMode := config.GetString("redis_mode")
+
+	redisOptions := redis.UniversalOptions{
+		Addrs:      []string{config.GetString("redis_host")},
+		Username:   config.GetString("redis_username"),
+		Password:   config.GetString("redis_password"),
+		DB:         config.GetInt("redis_db"),
+		MaxRetries: config.GetInt("redis_max_retries"),
+	}
+
+	if redisMode == RedisModeSentinel || redisMode == RedisModeCluster {
+		redisAddresses := RemoveEmpty(strings.Split(config.GetString("redis_addresses"), ","))
+		if len(redisAddresses) == 0 {
+			return nil, errors.New("redis_addresses is required in sentinel and cluster modes")
+		}
+
+		redisOptions.Addrs = redisAddresses
+
+		if redisMode == RedisModeSentinel {
+			redisOptions.MasterName = config.GetString("redis_sentinel_master")
+			if redisOptions.MasterName == "" {
+				return nil, errors.New("redis_sentinel_master is required in sentinel mode")
+			}
+		} else if redisOptions.DB != 0 {
+			return nil, errors.New("redis_db must be 0 in cluster mode")
+		}
+	} else if redisMode != RedisModeSingle {
+		return nil, errors.New("invalid redis mode")
 	}
 
-	if viper.GetBool("redis_tls") {
+	if config.GetBool("redis_tls") {
 		redisOptions.TLSConfig = &tls.Config{}
 	}
 
-	ttlDuration, err := time.ParseDuration(viper.GetString("ttl_duration"))
+	ttlDuration, err := time.ParseDuration(config.GetString("ttl_duration"))
+	if err != nil {
+		return nil, err
+	}
+
+	streamMaxAge, err := time.ParseDuration(config.GetString("redis_streams_max_age"))
+	if err != nil {
+		return nil, err
+	}
+
+	degradedDisconnectAfter, err := time.ParseDuration(config.GetString("degraded_disconnect_after"))
+	if err != nil {
+		return nil, err
+	}
+
+	store := config.GetString("store")
+	if store != StoreRedis && store != StoreMemory {
+		return nil, errors.New("invalid store")
+	}
+
+	pingInterval, err := time.ParseDuration(config.GetString("ping_interval"))
+	if err != nil {
+		return nil, err
+	}
+	if pingInterval <= 0 {
+		return nil, errors.New("ping_interval must be positive")
+	}
+
+	pongTimeout, err := time.ParseDuration(config.GetString("pong_timeout"))
+	if err != nil {
+		return nil, err
+	}
+	if pongTimeout <= 0 {
+		return nil, errors.New("pong_timeout must be positive")
+	}
+
+	idleTimeout, err := time.ParseDuration(config.GetString("idle_timeout"))
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := getTokens(config)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenCacheDuration, err := time.ParseDuration(config.GetString("token_cache_duration"))
 	if err != nil {
 		return nil, err
 	}
 
+	tracingSampleRatio := config.GetFloat64("tracing_sample_ratio")
+	if tracingSampleRatio < 0 || tracingSampleRatio > 1 {
+		return nil, errors.New("tracing_sample_ratio must be between 0 and 1")
+	}
+
+	rateLimitWindow, err := time.ParseDuration(config.GetString("rate_limit_window"))
+	if err != nil {
+		return nil, err
+	}
+	if rateLimitWindow < time.Millisecond {
+		return nil, errors.New("rate_limit_window must be at least 1ms")
+	}
+
+	connectRateWindow, err := time.ParseDuration(config.GetString("connect_rate_window"))
+	if err != nil {
+		return nil, err
+	}
+	if connectRateWindow < time.Millisecond {
+		return nil, errors.New("connect_rate_window must be at least 1ms")
+	}
+
+	trustedProxies, err := ParseTrustedProxies(config.GetString("trusted_proxies"))
+	if err != nil {
+		return nil, err
+	}
+
+	connectionLimitPolicy := config.GetString("connection_limit_policy")
+	if connectionLimitPolicy != ConnectionLimitPolicyReject && connectionLimitPolicy != ConnectionLimitPolicyEvictOldest {
+		return nil, errors.New("invalid connection limit policy")
+	}
+
+	loadReportInterval, err := time.ParseDuration(config.GetString("load_report_interval"))
+	if err != nil {
+		return nil, err
+	}
+	if loadReportInterval <= 0 {
+		return nil, errors.New("load_report_interval must be positive")
+	}
+
+	drainWindow, err := time.ParseDuration(config.GetString("drain_window"))
+	if err != nil {
+		return nil, err
+	}
+
+	drainRetryJitter, err := time.ParseDuration(config.GetString("drain_retry_jitter"))
+	if err != nil {
+		return nil, err
+	}
+
+	sendQueueSize := config.GetInt("send_queue_size")
+	if sendQueueSize < 1 {
+		return nil, errors.New("send_queue_size must be at least 1")
+	}
+
+	sendQueuePolicy := config.GetString("send_queue_policy")
+	if sendQueuePolicy != SendQueuePolicyDropNewest &&
+		sendQueuePolicy != SendQueuePolicyDropOldest &&
+		sendQueuePolicy != SendQueuePolicyDisconnect {
+		return nil, errors.New("invalid send queue policy")
+	}
+
+	channelFanout := config.GetString("channel_fanout")
+	if channelFanout != ChannelFanoutMembers && channelFanout != ChannelFanoutPubSub {
+		return nil, errors.New("invalid channel fan-out")
+	}
+
 	directHostname := GetLocalIP()
 	directPort := port
-	messagingMethod := viper.GetString("messaging_method")
+	tlsOptions, err := getTlsOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	directListenAddress := config.GetString("direct_listen_address")
+	var directTls, directClientTls *tls.Config
+	messagingMethod := config.GetString("messaging_method")
+
+	directAuth := config.GetString("direct_auth")
+	if directAuth != DirectAuthToken && directAuth != DirectAuthHmac {
+		return nil, errors.New("invalid direct auth")
+	}
+
+	directHmacSecret := config.GetString("direct_hmac_secret")
+	if directHmacSecret == "" {
+		directHmacSecret = config.GetString("token")
+	}
 
-	if messagingMethod == MessageMethodRedis {
+	if messagingMethod == MessageMethodRedis || messagingMethod == MessageMethodRedisStreams {
 		// OK
 	} else if messagingMethod == MessageMethodDirect {
+		// Direct messages can't be authenticated with an empty token or secret
+		if directAuth == DirectAuthHmac && directHmacSecret == "" {
+			return nil, errors.New("direct_hmac_secret (or token) is required with hmac direct auth")
+		} else if directAuth == DirectAuthToken && config.GetString("token") == "" {
+			return nil, errors.New("token is required with token direct auth")
+		}
+
+		// Workers also send direct messages to other workers
+		if config.GetString("direct_tls_ca_file") != "" || config.GetString("direct_tls_client_cert_file") != "" {
+			directClientTls, err = NewClientTls(
+				config.GetString("direct_tls_ca_file"),
+				config.GetString("direct_tls_client_cert_file"),
+				config.GetString("direct_tls_client_key_file"),
+				tlsOptions.ReloadInterval,
+				nil,
+			)
+			if err != nil {
+				return nil, errors.New("invalid direct TLS client config: " + err.Error())
+			}
+		}
+
+		if worker && config.GetString("direct_tls_cert_file") != "" {
+			if directListenAddress == "" {
+				return nil, errors.New("direct_tls_cert_file requires direct_listen_address")
+			}
+
+			directTls, err = NewServerTls(TlsOptions{
+				CertFile:       config.GetString("direct_tls_cert_file"),
+				KeyFile:        config.GetString("direct_tls_key_file"),
+				ClientCaFile:   config.GetString("direct_tls_client_ca_file"),
+				ClientAuth:     TlsClientAuthRequire,
+				MinVersion:     tlsOptions.MinVersion,
+				CipherSuites:   tlsOptions.CipherSuites,
+				ReloadInterval: tlsOptions.ReloadInterval,
+			}, nil)
+			if err != nil {
+				return nil, errors.New("invalid direct TLS config: " + err.Error())
+			}
+		}
+
 		if worker {
-			if viper.IsSet("direct_message_hostname") {
-				directHostname = viper.GetString("direct_message_hostname")
+			if directListenAddress != "" {
+				// The API reaches the worker on the direct messaging listener
+				_, listenPort, err := net.SplitHostPort(directListenAddress)
+				if err != nil {
+					return nil, errors.New("invalid direct_listen_address: " + err.Error())
+				}
+
+				directPort, err = strconv.Atoi(listenPort)
+				if err != nil {
+					return nil, errors.New("invalid direct_listen_address: could not parse port")
+				}
 			}
 
-			if viper.IsSet("direct_message_port") {
-				directPort = viper.GetInt("direct_message_port")
+			// Checked for values, as IsSet is always true with defaults
+			if config.GetString("direct_message_hostname") != "" {
+				directHostname = config.GetString("direct_message_hostname")
+			}
+
+			if config.GetString("direct_message_port") != "" {
+				directPort = config.GetInt("direct_message_port")
 			}
 		}
 	} else {
@@ -144,26 +589,188 @@ func GetOptions(worker bool) (*DSockOptions, error) {
 	}
 
 	return &DSockOptions{
-		Debug:        viper.GetBool("debug"),
-		LogRequests:  viper.GetBool("log_requests"),
-		RedisOptions: &redisOptions,
-		Address:      address,
-		Token:        viper.GetString("token"),
-		QuitChannel:  make(chan struct{}, 0),
+		Store:                 store,
+		Debug:                 config.GetBool("debug"),
+		LogRequests:           config.GetBool("log_requests"),
+		RedisMode:             redisMode,
+		RedisOptions:          &redisOptions,
+		RedisSentinelPassword: config.GetString("redis_sentinel_password"),
+		Address:               address,
+		MetricsPort:           config.GetInt("metrics_port"),
+		Token:                 config.GetString("token"),
+		Tokens:                tokens,
+		StoreTokens:           config.GetBool("store_tokens"),
+		TokenCacheDuration:    tokenCacheDuration,
+		QuitChannel:           make(chan struct{}, 0),
 		Jwt: JwtOptions{
-			JwtSecret: viper.GetString("jwt_secret"),
+			JwtSecret: config.GetString("jwt_secret"),
+		},
+		Tracing: TracingOptions{
+			Endpoint:    config.GetString("tracing_endpoint"),
+			Insecure:    config.GetBool("tracing_insecure"),
+			SampleRatio: tracingSampleRatio,
+		},
+		Tls: tlsOptions,
+		RateLimit: RateLimitOptions{
+			Window:     rateLimitWindow,
+			Send:       config.GetInt("rate_limit_send"),
+			Claim:      config.GetInt("rate_limit_claim"),
+			Disconnect: config.GetInt("rate_limit_disconnect"),
+			ByTarget:   config.GetBool("rate_limit_by_target"),
 		},
 		DefaultChannels: UniqueString(RemoveEmpty(
-			strings.Split(viper.GetString("default_channels"), ","),
+			strings.Split(config.GetString("default_channels"), ","),
 		)),
-		MessagingMethod: messagingMethod,
-		DirectHostname:  directHostname,
-		DirectPort:      directPort,
-		Port:            port,
-		TtlDuration:     ttlDuration,
+		MessagingMethod:            messagingMethod,
+		ChannelFanout:              channelFanout,
+		DirectHostname:             directHostname,
+		DirectPort:                 directPort,
+		DirectAuth:                 directAuth,
+		DirectHmacSecret:           directHmacSecret,
+		DirectMaxBodySize:          config.GetInt64("direct_max_body_size"),
+		DirectListenAddress:        directListenAddress,
+		DirectTls:                  directTls,
+		DirectClientTls:            directClientTls,
+		PublicUrl:                  strings.TrimSuffix(config.GetString("public_url"), "/"),
+		Region:                     config.GetString("region"),
+		PublishEvents:              config.GetBool("publish_events"),
+		Port:                       port,
+		TtlDuration:                ttlDuration,
+		StreamMaxLength:            config.GetInt64("redis_streams_max_length"),
+		StreamMaxAge:               streamMaxAge,
+		DegradedDisconnectAfter:    degradedDisconnectAfter,
+		PingInterval:               pingInterval,
+		PongTimeout:                pongTimeout,
+		IdleTimeout:                idleTimeout,
+		MaxFrameSize:               config.GetInt64("max_frame_size"),
+		MaxMessagesPerSecond:       config.GetInt("max_messages_per_second"),
+		MaxConnectsPerIp:           config.GetInt("max_connects_per_ip"),
+		ConnectRateWindow:          connectRateWindow,
+		TrustedProxies:             trustedProxies,
+		MaxConnectionsPerUser:      config.GetInt("max_connections_per_user"),
+		MaxConnectionsPerSession:   config.GetInt("max_connections_per_session"),
+		ConnectionLimitPolicy:      connectionLimitPolicy,
+		SingleConnectionPerSession: config.GetBool("single_connection_per_session"),
+		MaxConnections:             config.GetInt("max_connections"),
+		MaxGoroutines:              config.GetInt("max_goroutines"),
+		MaxMemory:                  uint64(config.GetInt64("max_memory_mb")) * 1024 * 1024,
+		LoadReportInterval:         loadReportInterval,
+		DrainWindow:                drainWindow,
+		DrainRetryJitter:           drainRetryJitter,
+		SendQueueSize:              sendQueueSize,
+		SendQueuePolicy:            sendQueuePolicy,
 	}, nil
 }
 
+/// TLS versions by their tls_min_version name
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+/// Gets the TLS options, validating the TLS version & cipher suites
+func getTlsOptions(config *viper.Viper) (TlsOptions, error) {
+	tlsOptions := TlsOptions{
+		CertFile:     config.GetString("tls_cert_file"),
+		KeyFile:      config.GetString("tls_key_file"),
+		ClientCaFile: config.GetString("tls_client_ca_file"),
+		ClientAuth:   config.GetString("tls_client_auth"),
+	}
+
+	if (tlsOptions.CertFile == "") != (tlsOptions.KeyFile == "") {
+		return tlsOptions, errors.New("tls_cert_file and tls_key_file must be set together")
+	}
+
+	if tlsOptions.ClientAuth != TlsClientAuthRequire && tlsOptions.ClientAuth != TlsClientAuthVerifyIfGiven {
+		return tlsOptions, errors.New("invalid TLS client auth")
+	}
+
+	minVersion, ok := tlsVersions[config.GetString("tls_min_version")]
+	if !ok {
+		return tlsOptions, errors.New("invalid TLS min version")
+	}
+	tlsOptions.MinVersion = minVersion
+
+	cipherSuites := make(map[string]uint16)
+	for _, cipherSuite := range tls.CipherSuites() {
+		cipherSuites[cipherSuite.Name] = cipherSuite.ID
+	}
+
+	for _, name := range RemoveEmpty(strings.Split(config.GetString("tls_cipher_suites"), ",")) {
+		id, ok := cipherSuites[strings.TrimSpace(name)]
+		if !ok {
+			return tlsOptions, errors.New("invalid TLS cipher suite: " + name)
+		}
+
+		tlsOptions.CipherSuites = append(tlsOptions.CipherSuites, id)
+	}
+
+	reloadInterval, err := time.ParseDuration(config.GetString("tls_reload_interval"))
+	if err != nil {
+		return tlsOptions, err
+	}
+	tlsOptions.ReloadInterval = reloadInterval
+
+	return tlsOptions, nil
+}
+
+/// Gets the API tokens from the config (tokens tables), or from a JSON array (such as from DSOCK_TOKENS)
+func getTokens(config *viper.Viper) ([]ApiToken, error) {
+	var tokens []ApiToken
+
+	if rawTokens, ok := config.Get("tokens").(string); ok {
+		if rawTokens != "" {
+			var parsedTokens interface{}
+
+			err := json.Unmarshal([]byte(rawTokens), &parsedTokens)
+			if err == nil {
+				// Decoded like the config, as the JSON representation of tokens excludes the secret
+				err = mapstructure.Decode(parsedTokens, &tokens)
+			}
+			if err != nil {
+				return nil, errors.New("invalid tokens: " + err.Error())
+			}
+		}
+	} else {
+		err := config.UnmarshalKey("tokens", &tokens)
+		if err != nil {
+			return nil, errors.New("invalid tokens: " + err.Error())
+		}
+	}
+
+	names := make(map[string]struct{})
+	secrets := map[string]struct{}{
+		config.GetString("token"): {},
+	}
+
+	for index := range tokens {
+		token := &tokens[index]
+
+		err := token.Validate()
+		if err != nil {
+			return nil, err
+		}
+
+		if token.Token == "" {
+			return nil, errors.New("token " + token.Name + " has no token")
+		}
+
+		if _, exists := names[token.Name]; exists {
+			return nil, errors.New("token name " + token.Name + " is used multiple times")
+		}
+		names[token.Name] = struct{}{}
+
+		if _, exists := secrets[token.Token]; exists {
+			return nil, errors.New("token " + token.Name + " has the same token as another token")
+		}
+		secrets[token.Token] = struct{}{}
+	}
+
+	return tokens, nil
+}
+
 func GetLocalIP() string {
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
@@ -0,0 +1,85 @@
+package common_test
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+type OptionsSuite struct {
+	suite.Suite
+}
+
+func TestOptionsSuite(t *testing.T) {
+	suite.Run(t, new(OptionsSuite))
+}
+
+func (suite *OptionsSuite) TestDefaultOptions() {
+	options, err := common.DefaultOptions(true)
+	suite.Require().NoError(err)
+
+	suite.Equal(common.StoreRedis, options.Store, "Incorrect store")
+	suite.Equal([]string{"localhost:6379"}, options.RedisOptions.Addrs, "Incorrect Redis address")
+	suite.Equal(common.MessageMethodRedis, options.MessagingMethod, "Incorrect messaging method")
+	suite.Equal(":6241", options.Address, "Incorrect address")
+	suite.Equal(time.Second*30, options.PingInterval, "Incorrect ping interval")
+	suite.Equal(256, options.SendQueueSize, "Incorrect send queue size")
+	suite.Equal(common.SendQueuePolicyDropOldest, options.SendQueuePolicy, "Incorrect send queue policy")
+	suite.Equal(int64(65536), options.MaxFrameSize, "Incorrect max frame size")
+	suite.NotNil(options.QuitChannel, "Quit channel should be created")
+}
+
+/// Gets the options (as a worker) from the environment variables, in an empty directory
+func (suite *OptionsSuite) getOptions(env map[string]string) (*common.DSockOptions, error) {
+	workingDir, err := os.Getwd()
+	suite.Require().NoError(err)
+
+	dir, err := ioutil.TempDir("", "dsock-options")
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(os.Chdir(dir))
+	defer func() {
+		_ = os.Chdir(workingDir)
+		_ = os.RemoveAll(dir)
+	}()
+
+	for key, value := range env {
+		suite.Require().NoError(os.Setenv(key, value))
+	}
+	defer func() {
+		for key := range env {
+			_ = os.Unsetenv(key)
+		}
+	}()
+
+	return common.GetOptions(true)
+}
+
+func (suite *OptionsSuite) TestDirectRequiresSecret() {
+	_, err := suite.getOptions(map[string]string{
+		"DSOCK_MESSAGING_METHOD": common.MessageMethodDirect,
+	})
+	suite.Error(err, "Direct messaging should require a token")
+
+	_, err = suite.getOptions(map[string]string{
+		"DSOCK_MESSAGING_METHOD": common.MessageMethodDirect,
+		"DSOCK_DIRECT_AUTH":      common.DirectAuthHmac,
+	})
+	suite.Error(err, "HMAC direct auth should require a secret")
+
+	_, err = suite.getOptions(map[string]string{
+		"DSOCK_MESSAGING_METHOD": common.MessageMethodDirect,
+		"DSOCK_TOKEN":            "abc",
+	})
+	suite.NoError(err)
+
+	_, err = suite.getOptions(map[string]string{
+		"DSOCK_MESSAGING_METHOD":   common.MessageMethodDirect,
+		"DSOCK_DIRECT_AUTH":        common.DirectAuthHmac,
+		"DSOCK_DIRECT_HMAC_SECRET": "secret",
+	})
+	suite.NoError(err)
+}
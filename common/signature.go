@@ -0,0 +1,84 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/// Header of the HMAC signature of direct messages (hmac direct auth), in the format of `t=$TIMESTAMP,v1=$SIGNATURE`
+const DirectSignatureHeader = "X-DSock-Signature"
+
+/// How old (or in the future) a signature can be, to limit replaying direct messages
+const DirectSignatureTolerance = 5 * time.Minute
+
+/// HMAC-SHA256 of the timestamp, path & body
+func directSignature(secret string, timestamp string, path string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + path + "."))
+	mac.Write(body)
+
+	return mac.Sum(nil)
+}
+
+/// Signs a direct message request to a worker, returning the signature header's value
+func SignDirectRequest(secret string, path string, body []byte, now time.Time) string {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(directSignature(secret, timestamp, path, body))
+}
+
+/// Parses the signature header's value into its timestamp & signature.
+/// Returns false if either is missing or invalid, without checking the signature
+func ParseDirectSignature(signature string) (timestamp string, mac []byte, ok bool) {
+	var expected string
+
+	for _, part := range strings.Split(signature, ",") {
+		if strings.HasPrefix(part, "t=") {
+			timestamp = part[2:]
+		} else if strings.HasPrefix(part, "v1=") {
+			expected = part[3:]
+		}
+	}
+
+	if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+		return "", nil, false
+	}
+
+	mac, err := hex.DecodeString(expected)
+	if err != nil || len(mac) == 0 {
+		return "", nil, false
+	}
+
+	return timestamp, mac, true
+}
+
+/// Verifies the signature header's value of a direct message request, and that it is recent
+func VerifyDirectRequest(secret string, path string, body []byte, signature string, now time.Time) bool {
+	timestamp, expectedMac, ok := ParseDirectSignature(signature)
+	if !ok {
+		return false
+	}
+
+	signedAt, _ := strconv.ParseInt(timestamp, 10, 64)
+
+	age := now.Sub(time.Unix(signedAt, 0))
+	if age > DirectSignatureTolerance || age < -DirectSignatureTolerance {
+		return false
+	}
+
+	return hmac.Equal(expectedMac, directSignature(secret, timestamp, path, body))
+}
+
+/// Authenticates a direct message request to a worker, with the token or an HMAC signature of the body
+func AuthorizeDirectRequest(options *DSockOptions, req *http.Request, path string, body []byte) {
+	if options.DirectAuth == DirectAuthHmac {
+		req.Header.Set(DirectSignatureHeader, SignDirectRequest(options.DirectHmacSecret, path, body, time.Now()))
+	} else {
+		req.Header.Set("Authorization", "Bearer "+options.Token)
+	}
+}
@@ -0,0 +1,46 @@
+package common_test
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+type SignatureSuite struct {
+	suite.Suite
+}
+
+func TestSignatureSuite(t *testing.T) {
+	suite.Run(t, new(SignatureSuite))
+}
+
+func (suite *SignatureSuite) TestParse() {
+	signature := common.SignDirectRequest("secret", common.PathReceiveMessage, []byte("message"), time.Unix(1600000000, 0))
+
+	timestamp, mac, ok := common.ParseDirectSignature(signature)
+	suite.True(ok, "Valid signature should be parsed")
+	suite.Equal("1600000000", timestamp, "Incorrect timestamp")
+	suite.Len(mac, 32, "Incorrect signature length")
+
+	for _, invalid := range []string{"", "t=1600000000", "v1=abcd", "t=abc,v1=abcd", "t=1600000000,v1=xyz", "t=1600000000,v1="} {
+		_, _, ok := common.ParseDirectSignature(invalid)
+		suite.Falsef(ok, "Invalid signature should be rejected: %s", invalid)
+	}
+}
+
+func (suite *SignatureSuite) TestVerify() {
+	now := time.Now()
+	body := []byte("message")
+	signature := common.SignDirectRequest("secret", common.PathReceiveMessage, body, now)
+
+	suite.True(common.VerifyDirectRequest("secret", common.PathReceiveMessage, body, signature, now))
+	suite.True(common.VerifyDirectRequest("secret", common.PathReceiveMessage, body, signature, now.Add(time.Minute)))
+
+	suite.False(common.VerifyDirectRequest("other", common.PathReceiveMessage, body, signature, now), "Secret should be verified")
+	suite.False(common.VerifyDirectRequest("secret", common.PathReceiveChannelMessage, body, signature, now), "Path should be verified")
+	suite.False(common.VerifyDirectRequest("secret", common.PathReceiveMessage, []byte("other"), signature, now), "Body should be verified")
+	suite.False(common.VerifyDirectRequest("secret", common.PathReceiveMessage, body, signature, now.Add(time.Hour)), "Old signatures should be rejected")
+	suite.False(common.VerifyDirectRequest("secret", common.PathReceiveMessage, body, "", now), "Missing signature should be rejected")
+	suite.False(common.VerifyDirectRequest("secret", common.PathReceiveMessage, body, "t=abc,v1=xyz", now), "Invalid signature should be rejected")
+}
@@ -0,0 +1,726 @@
+package store
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/// How often expired claims/connections/workers are removed from memory
+const memoryCleanupInterval = time.Second * 10
+
+/// Size of the buffer of messages waiting to be handled per subscription.
+/// Messages published to a subscription with a full buffer are dropped, so that a stalled subscriber doesn't block publishers
+const memorySubscriptionBuffer = 1024
+
+/// Set of IDs, indexed by key (user, channel, etc)
+type memoryIndex map[string]map[string]struct{}
+
+func (index memoryIndex) Add(key string, id string) {
+	ids, exists := index[key]
+	if !exists {
+		ids = make(map[string]struct{})
+		index[key] = ids
+	}
+
+	ids[id] = struct{}{}
+}
+
+func (index memoryIndex) Remove(key string, id string) {
+	ids, exists := index[key]
+	if !exists {
+		return
+	}
+
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(index, key)
+	}
+}
+
+func (index memoryIndex) Get(key string) []string {
+	ids := make([]string, 0, len(index[key]))
+	for id := range index[key] {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+type memoryConnection struct {
+	connection Connection
+	expiration time.Time
+}
+
+/// Request counts of the current and previous fixed windows of a rate limit
+type memoryRateLimit struct {
+	index      int64
+	current    int64
+	previous   int64
+	expiration time.Time
+}
+
+type memoryWorker struct {
+	worker     Worker
+	expiration time.Time
+}
+
+type memorySubscription struct {
+	messages chan memoryMessage
+	quit     chan struct{}
+	store    *MemoryStore
+	/// Worker ID or channel topics the subscription receives messages for
+	keys []string
+}
+
+type memoryMessage struct {
+	messageType string
+	payload     []byte
+}
+
+func (subscription *memorySubscription) Close() error {
+	subscription.store.mutex.Lock()
+	defer subscription.store.mutex.Unlock()
+
+	for _, key := range subscription.keys {
+		subscription.store.removeSubscription(key, subscription)
+	}
+	subscription.keys = nil
+
+	close(subscription.quit)
+
+	return nil
+}
+
+func (subscription *memorySubscription) Subscribe(channels ...string) error {
+	subscription.store.mutex.Lock()
+	defer subscription.store.mutex.Unlock()
+
+	for _, channel := range channels {
+		key := channelTopic(channel)
+		if common.IncludesString(subscription.keys, key) {
+			continue
+		}
+
+		subscription.keys = append(subscription.keys, key)
+		subscription.store.subscriptions[key] = append(subscription.store.subscriptions[key], subscription)
+	}
+
+	return nil
+}
+
+func (subscription *memorySubscription) Unsubscribe(channels ...string) error {
+	subscription.store.mutex.Lock()
+	defer subscription.store.mutex.Unlock()
+
+	for _, channel := range channels {
+		key := channelTopic(channel)
+
+		subscription.keys = common.RemoveString(subscription.keys, key)
+		subscription.store.removeSubscription(key, subscription)
+	}
+
+	return nil
+}
+
+/// Must be called with the store's lock held
+func (store *MemoryStore) removeSubscription(key string, subscription *memorySubscription) {
+	subscriptions := store.subscriptions[key]
+	for index, value := range subscriptions {
+		if value == subscription {
+			subscriptions = append(subscriptions[:index], subscriptions[index+1:]...)
+			break
+		}
+	}
+
+	if len(subscriptions) == 0 {
+		delete(store.subscriptions, key)
+	} else {
+		store.subscriptions[key] = subscriptions
+	}
+}
+
+/// Store kept in memory, for running a single dSock process without Redis (development, edge devices, tests)
+type MemoryStore struct {
+	claims            map[string]Claim
+	claimUsers        memoryIndex
+	claimUserSessions memoryIndex
+	claimChannels     memoryIndex
+	connections       map[string]*memoryConnection
+	users             memoryIndex
+	channels          memoryIndex
+	workers           map[string]*memoryWorker
+	rateLimits        map[string]*memoryRateLimit
+	/// API tokens (without the secret), by the hash of their secret
+	tokens map[string]common.ApiToken
+	/// Subscriptions by worker ID, channel topic or the events topic
+	subscriptions map[string][]*memorySubscription
+	quit          chan struct{}
+	mutex         sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	store := &MemoryStore{
+		claims:            make(map[string]Claim),
+		claimUsers:        make(memoryIndex),
+		claimUserSessions: make(memoryIndex),
+		claimChannels:     make(memoryIndex),
+		connections:       make(map[string]*memoryConnection),
+		users:             make(memoryIndex),
+		channels:          make(memoryIndex),
+		workers:           make(map[string]*memoryWorker),
+		rateLimits:        make(map[string]*memoryRateLimit),
+		tokens:            make(map[string]common.ApiToken),
+		subscriptions:     make(map[string][]*memorySubscription),
+		quit:              make(chan struct{}),
+	}
+
+	go store.cleanup()
+
+	return store
+}
+
+func copyStrings(texts []string) []string {
+	return append([]string{}, texts...)
+}
+
+/// Key of a user session. Prefixed by the user's length, so that users & sessions containing separators can't collide
+func userSession(user string, session string) string {
+	return strconv.Itoa(len(user)) + ":" + user + ":" + session
+}
+
+func (store *MemoryStore) cleanup() {
+	ticker := time.NewTicker(memoryCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-store.quit:
+			return
+		case <-ticker.C:
+		}
+
+		store.mutex.Lock()
+
+		now := time.Now()
+
+		for id, claim := range store.claims {
+			if claim.Expiration.Before(now) {
+				store.deleteClaim(id)
+			}
+		}
+
+		for _, entry := range store.connections {
+			if entry.expiration.Before(now) {
+				store.deleteConnection(&entry.connection)
+			}
+		}
+
+		for id, entry := range store.workers {
+			if entry.expiration.Before(now) {
+				delete(store.workers, id)
+			}
+		}
+
+		for key, entry := range store.rateLimits {
+			if entry.expiration.Before(now) {
+				delete(store.rateLimits, key)
+			}
+		}
+
+		store.mutex.Unlock()
+	}
+}
+
+func (store *MemoryStore) CreateClaim(claim *Claim) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	storedClaim := *claim
+	storedClaim.Channels = copyStrings(claim.Channels)
+
+	store.claims[claim.Id] = storedClaim
+
+	store.claimUsers.Add(claim.User, claim.Id)
+	if claim.Session != "" {
+		store.claimUserSessions.Add(userSession(claim.User, claim.Session), claim.Id)
+	}
+	for _, channel := range claim.Channels {
+		store.claimChannels.Add(channel, claim.Id)
+	}
+
+	return nil
+}
+
+func (store *MemoryStore) ClaimExists(id string) (bool, error) {
+	claim, err := store.GetClaim(id)
+
+	return claim != nil && claim.Expiration.After(time.Now()), err
+}
+
+func (store *MemoryStore) GetClaim(id string) (*Claim, error) {
+	claims, err := store.GetClaims([]string{id})
+	if err != nil || len(claims) == 0 {
+		return nil, err
+	}
+
+	return claims[0], nil
+}
+
+func (store *MemoryStore) GetClaims(ids []string) ([]*Claim, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	claims := make([]*Claim, 0, len(ids))
+
+	for _, id := range ids {
+		claim, exists := store.claims[id]
+
+		if !exists {
+			// Claim doesn't exist
+			continue
+		}
+
+		claim.Channels = copyStrings(claim.Channels)
+		claims = append(claims, &claim)
+	}
+
+	return claims, nil
+}
+
+func (store *MemoryStore) DeleteClaims(ids []string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, id := range ids {
+		store.deleteClaim(id)
+	}
+
+	return nil
+}
+
+/// Must be called with lock held
+func (store *MemoryStore) deleteClaim(id string) {
+	claim, exists := store.claims[id]
+	if !exists {
+		return
+	}
+
+	delete(store.claims, id)
+
+	store.claimUsers.Remove(claim.User, id)
+	if claim.Session != "" {
+		store.claimUserSessions.Remove(userSession(claim.User, claim.Session), id)
+	}
+	for _, channel := range claim.Channels {
+		store.claimChannels.Remove(channel, id)
+	}
+}
+
+func (store *MemoryStore) ResolveClaims(target common.ResolveOptions) ([]string, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if target.Session != "" {
+		return store.claimUserSessions.Get(userSession(target.User, target.Session)), nil
+	} else if target.Channel != "" {
+		return store.claimChannels.Get(target.Channel), nil
+	} else if target.User != "" {
+		return store.claimUsers.Get(target.User), nil
+	}
+
+	return []string{}, nil
+}
+
+func (store *MemoryStore) AddClaimsChannel(ids []string, channel string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, id := range ids {
+		claim, exists := store.claims[id]
+		if !exists || common.IncludesString(claim.Channels, channel) {
+			continue
+		}
+
+		claim.Channels = append(copyStrings(claim.Channels), channel)
+		store.claims[id] = claim
+		store.claimChannels.Add(channel, id)
+	}
+
+	return nil
+}
+
+func (store *MemoryStore) RemoveClaimsChannel(ids []string, channel string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, id := range ids {
+		claim, exists := store.claims[id]
+		if !exists || !common.IncludesString(claim.Channels, channel) {
+			continue
+		}
+
+		claim.Channels = common.RemoveString(copyStrings(claim.Channels), channel)
+		store.claims[id] = claim
+		store.claimChannels.Remove(channel, id)
+	}
+
+	return nil
+}
+
+func (store *MemoryStore) SetConnections(connections []*Connection, ttl time.Duration) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, connection := range connections {
+		storedConnection := *connection
+		storedConnection.Channels = copyStrings(connection.Channels)
+
+		store.connections[connection.Id] = &memoryConnection{
+			connection: storedConnection,
+			expiration: time.Now().Add(ttl),
+		}
+
+		store.users.Add(connection.User, connection.Id)
+		for _, channel := range connection.Channels {
+			store.channels.Add(channel, connection.Id)
+		}
+	}
+
+	return nil
+}
+
+func (store *MemoryStore) DeleteConnection(connection *Connection) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.deleteConnection(connection)
+
+	return nil
+}
+
+/// Must be called with lock held
+func (store *MemoryStore) deleteConnection(connection *Connection) {
+	delete(store.connections, connection.Id)
+
+	store.users.Remove(connection.User, connection.Id)
+	for _, channel := range connection.Channels {
+		store.channels.Remove(channel, connection.Id)
+	}
+}
+
+func (store *MemoryStore) AddConnectionChannel(connection *Connection, channel string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.channels.Add(channel, connection.Id)
+	if entry, exists := store.connections[connection.Id]; exists {
+		entry.connection.Channels = copyStrings(connection.Channels)
+	}
+
+	return nil
+}
+
+func (store *MemoryStore) RemoveConnectionChannel(connection *Connection, channel string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.channels.Remove(channel, connection.Id)
+	if entry, exists := store.connections[connection.Id]; exists {
+		entry.connection.Channels = copyStrings(connection.Channels)
+	}
+
+	return nil
+}
+
+func (store *MemoryStore) ResolveConnections(target common.ResolveOptions) ([]*Connection, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	var connectionIds []string
+
+	if target.Connection != "" {
+		connectionIds = []string{target.Connection}
+	} else if target.Channel != "" {
+		connectionIds = store.channels.Get(target.Channel)
+	} else if target.User != "" {
+		connectionIds = store.users.Get(target.User)
+	} else {
+		return []*Connection{}, nil
+	}
+
+	connections := make([]*Connection, 0, len(connectionIds))
+
+	for _, connectionId := range connectionIds {
+		entry, exists := store.connections[connectionId]
+
+		if !exists || entry.expiration.Before(time.Now()) {
+			// Connection doesn't exist or has expired
+			continue
+		}
+
+		// Target specific session(s) for user if set
+		if target.Connection == "" && target.Channel == "" &&
+			target.Session != "" && entry.connection.Session != target.Session {
+			continue
+		}
+
+		connection := entry.connection
+		connection.Channels = copyStrings(connection.Channels)
+		connections = append(connections, &connection)
+	}
+
+	return connections, nil
+}
+
+func (store *MemoryStore) SetWorker(worker *Worker, ttl time.Duration) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.workers[worker.Id] = &memoryWorker{
+		worker:     *worker,
+		expiration: time.Now().Add(ttl),
+	}
+
+	return nil
+}
+
+func (store *MemoryStore) GetWorkers(ids []string) ([]*Worker, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	workers := make([]*Worker, 0, len(ids))
+
+	for _, id := range ids {
+		entry, exists := store.workers[id]
+
+		if !exists || entry.expiration.Before(time.Now()) {
+			// Worker doesn't exist or has expired
+			continue
+		}
+
+		worker := entry.worker
+		workers = append(workers, &worker)
+	}
+
+	return workers, nil
+}
+
+func (store *MemoryStore) ListWorkers() ([]*Worker, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	workers := make([]*Worker, 0, len(store.workers))
+
+	for _, entry := range store.workers {
+		if entry.expiration.Before(time.Now()) {
+			continue
+		}
+
+		worker := entry.worker
+		workers = append(workers, &worker)
+	}
+
+	return workers, nil
+}
+
+func (store *MemoryStore) DeleteWorker(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.workers, id)
+
+	return nil
+}
+
+func (store *MemoryStore) CreateToken(token *common.ApiToken) (bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, storedToken := range store.tokens {
+		if storedToken.Name == token.Name {
+			return false, nil
+		}
+	}
+
+	storedToken := *token
+	storedToken.Token = ""
+	storedToken.Scopes = copyStrings(token.Scopes)
+	storedToken.Channels = copyStrings(token.Channels)
+	storedToken.UserPrefixes = copyStrings(token.UserPrefixes)
+
+	store.tokens[common.HashToken(token.Token)] = storedToken
+
+	return true, nil
+}
+
+func (store *MemoryStore) GetToken(hash string) (*common.ApiToken, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	token, exists := store.tokens[hash]
+	if !exists {
+		return nil, nil
+	}
+
+	return &token, nil
+}
+
+func (store *MemoryStore) ListTokens() ([]*common.ApiToken, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	tokens := make([]*common.ApiToken, 0, len(store.tokens))
+
+	for _, token := range store.tokens {
+		token := token
+		tokens = append(tokens, &token)
+	}
+
+	return tokens, nil
+}
+
+func (store *MemoryStore) DeleteToken(name string) (bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for hash, token := range store.tokens {
+		if token.Name == name {
+			delete(store.tokens, hash)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (store *MemoryStore) RateLimit(key string, limit int, window time.Duration) (*RateLimit, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := time.Now()
+	index, elapsed := rateLimitWindow(now, window)
+
+	entry, exists := store.rateLimits[key]
+	if !exists {
+		entry = &memoryRateLimit{index: index}
+		store.rateLimits[key] = entry
+	}
+
+	// Move to the current window
+	if entry.index == index-1 {
+		entry.previous = entry.current
+		entry.current = 0
+	} else if entry.index != index {
+		entry.previous = 0
+		entry.current = 0
+	}
+	entry.index = index
+	entry.expiration = now.Add(window * 2)
+
+	count := slidingWindowCount(entry.previous, entry.current, elapsed, window)
+	if count+1 > float64(limit) {
+		return newRateLimit(false, count, limit, elapsed, window), nil
+	}
+
+	entry.current++
+
+	return newRateLimit(true, count+1, limit, elapsed, window), nil
+}
+
+func (store *MemoryStore) Publish(workerIds []string, messageType string, payload []byte) error {
+	store.publish(workerIds, messageType, payload)
+
+	return nil
+}
+
+func (store *MemoryStore) PublishChannel(channel string, messageType string, payload []byte) error {
+	store.publish([]string{channelTopic(channel)}, messageType, payload)
+
+	return nil
+}
+
+func (store *MemoryStore) publish(keys []string, messageType string, payload []byte) {
+	store.mutex.RLock()
+	subscriptions := make([]*memorySubscription, 0)
+	for _, key := range keys {
+		subscriptions = append(subscriptions, store.subscriptions[key]...)
+	}
+	store.mutex.RUnlock()
+
+	for _, subscription := range subscriptions {
+		select {
+		case subscription.messages <- memoryMessage{messageType: messageType, payload: payload}:
+		case <-subscription.quit:
+		default:
+			memoryDroppedMessages.Inc()
+		}
+	}
+}
+
+func (store *MemoryStore) Subscribe(workerId string, handler MessageHandler, _ StatusHandler) (Subscription, error) {
+	subscription := store.subscribe(handler)
+
+	store.mutex.Lock()
+	subscription.keys = []string{workerId}
+	store.subscriptions[workerId] = append(store.subscriptions[workerId], subscription)
+	store.mutex.Unlock()
+
+	return subscription, nil
+}
+
+func (store *MemoryStore) SubscribeChannels(handler MessageHandler, _ StatusHandler) (ChannelSubscription, error) {
+	return store.subscribe(handler), nil
+}
+
+func (store *MemoryStore) PublishEvent(payload []byte) error {
+	store.publish([]string{eventsTopic}, "", payload)
+
+	return nil
+}
+
+func (store *MemoryStore) SubscribeEvents(handler EventHandler, _ StatusHandler) (Subscription, error) {
+	subscription := store.subscribe(func(_ string, payload []byte) {
+		handler(payload)
+	})
+
+	store.mutex.Lock()
+	subscription.keys = []string{eventsTopic}
+	store.subscriptions[eventsTopic] = append(store.subscriptions[eventsTopic], subscription)
+	store.mutex.Unlock()
+
+	return subscription, nil
+}
+
+/// Creates a subscription (without keys), handling its messages sequentially
+func (store *MemoryStore) subscribe(handler MessageHandler) *memorySubscription {
+	subscription := &memorySubscription{
+		messages: make(chan memoryMessage, memorySubscriptionBuffer),
+		quit:     make(chan struct{}),
+		store:    store,
+	}
+
+	go func() {
+		for {
+			select {
+			case <-subscription.quit:
+				return
+			case message := <-subscription.messages:
+				handler(message.messageType, message.payload)
+			}
+		}
+	}()
+
+	return subscription
+}
+
+func (store *MemoryStore) Ping() error {
+	return nil
+}
+
+func (store *MemoryStore) Close() error {
+	close(store.quit)
+
+	return nil
+}
@@ -0,0 +1,461 @@
+package store_test
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/common/store"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+type MemoryStoreSuite struct {
+	suite.Suite
+	store *store.MemoryStore
+}
+
+func TestMemoryStoreSuite(t *testing.T) {
+	suite.Run(t, new(MemoryStoreSuite))
+}
+
+func (suite *MemoryStoreSuite) SetupTest() {
+	suite.store = store.NewMemoryStore()
+}
+
+func (suite *MemoryStoreSuite) TearDownTest() {
+	_ = suite.store.Close()
+}
+
+func (suite *MemoryStoreSuite) TestClaims() {
+	err := suite.store.CreateClaim(&store.Claim{
+		Id:         "claim",
+		User:       "user",
+		Session:    "session",
+		Channels:   []string{"channel"},
+		Expiration: time.Now().Add(time.Minute),
+	})
+	if !suite.NoError(err) {
+		return
+	}
+
+	exists, err := suite.store.ClaimExists("claim")
+	if !suite.NoError(err) || !suite.True(exists, "Claim should exist") {
+		return
+	}
+
+	for _, target := range []common.ResolveOptions{
+		{User: "user"},
+		{User: "user", Session: "session"},
+		{Channel: "channel"},
+	} {
+		claimIds, err := suite.store.ResolveClaims(target)
+		if !suite.NoError(err) {
+			return
+		}
+
+		if !suite.Equal([]string{"claim"}, claimIds, "Incorrect resolved claims") {
+			return
+		}
+	}
+
+	err = suite.store.AddClaimsChannel([]string{"claim"}, "other_channel")
+	if !suite.NoError(err) {
+		return
+	}
+
+	claim, err := suite.store.GetClaim("claim")
+	if !suite.NoError(err) {
+		return
+	}
+
+	if !suite.Equal([]string{"channel", "other_channel"}, claim.Channels, "Incorrect claim channels") {
+		return
+	}
+
+	err = suite.store.DeleteClaims([]string{"claim"})
+	if !suite.NoError(err) {
+		return
+	}
+
+	claimIds, err := suite.store.ResolveClaims(common.ResolveOptions{Channel: "other_channel"})
+	if !suite.NoError(err) {
+		return
+	}
+
+	suite.Empty(claimIds, "Claim should be removed from channel")
+}
+
+func (suite *MemoryStoreSuite) TestConnections() {
+	err := suite.store.SetConnections([]*store.Connection{
+		{
+			Id:       "connection_1",
+			User:     "user",
+			Session:  "session_1",
+			WorkerId: "worker",
+			Channels: []string{"channel"},
+		},
+		{
+			Id:       "connection_2",
+			User:     "user",
+			Session:  "session_2",
+			WorkerId: "worker",
+		},
+	}, time.Minute)
+	if !suite.NoError(err) {
+		return
+	}
+
+	connections, err := suite.store.ResolveConnections(common.ResolveOptions{User: "user"})
+	if !suite.NoError(err) || !suite.Len(connections, 2, "Incorrect connection count") {
+		return
+	}
+
+	connections, err = suite.store.ResolveConnections(common.ResolveOptions{User: "user", Session: "session_2"})
+	if !suite.NoError(err) || !suite.Len(connections, 1, "Incorrect connection count") {
+		return
+	}
+
+	if !suite.Equal("connection_2", connections[0].Id, "Incorrect connection") {
+		return
+	}
+
+	connections, err = suite.store.ResolveConnections(common.ResolveOptions{Channel: "channel"})
+	if !suite.NoError(err) || !suite.Len(connections, 1, "Incorrect connection count") {
+		return
+	}
+
+	connection := connections[0]
+	connection.Channels = []string{}
+
+	err = suite.store.RemoveConnectionChannel(connection, "channel")
+	if !suite.NoError(err) {
+		return
+	}
+
+	connections, err = suite.store.ResolveConnections(common.ResolveOptions{Channel: "channel"})
+	if !suite.NoError(err) || !suite.Empty(connections, "Connection should be removed from channel") {
+		return
+	}
+
+	err = suite.store.DeleteConnection(connection)
+	if !suite.NoError(err) {
+		return
+	}
+
+	connections, err = suite.store.ResolveConnections(common.ResolveOptions{Connection: "connection_1"})
+	if !suite.NoError(err) {
+		return
+	}
+
+	suite.Empty(connections, "Connection should be deleted")
+}
+
+func (suite *MemoryStoreSuite) TestWorkers() {
+	err := suite.store.SetWorker(&store.Worker{
+		Id:        "worker_1",
+		PublicUrl: "wss://worker-1.example.com",
+		Region:    "us-east",
+		Load:      store.WorkerLoad{Connections: 10},
+	}, time.Minute)
+	if !suite.NoError(err) {
+		return
+	}
+
+	err = suite.store.SetWorker(&store.Worker{Id: "worker_2"}, -time.Second)
+	if !suite.NoError(err) {
+		return
+	}
+
+	workers, err := suite.store.ListWorkers()
+	if !suite.NoError(err) || !suite.Len(workers, 1, "Expired worker should not be listed") {
+		return
+	}
+
+	if !suite.Equal("wss://worker-1.example.com", workers[0].PublicUrl, "Incorrect public URL") ||
+		!suite.Equal("us-east", workers[0].Region, "Incorrect region") ||
+		!suite.Equal(10, workers[0].Load.Connections, "Incorrect load") {
+		return
+	}
+
+	err = suite.store.DeleteWorker("worker_1")
+	if !suite.NoError(err) {
+		return
+	}
+
+	workers, err = suite.store.ListWorkers()
+	if !suite.NoError(err) {
+		return
+	}
+
+	suite.Empty(workers, "Worker should be deleted")
+}
+
+func (suite *MemoryStoreSuite) TestRateLimit() {
+	for index := 0; index < 3; index++ {
+		rateLimit, err := suite.store.RateLimit("key", 3, time.Hour)
+		if !suite.NoError(err) || !suite.True(rateLimit.Allowed, "Request should be allowed") {
+			return
+		}
+
+		if !suite.Equal(2-index, rateLimit.Remaining, "Incorrect remaining requests") {
+			return
+		}
+	}
+
+	rateLimit, err := suite.store.RateLimit("key", 3, time.Hour)
+	if !suite.NoError(err) || !suite.False(rateLimit.Allowed, "Request should be limited") {
+		return
+	}
+
+	if !suite.Equal(0, rateLimit.Remaining, "Incorrect remaining requests") ||
+		!suite.True(rateLimit.Reset > 0 && rateLimit.Reset <= time.Hour, "Incorrect reset") {
+		return
+	}
+
+	rateLimit, err = suite.store.RateLimit("other_key", 3, time.Hour)
+	if !suite.NoError(err) {
+		return
+	}
+
+	suite.True(rateLimit.Allowed, "Rate limits should be separate per key")
+}
+
+func (suite *MemoryStoreSuite) TestTokens() {
+	token := &common.ApiToken{
+		Name:     "analytics",
+		Token:    "secret",
+		Scopes:   []string{common.ScopeInfo},
+		Channels: []string{"channel"},
+	}
+
+	created, err := suite.store.CreateToken(token)
+	if !suite.NoError(err) || !suite.True(created, "Token should be created") {
+		return
+	}
+
+	created, err = suite.store.CreateToken(&common.ApiToken{
+		Name:   "analytics",
+		Token:  "other_secret",
+		Scopes: []string{common.ScopeSend},
+	})
+	if !suite.NoError(err) || !suite.False(created, "Token with the same name should not be created") {
+		return
+	}
+
+	storedToken, err := suite.store.GetToken(common.HashToken("secret"))
+	if !suite.NoError(err) || !suite.NotNil(storedToken, "Token should exist") {
+		return
+	}
+
+	suite.Equal("analytics", storedToken.Name, "Incorrect token name")
+	suite.Equal("", storedToken.Token, "Token secret should not be stored")
+	suite.Equal([]string{common.ScopeInfo}, storedToken.Scopes, "Incorrect token scopes")
+	suite.Equal([]string{"channel"}, storedToken.Channels, "Incorrect token channels")
+
+	tokens, err := suite.store.ListTokens()
+	if !suite.NoError(err) || !suite.Len(tokens, 1, "Incorrect number of tokens") {
+		return
+	}
+
+	deleted, err := suite.store.DeleteToken("analytics")
+	if !suite.NoError(err) || !suite.True(deleted, "Token should be deleted") {
+		return
+	}
+
+	storedToken, err = suite.store.GetToken(common.HashToken("secret"))
+	if !suite.NoError(err) {
+		return
+	}
+	suite.Nil(storedToken, "Token should not exist")
+
+	deleted, err = suite.store.DeleteToken("analytics")
+	if !suite.NoError(err) {
+		return
+	}
+	suite.False(deleted, "Deleted token should not be deleted again")
+}
+
+func (suite *MemoryStoreSuite) TestExpiration() {
+	err := suite.store.SetConnections([]*store.Connection{
+		{
+			Id:   "connection",
+			User: "user",
+		},
+	}, -time.Second)
+	if !suite.NoError(err) {
+		return
+	}
+
+	connections, err := suite.store.ResolveConnections(common.ResolveOptions{User: "user"})
+	if !suite.NoError(err) {
+		return
+	}
+
+	suite.Empty(connections, "Connection should be expired")
+}
+
+func (suite *MemoryStoreSuite) TestClaimSessions() {
+	// User & session keys shouldn't collide when containing separators
+	for _, claim := range []*store.Claim{
+		{Id: "first", User: "a-b", Session: "c"},
+		{Id: "second", User: "a", Session: "b-c"},
+	} {
+		claim.Expiration = time.Now().Add(time.Minute)
+
+		err := suite.store.CreateClaim(claim)
+		if !suite.NoError(err) {
+			return
+		}
+	}
+
+	claimIds, err := suite.store.ResolveClaims(common.ResolveOptions{User: "a-b", Session: "c"})
+	if !suite.NoError(err) {
+		return
+	}
+
+	suite.Equal([]string{"first"}, claimIds, "Incorrect resolved claims")
+}
+
+func (suite *MemoryStoreSuite) TestMessaging() {
+	received := make(chan string, 1)
+
+	subscription, err := suite.store.Subscribe("worker", func(messageType string, payload []byte) {
+		received <- messageType + ":" + string(payload)
+	}, nil)
+	if !suite.NoError(err) {
+		return
+	}
+
+	defer subscription.Close()
+
+	err = suite.store.Publish([]string{"worker", "other_worker"}, common.MessageMessageType, []byte("Hello world!"))
+	if !suite.NoError(err) {
+		return
+	}
+
+	select {
+	case message := <-received:
+		suite.Equal(common.MessageMessageType+":Hello world!", message, "Incorrect message")
+	case <-time.After(time.Second):
+		suite.Fail("Did not receive message")
+	}
+}
+
+func (suite *MemoryStoreSuite) TestStalledSubscriber() {
+	stalled := make(chan struct{})
+	defer close(stalled)
+
+	subscription, err := suite.store.Subscribe("worker", func(messageType string, payload []byte) {
+		<-stalled
+	}, nil)
+	if !suite.NoError(err) {
+		return
+	}
+
+	defer subscription.Close()
+
+	published := make(chan struct{})
+
+	go func() {
+		// More than the subscription's buffer
+		for i := 0; i < 2000; i++ {
+			_ = suite.store.Publish([]string{"worker"}, common.MessageMessageType, []byte("Hello world!"))
+		}
+		close(published)
+	}()
+
+	select {
+	case <-published:
+	case <-time.After(time.Second * 5):
+		suite.Fail("Publishing blocked on stalled subscriber")
+	}
+}
+
+func (suite *MemoryStoreSuite) TestChannelMessaging() {
+	received := make(chan string, 1)
+
+	subscription, err := suite.store.SubscribeChannels(func(messageType string, payload []byte) {
+		received <- string(payload)
+	}, nil)
+	if !suite.NoError(err) {
+		return
+	}
+
+	defer subscription.Close()
+
+	err = subscription.Subscribe("channel")
+	if !suite.NoError(err) {
+		return
+	}
+
+	err = suite.store.PublishChannel("channel", common.MessageMessageType, []byte("Hello channel!"))
+	if !suite.NoError(err) {
+		return
+	}
+
+	select {
+	case message := <-received:
+		suite.Equal("Hello channel!", message, "Incorrect message")
+	case <-time.After(time.Second):
+		suite.Fail("Did not receive message")
+		return
+	}
+
+	err = subscription.Unsubscribe("channel")
+	if !suite.NoError(err) {
+		return
+	}
+
+	err = suite.store.PublishChannel("channel", common.MessageMessageType, []byte("Hello channel!"))
+	if !suite.NoError(err) {
+		return
+	}
+
+	select {
+	case <-received:
+		suite.Fail("Should not receive message after unsubscribing")
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+func (suite *MemoryStoreSuite) TestEvents() {
+	received := make(chan string, 1)
+
+	subscription, err := suite.store.SubscribeEvents(func(payload []byte) {
+		received <- string(payload)
+	}, nil)
+	if !suite.NoError(err) {
+		return
+	}
+
+	// Worker messages are not received as events
+	err = suite.store.Publish([]string{"worker"}, common.MessageMessageType, []byte("Hello world!"))
+	if !suite.NoError(err) {
+		return
+	}
+
+	err = suite.store.PublishEvent([]byte("Hello event!"))
+	if !suite.NoError(err) {
+		return
+	}
+
+	select {
+	case event := <-received:
+		suite.Equal("Hello event!", event, "Incorrect event")
+	case <-time.After(time.Second):
+		suite.Fail("Did not receive event")
+		return
+	}
+
+	_ = subscription.Close()
+
+	err = suite.store.PublishEvent([]byte("Hello event!"))
+	if !suite.NoError(err) {
+		return
+	}
+
+	select {
+	case <-received:
+		suite.Fail("Should not receive event after closing")
+	case <-time.After(time.Millisecond * 100):
+	}
+}
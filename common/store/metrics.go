@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"github.com/go-redis/redis/v7"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+var redisCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "dsock_redis_command_duration_seconds",
+	Help:    "Duration of Redis commands (and pipelines), including blocking reads",
+	Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 5},
+}, []string{"command"})
+
+var memoryDroppedMessages = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dsock_memory_store_dropped_messages_total",
+	Help: "Messages dropped by the memory store because a subscriber's buffer was full",
+})
+
+type redisMetricsStartKey struct{}
+
+/// Records the duration of Redis commands and pipelines
+type redisMetricsHook struct{}
+
+func (redisMetricsHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisMetricsStartKey{}, time.Now()), nil
+}
+
+func (redisMetricsHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if start, ok := ctx.Value(redisMetricsStartKey{}).(time.Time); ok {
+		redisCommandDuration.WithLabelValues(cmd.Name()).Observe(time.Since(start).Seconds())
+	}
+
+	return nil
+}
+
+func (redisMetricsHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisMetricsStartKey{}, time.Now()), nil
+}
+
+func (redisMetricsHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	if start, ok := ctx.Value(redisMetricsStartKey{}).(time.Time); ok {
+		redisCommandDuration.WithLabelValues("pipeline").Observe(time.Since(start).Seconds())
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"math"
+	"time"
+)
+
+/// Result of counting a request against a rate limit
+type RateLimit struct {
+	/// Whether the request is allowed (under the limit)
+	Allowed bool
+	/// Requests left in the current window
+	Remaining int
+	/// Time until the current window ends
+	Reset time.Duration
+}
+
+/// Returns the index of the fixed window the time is in, and how far into the window the time is
+func rateLimitWindow(now time.Time, window time.Duration) (int64, time.Duration) {
+	index := now.UnixNano() / int64(window)
+
+	return index, time.Duration(now.UnixNano() - index*int64(window))
+}
+
+/// Approximates the number of requests in the sliding window ending now,
+/// by weighting the previous fixed window's count by how much of it the sliding window still overlaps
+func slidingWindowCount(previous int64, current int64, elapsed time.Duration, window time.Duration) float64 {
+	weight := float64(window-elapsed) / float64(window)
+
+	return float64(previous)*weight + float64(current)
+}
+
+func newRateLimit(allowed bool, count float64, limit int, elapsed time.Duration, window time.Duration) *RateLimit {
+	remaining := limit - int(math.Ceil(count))
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &RateLimit{
+		Allowed:   allowed,
+		Remaining: remaining,
+		Reset:     window - elapsed,
+	}
+}
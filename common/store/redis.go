@@ -0,0 +1,647 @@
+package store
+
+import (
+	"errors"
+	"github.com/Cretezy/dSock/common"
+	"github.com/go-redis/redis/v7"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/// Store backed by Redis, shared between all API and worker nodes
+type RedisStore struct {
+	Client redis.UniversalClient
+	Logger *zap.Logger
+	/// Messaging method used to publish/subscribe (redis or redis-streams)
+	MessagingMethod string
+	/// Approximate maximum length of worker streams. 0 to disable
+	StreamMaxLength int64
+	/// Maximum age of worker stream entries. 0 to disable
+	StreamMaxAge time.Duration
+	/// TTL of worker streams created when subscribing, until refreshed with the worker (SetWorker). 0 to not expire them
+	StreamTtl time.Duration
+}
+
+/// Creates a Redis client for the configured mode (single node, Sentinel or Cluster)
+func NewRedisClient(options *common.DSockOptions) redis.UniversalClient {
+	var client redis.UniversalClient
+
+	switch options.RedisMode {
+	case common.RedisModeSentinel:
+		failoverOptions := options.RedisOptions.Failover()
+		failoverOptions.SentinelPassword = options.RedisSentinelPassword
+
+		client = redis.NewFailoverClient(failoverOptions)
+	case common.RedisModeCluster:
+		client = redis.NewClusterClient(options.RedisOptions.Cluster())
+	default:
+		client = redis.NewClient(options.RedisOptions.Simple())
+	}
+
+	client.AddHook(redisMetricsHook{})
+
+	return client
+}
+
+// Keys use hash tags ({...}) so that related keys are in the same Redis Cluster slot:
+// a user's keys (connections & claims, by session) and a worker's keys.
+// Pipelines are split by slot, but multi-key commands (such as DEL) require a single slot
+
+func claimKey(id string) string {
+	return "claim:" + id
+}
+
+func claimUserKey(user string) string {
+	return "claim-user:{" + user + "}"
+}
+
+func claimUserSessionKey(user string, session string) string {
+	return "claim-user-session:{" + user + "}-" + session
+}
+
+func claimChannelKey(channel string) string {
+	return "claim-channel:" + channel
+}
+
+func connectionKey(id string) string {
+	return "conn:" + id
+}
+
+func userKey(user string) string {
+	return "user:{" + user + "}"
+}
+
+func userSessionKey(user string, session string) string {
+	return "user-session:{" + user + "}-" + session
+}
+
+func channelKey(channel string) string {
+	return "channel:" + channel
+}
+
+func workerKey(id string) string {
+	return "worker:{" + id + "}"
+}
+
+func workerStreamKey(id string) string {
+	return "worker-stream:{" + id + "}"
+}
+
+/// Set of all worker IDs. Expired workers are removed when listing
+const workersKey = "workers"
+
+func rateLimitKey(key string, index int64) string {
+	return "rate-limit:{" + key + "}:" + strconv.FormatInt(index, 10)
+}
+
+func splitChannels(channels string) []string {
+	return common.RemoveEmpty(strings.Split(channels, ","))
+}
+
+func parseClaim(id string, claim map[string]string) *Claim {
+	// Can safely ignore, will become 0 (and treated as expired)
+	expiration, _ := time.Parse(time.RFC3339, claim["expiration"])
+
+	return &Claim{
+		Id:         id,
+		User:       claim["user"],
+		Session:    claim["session"],
+		Channels:   splitChannels(claim["channels"]),
+		Expiration: expiration,
+	}
+}
+
+func parseConnection(id string, connection map[string]string) *Connection {
+	// Can safely ignore, will become 0
+	lastPing, _ := time.Parse(time.RFC3339, connection["lastPing"])
+	// Can safely ignore, will become 0 (connections from before connection limits)
+	connectedAt, _ := time.Parse(time.RFC3339Nano, connection["connectedAt"])
+
+	return &Connection{
+		Id:          id,
+		User:        connection["user"],
+		Session:     connection["session"],
+		WorkerId:    connection["workerId"],
+		LastPing:    lastPing,
+		Channels:    splitChannels(connection["channels"]),
+		ConnectedAt: connectedAt,
+	}
+}
+
+func parseWorker(id string, worker map[string]string) *Worker {
+	// Can safely ignore, will become 0
+	lastPing, _ := time.Parse(time.RFC3339, worker["lastPing"])
+
+	// Can safely ignore, will become 0 (workers from before load reporting)
+	connections, _ := strconv.Atoi(worker["connections"])
+	goroutines, _ := strconv.Atoi(worker["goroutines"])
+	memory, _ := strconv.ParseUint(worker["memory"], 10, 64)
+	cpu, _ := strconv.ParseFloat(worker["cpu"], 64)
+	queueDepth, _ := strconv.Atoi(worker["queueDepth"])
+
+	return &Worker{
+		Id:       id,
+		LastPing: lastPing,
+		Status:   worker["status"],
+		Ip:       worker["ip"],
+
+		DirectUrl: worker["directUrl"],
+		PublicUrl: worker["publicUrl"],
+		Region:    worker["region"],
+		Load: WorkerLoad{
+			Connections: connections,
+			Goroutines:  goroutines,
+			Memory:      memory,
+			Cpu:         cpu,
+			QueueDepth:  queueDepth,
+			AtCapacity:  worker["atCapacity"] == "1",
+		},
+	}
+}
+
+func (store *RedisStore) CreateClaim(claim *Claim) error {
+	redisClaim := map[string]interface{}{
+		"user":       claim.User,
+		"expiration": claim.Expiration.Format(time.RFC3339),
+	}
+
+	if claim.Session != "" {
+		redisClaim["session"] = claim.Session
+	}
+
+	if len(claim.Channels) != 0 {
+		redisClaim["channels"] = strings.Join(claim.Channels, ",")
+	}
+
+	_, err := store.Client.Pipelined(func(pipeliner redis.Pipeliner) error {
+		pipeliner.HSet(claimKey(claim.Id), redisClaim)
+		pipeliner.ExpireAt(claimKey(claim.Id), claim.Expiration)
+
+		// Create user/session/channel claim
+		pipeliner.SAdd(claimUserKey(claim.User), claim.Id)
+		if claim.Session != "" {
+			pipeliner.SAdd(claimUserSessionKey(claim.User, claim.Session), claim.Id)
+		}
+		for _, channel := range claim.Channels {
+			pipeliner.SAdd(claimChannelKey(channel), claim.Id)
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+func (store *RedisStore) ClaimExists(id string) (bool, error) {
+	exists := store.Client.Exists(claimKey(id))
+
+	if exists.Err() != nil {
+		return false, exists.Err()
+	}
+
+	return exists.Val() == 1, nil
+}
+
+func (store *RedisStore) GetClaim(id string) (*Claim, error) {
+	claims, err := store.GetClaims([]string{id})
+	if err != nil || len(claims) == 0 {
+		return nil, err
+	}
+
+	return claims[0], nil
+}
+
+func (store *RedisStore) GetClaims(ids []string) ([]*Claim, error) {
+	claimCmds := make([]*redis.StringStringMapCmd, len(ids))
+	_, err := store.Client.Pipelined(func(pipeliner redis.Pipeliner) error {
+		for index, id := range ids {
+			// HGetAll instead of HGet to be able to check if claim exist
+			claimCmds[index] = pipeliner.HGetAll(claimKey(id))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	claims := make([]*Claim, 0, len(ids))
+
+	for index, id := range ids {
+		claim := claimCmds[index]
+
+		if claim.Err() != nil {
+			return nil, claim.Err()
+		}
+
+		if len(claim.Val()) == 0 {
+			// Claim doesn't exist
+			continue
+		}
+
+		claims = append(claims, parseClaim(id, claim.Val()))
+	}
+
+	return claims, nil
+}
+
+func (store *RedisStore) DeleteClaims(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// Claims are fetched to remove them from their user/session/channels
+	claims, err := store.GetClaims(ids)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.Client.Pipelined(func(pipeliner redis.Pipeliner) error {
+		for _, claim := range claims {
+			pipeliner.Del(claimKey(claim.Id))
+			pipeliner.SRem(claimUserKey(claim.User), claim.Id)
+			if claim.Session != "" {
+				pipeliner.SRem(claimUserSessionKey(claim.User, claim.Session), claim.Id)
+			}
+			for _, channel := range claim.Channels {
+				pipeliner.SRem(claimChannelKey(channel), claim.Id)
+			}
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+func (store *RedisStore) ResolveClaims(target common.ResolveOptions) ([]string, error) {
+	var key string
+
+	if target.Session != "" {
+		key = claimUserSessionKey(target.User, target.Session)
+	} else if target.Channel != "" {
+		key = claimChannelKey(target.Channel)
+	} else if target.User != "" {
+		key = claimUserKey(target.User)
+	} else {
+		return []string{}, nil
+	}
+
+	claimIds := store.Client.SMembers(key)
+
+	return claimIds.Val(), claimIds.Err()
+}
+
+func (store *RedisStore) AddClaimsChannel(ids []string, channel string) error {
+	return store.updateClaimsChannel(ids, channel, true)
+}
+
+func (store *RedisStore) RemoveClaimsChannel(ids []string, channel string) error {
+	return store.updateClaimsChannel(ids, channel, false)
+}
+
+func (store *RedisStore) updateClaimsChannel(ids []string, channel string, subscribe bool) error {
+	claims, err := store.GetClaims(ids)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.Client.Pipelined(func(pipeliner redis.Pipeliner) error {
+		// Update all resolved claims
+		for _, claim := range claims {
+			channels := claim.Channels
+
+			if subscribe && !common.IncludesString(channels, channel) {
+				channels = append(channels, channel)
+				pipeliner.SAdd(claimChannelKey(channel), claim.Id)
+			} else if !subscribe && common.IncludesString(channels, channel) {
+				channels = common.RemoveString(channels, channel)
+				pipeliner.SRem(claimChannelKey(channel), claim.Id)
+			} else {
+				continue
+			}
+
+			pipeliner.HSet(claimKey(claim.Id), "channels", strings.Join(channels, ","))
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+func (store *RedisStore) SetConnections(connections []*Connection, ttl time.Duration) error {
+	_, err := store.Client.Pipelined(func(pipeliner redis.Pipeliner) error {
+		for _, connection := range connections {
+			redisConnection := map[string]interface{}{
+				"user":     connection.User,
+				"workerId": connection.WorkerId,
+				"lastPing": connection.LastPing.Format(time.RFC3339),
+				// Nanoseconds to order connections opened in the same second
+				"connectedAt": connection.ConnectedAt.Format(time.RFC3339Nano),
+				"channels":    strings.Join(connection.Channels, ","),
+			}
+			if connection.Session != "" {
+				redisConnection["session"] = connection.Session
+			}
+
+			pipeliner.HSet(connectionKey(connection.Id), redisConnection)
+			pipeliner.Expire(connectionKey(connection.Id), ttl)
+
+			// Add user/session/channels to Redis
+			for _, channel := range connection.Channels {
+				pipeliner.SAdd(channelKey(channel), connection.Id)
+			}
+			pipeliner.SAdd(userKey(connection.User), connection.Id)
+			if connection.Session != "" {
+				pipeliner.SAdd(userSessionKey(connection.User, connection.Session), connection.Id)
+			}
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+func (store *RedisStore) DeleteConnection(connection *Connection) error {
+	_, err := store.Client.Pipelined(func(pipeliner redis.Pipeliner) error {
+		pipeliner.Del(connectionKey(connection.Id))
+		pipeliner.SRem(userKey(connection.User), connection.Id)
+		if connection.Session != "" {
+			pipeliner.SRem(userSessionKey(connection.User, connection.Session), connection.Id)
+		}
+		for _, channel := range connection.Channels {
+			pipeliner.SRem(channelKey(channel), connection.Id)
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+func (store *RedisStore) AddConnectionChannel(connection *Connection, channel string) error {
+	_, err := store.Client.Pipelined(func(pipeliner redis.Pipeliner) error {
+		pipeliner.SAdd(channelKey(channel), connection.Id)
+		pipeliner.HSet(connectionKey(connection.Id), "channels", strings.Join(connection.Channels, ","))
+
+		return nil
+	})
+
+	return err
+}
+
+func (store *RedisStore) RemoveConnectionChannel(connection *Connection, channel string) error {
+	_, err := store.Client.Pipelined(func(pipeliner redis.Pipeliner) error {
+		pipeliner.SRem(channelKey(channel), connection.Id)
+		pipeliner.HSet(connectionKey(connection.Id), "channels", strings.Join(connection.Channels, ","))
+
+		return nil
+	})
+
+	return err
+}
+
+func (store *RedisStore) ResolveConnections(target common.ResolveOptions) ([]*Connection, error) {
+	var connectionIds []string
+
+	if target.Connection != "" {
+		connectionIds = []string{target.Connection}
+	} else if target.Channel != "" {
+		// Get all connections for a channel
+		channel := store.Client.SMembers(channelKey(target.Channel))
+		if channel.Err() != nil {
+			return nil, channel.Err()
+		}
+
+		connectionIds = channel.Val()
+	} else if target.User != "" {
+		// Get all connections for a user (filtered by session below)
+		user := store.Client.SMembers(userKey(target.User))
+		if user.Err() != nil {
+			return nil, user.Err()
+		}
+
+		connectionIds = user.Val()
+	} else {
+		return []*Connection{}, nil
+	}
+
+	var connectionCmds = make([]*redis.StringStringMapCmd, len(connectionIds))
+	_, err := store.Client.Pipelined(func(pipeliner redis.Pipeliner) error {
+		for index, connectionId := range connectionIds {
+			connectionCmds[index] = pipeliner.HGetAll(connectionKey(connectionId))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	connections := make([]*Connection, 0, len(connectionIds))
+
+	for index, connectionId := range connectionIds {
+		connection := connectionCmds[index]
+
+		if connection.Err() != nil {
+			return nil, connection.Err()
+		}
+
+		if len(connection.Val()) == 0 {
+			// Connection doesn't exist
+			continue
+		}
+
+		// Target specific session(s) for user if set
+		if target.Connection == "" && target.Channel == "" &&
+			target.Session != "" && connection.Val()["session"] != target.Session {
+			continue
+		}
+
+		connections = append(connections, parseConnection(connectionId, connection.Val()))
+	}
+
+	return connections, nil
+}
+
+func (store *RedisStore) SetWorker(worker *Worker, ttl time.Duration) error {
+	redisWorker := map[string]interface{}{
+		"lastPing": worker.LastPing.Format(time.RFC3339),
+		"status":   worker.Status,
+
+		"connections": worker.Load.Connections,
+		"goroutines":  worker.Load.Goroutines,
+		"memory":      worker.Load.Memory,
+		"cpu":         strconv.FormatFloat(worker.Load.Cpu, 'f', 2, 64),
+		"queueDepth":  worker.Load.QueueDepth,
+		"atCapacity":  worker.Load.AtCapacity,
+	}
+	if worker.Ip != "" {
+		redisWorker["ip"] = worker.Ip
+	}
+	if worker.DirectUrl != "" {
+		redisWorker["directUrl"] = worker.DirectUrl
+	}
+	if worker.PublicUrl != "" {
+		redisWorker["publicUrl"] = worker.PublicUrl
+	}
+	if worker.Region != "" {
+		redisWorker["region"] = worker.Region
+	}
+
+	_, err := store.Client.Pipelined(func(pipeliner redis.Pipeliner) error {
+		pipeliner.HSet(workerKey(worker.Id), redisWorker)
+		pipeliner.Expire(workerKey(worker.Id), ttl)
+		pipeliner.SAdd(workersKey, worker.Id)
+
+		if store.MessagingMethod == common.MessageMethodRedisStreams {
+			pipeliner.Expire(workerStreamKey(worker.Id), ttl)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if store.MessagingMethod == common.MessageMethodRedisStreams {
+		return store.trimStream(worker.Id)
+	}
+
+	return nil
+}
+
+func (store *RedisStore) GetWorkers(ids []string) ([]*Worker, error) {
+	var workerCmds = make([]*redis.StringStringMapCmd, len(ids))
+	_, err := store.Client.Pipelined(func(pipeliner redis.Pipeliner) error {
+		for index, id := range ids {
+			workerCmds[index] = pipeliner.HGetAll(workerKey(id))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	workers := make([]*Worker, 0, len(ids))
+
+	for index, id := range ids {
+		worker := workerCmds[index]
+
+		if worker.Err() != nil {
+			return nil, worker.Err()
+		}
+
+		if len(worker.Val()) == 0 {
+			// Worker doesn't exist
+			continue
+		}
+
+		workers = append(workers, parseWorker(id, worker.Val()))
+	}
+
+	return workers, nil
+}
+
+func (store *RedisStore) ListWorkers() ([]*Worker, error) {
+	ids, err := store.Client.SMembers(workersKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	workers, err := store.GetWorkers(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(workers) != len(ids) {
+		// Clean up workers that have expired
+		existing := make(map[string]bool, len(workers))
+		for _, worker := range workers {
+			existing[worker.Id] = true
+		}
+
+		expired := make([]interface{}, 0, len(ids)-len(workers))
+		for _, id := range ids {
+			if !existing[id] {
+				expired = append(expired, id)
+			}
+		}
+
+		err = store.Client.SRem(workersKey, expired...).Err()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return workers, nil
+}
+
+/// Counts the request in the current window only if the sliding window count is under the limit.
+/// KEYS: current window, previous window. ARGV: limit, window (ms), elapsed in current window (ms).
+/// Returns whether the request is allowed, and the sliding window count (x1000, as Redis truncates numbers)
+var rateLimitScript = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+local previous = tonumber(redis.call("GET", KEYS[2]) or "0")
+local window = tonumber(ARGV[2])
+local count = previous * (window - tonumber(ARGV[3])) / window + current
+
+if count + 1 > tonumber(ARGV[1]) then
+	return {0, math.floor(count * 1000)}
+end
+
+redis.call("INCR", KEYS[1])
+redis.call("PEXPIRE", KEYS[1], window * 2)
+
+return {1, math.floor((count + 1) * 1000)}
+`)
+
+func (store *RedisStore) RateLimit(key string, limit int, window time.Duration) (*RateLimit, error) {
+	index, elapsed := rateLimitWindow(time.Now(), window)
+
+	result, err := rateLimitScript.Run(store.Client,
+		[]string{rateLimitKey(key, index), rateLimitKey(key, index-1)},
+		limit, window.Milliseconds(), elapsed.Milliseconds(),
+	).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 2 {
+		return nil, errors.New("invalid rate limit script result")
+	}
+
+	allowed, _ := values[0].(int64)
+	count, _ := values[1].(int64)
+
+	return newRateLimit(allowed == 1, float64(count)/1000, limit, elapsed, window), nil
+}
+
+func (store *RedisStore) DeleteWorker(id string) error {
+	_, err := store.Client.Pipelined(func(pipeliner redis.Pipeliner) error {
+		pipeliner.Del(workerKey(id), workerStreamKey(id))
+		pipeliner.SRem(workersKey, id)
+
+		return nil
+	})
+
+	return err
+}
+
+func (store *RedisStore) Ping() error {
+	return store.Client.Ping().Err()
+}
+
+func (store *RedisStore) Close() error {
+	return store.Client.Close()
+}
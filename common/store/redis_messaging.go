@@ -0,0 +1,364 @@
+package store
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/go-redis/redis/v7"
+	"go.uber.org/zap"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/// How long to wait for a message before checking the subscription with a ping
+const subscriptionPingInterval = time.Second * 30
+
+/// Consumer group used by workers to track their acknowledged offset
+const streamGroup = "worker"
+
+/// How long to block waiting for new stream entries before checking for shutdown
+const streamBlockDuration = time.Second * 5
+
+func newRetryBackoff() common.Backoff {
+	return common.Backoff{
+		Min: time.Millisecond * 100,
+		Max: time.Second * 30,
+	}
+}
+
+func workerRedisChannel(workerId string, messageType string) string {
+	if messageType == common.ChannelMessageType {
+		return workerId + ":channel"
+	}
+
+	return workerId
+}
+
+/// Adds the message to the worker's stream if the worker is alive, so that streams of expired workers aren't recreated
+/// (without expiration). The stream expires with the worker.
+/// KEYS: worker, worker stream. ARGV: approximate maximum length (0 to disable), type, message. Returns whether the message was added
+var streamAddScript = redis.NewScript(`
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl == -2 then
+	return 0
+end
+
+if tonumber(ARGV[1]) > 0 then
+	redis.call("XADD", KEYS[2], "MAXLEN", "~", ARGV[1], "*", "type", ARGV[2], "message", ARGV[3])
+else
+	redis.call("XADD", KEYS[2], "*", "type", ARGV[2], "message", ARGV[3])
+end
+
+if ttl > 0 then
+	redis.call("PEXPIRE", KEYS[2], ttl)
+end
+
+return 1
+`)
+
+func (store *RedisStore) Publish(workerIds []string, messageType string, payload []byte) error {
+	_, err := store.Client.Pipelined(func(pipeliner redis.Pipeliner) error {
+		for _, workerId := range workerIds {
+			if store.MessagingMethod == common.MessageMethodRedisStreams {
+				// Stream is trimmed by length on add, and by age when the worker is refreshed.
+				// Evaluated (instead of EVALSHA) as scripts can't be loaded on demand in a pipeline
+				streamAddScript.Eval(pipeliner,
+					[]string{workerKey(workerId), workerStreamKey(workerId)},
+					store.StreamMaxLength, messageType, payload,
+				)
+			} else {
+				pipeliner.Publish(workerRedisChannel(workerId, messageType), payload)
+			}
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+type redisSubscription struct {
+	quit   chan struct{}
+	pubSub *redis.PubSub
+}
+
+func (subscription *redisSubscription) Close() error {
+	close(subscription.quit)
+
+	if subscription.pubSub != nil {
+		return subscription.pubSub.Close()
+	}
+
+	return nil
+}
+
+func (store *RedisStore) Subscribe(workerId string, handler MessageHandler, onStatus StatusHandler) (Subscription, error) {
+	subscription := &redisSubscription{
+		quit: make(chan struct{}),
+	}
+
+	if store.MessagingMethod == common.MessageMethodRedisStreams {
+		go store.receiveStream(workerId, subscription.quit, handler, onStatus)
+	} else {
+		messageChannel := workerRedisChannel(workerId, common.MessageMessageType)
+		channelChannel := workerRedisChannel(workerId, common.ChannelMessageType)
+
+		subscription.pubSub = store.Client.Subscribe(messageChannel, channelChannel)
+
+		go store.receiveSubscription(subscription.pubSub, "subscription", subscription.quit, func(redisChannel string, payload []byte) {
+			if redisChannel == channelChannel {
+				handler(common.ChannelMessageType, payload)
+			} else {
+				handler(common.MessageMessageType, payload)
+			}
+		}, onStatus)
+	}
+
+	return subscription, nil
+}
+
+func (store *RedisStore) PublishChannel(channel string, messageType string, payload []byte) error {
+	// Only messages are sent through channel topics
+	return store.Client.Publish(channelTopic(channel), payload).Err()
+}
+
+type redisChannelSubscription struct {
+	redisSubscription
+}
+
+func (subscription *redisChannelSubscription) Subscribe(channels ...string) error {
+	return subscription.pubSub.Subscribe(channelTopics(channels)...)
+}
+
+func (subscription *redisChannelSubscription) Unsubscribe(channels ...string) error {
+	return subscription.pubSub.Unsubscribe(channelTopics(channels)...)
+}
+
+func channelTopics(channels []string) []string {
+	topics := make([]string, len(channels))
+	for index, channel := range channels {
+		topics[index] = channelTopic(channel)
+	}
+
+	return topics
+}
+
+func (store *RedisStore) SubscribeChannels(handler MessageHandler, onStatus StatusHandler) (ChannelSubscription, error) {
+	// Channels are added with Subscribe, and are resubscribed to automatically when reconnecting
+	subscription := &redisChannelSubscription{
+		redisSubscription{
+			quit:   make(chan struct{}),
+			pubSub: store.Client.Subscribe(),
+		},
+	}
+
+	go store.receiveSubscription(subscription.pubSub, "channel-subscription", subscription.quit, func(_ string, payload []byte) {
+		handler(common.MessageMessageType, payload)
+	}, onStatus)
+
+	return subscription, nil
+}
+
+func (store *RedisStore) PublishEvent(payload []byte) error {
+	return store.Client.Publish(eventsTopic, payload).Err()
+}
+
+func (store *RedisStore) SubscribeEvents(handler EventHandler, onStatus StatusHandler) (Subscription, error) {
+	subscription := &redisSubscription{
+		quit:   make(chan struct{}),
+		pubSub: store.Client.Subscribe(eventsTopic),
+	}
+
+	go store.receiveSubscription(subscription.pubSub, "events-subscription", subscription.quit, func(_ string, payload []byte) {
+		handler(payload)
+	}, onStatus)
+
+	return subscription, nil
+}
+
+/// Receives messages from a Redis subscription until quit is closed.
+/// On errors, reports the error and retries with backoff (the subscription reconnects & resubscribes)
+func (store *RedisStore) receiveSubscription(pubSub *redis.PubSub, component string, quit chan struct{}, handle func(redisChannel string, payload []byte), onStatus StatusHandler) {
+	backoff := newRetryBackoff()
+	degraded := false
+
+	for {
+		received, err := pubSub.ReceiveTimeout(subscriptionPingInterval)
+
+		select {
+		case <-quit:
+			return
+		default:
+		}
+
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				// No message received recently, check that the connection is alive.
+				// The pong is received on the next loop
+				err = pubSub.Ping()
+				if err == nil {
+					continue
+				}
+			}
+
+			onStatus(component, err)
+			degraded = true
+
+			retryIn := backoff.Next()
+
+			store.Logger.Error("Error receiving message from Redis, resubscribing",
+				zap.Error(err),
+				zap.Duration("retryIn", retryIn),
+			)
+
+			select {
+			case <-quit:
+				return
+			case <-time.After(retryIn):
+			}
+
+			continue
+		}
+
+		if degraded {
+			store.Logger.Info("Recovered Redis subscription")
+
+			backoff.Reset()
+			onStatus(component, nil)
+			degraded = false
+		}
+
+		if message, ok := received.(*redis.Message); ok {
+			handle(message.Channel, []byte(message.Payload))
+		}
+	}
+}
+
+/// Receives messages from the worker's stream, resuming from the last acknowledged entry
+func (store *RedisStore) receiveStream(workerId string, quit chan struct{}, handler MessageHandler, onStatus StatusHandler) {
+	stream := workerStreamKey(workerId)
+
+	createGroup := func() {
+		_, err := store.Client.Pipelined(func(pipeliner redis.Pipeliner) error {
+			// Creates the stream if missing. Errors with BUSYGROUP if the group already exists
+			pipeliner.XGroupCreateMkStream(stream, streamGroup, "0")
+
+			// Expires with the worker if it stops before registering (or refreshing) itself
+			if store.StreamTtl > 0 {
+				pipeliner.PExpire(stream, store.StreamTtl)
+			}
+
+			return nil
+		})
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			store.Logger.Error("Could not create stream consumer group",
+				zap.Error(err),
+				zap.String("stream", stream),
+			)
+		}
+	}
+
+	createGroup()
+
+	backoff := newRetryBackoff()
+	component := "stream"
+
+	// Start by reading entries that were delivered but not acknowledged ("0"),
+	// then switch to new entries (">") once none are pending
+	readId := "0"
+
+	for {
+		select {
+		case <-quit:
+			return
+		default:
+		}
+
+		streams, err := store.Client.XReadGroup(&redis.XReadGroupArgs{
+			Group:    streamGroup,
+			Consumer: workerId,
+			Streams:  []string{stream, readId},
+			Count:    100,
+			Block:    streamBlockDuration,
+		}).Result()
+
+		if err == redis.Nil {
+			// No new entries
+			backoff.Reset()
+			onStatus(component, nil)
+			continue
+		}
+
+		if err != nil {
+			onStatus(component, err)
+
+			retryIn := backoff.Next()
+
+			store.Logger.Error("Error reading from stream",
+				zap.Error(err),
+				zap.String("stream", stream),
+				zap.Duration("retryIn", retryIn),
+			)
+
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				// Stream was removed (expired or failover), recreate it
+				createGroup()
+			}
+
+			// Entries might have been delivered but not acknowledged
+			readId = "0"
+
+			select {
+			case <-quit:
+				return
+			case <-time.After(retryIn):
+			}
+
+			continue
+		}
+
+		backoff.Reset()
+		onStatus(component, nil)
+
+		for _, streamEntries := range streams {
+			if readId == "0" && len(streamEntries.Messages) == 0 {
+				// Caught up with pending entries
+				readId = ">"
+			}
+
+			entryIds := make([]string, len(streamEntries.Messages))
+
+			for index, entry := range streamEntries.Messages {
+				messageType, _ := entry.Values["type"].(string)
+				payload, _ := entry.Values["message"].(string)
+
+				handler(messageType, []byte(payload))
+
+				entryIds[index] = entry.ID
+			}
+
+			if len(entryIds) == 0 {
+				continue
+			}
+
+			err := store.Client.XAck(stream, streamGroup, entryIds...).Err()
+			if err != nil {
+				store.Logger.Error("Could not acknowledge stream entries",
+					zap.Error(err),
+					zap.String("stream", stream),
+				)
+			}
+		}
+	}
+}
+
+/// Removes stream entries older than the maximum age. Requires Redis 6.2+
+func (store *RedisStore) trimStream(workerId string) error {
+	if store.StreamMaxAge <= 0 {
+		return nil
+	}
+
+	minId := strconv.FormatInt(time.Now().Add(-store.StreamMaxAge).UnixNano()/int64(time.Millisecond), 10)
+
+	return store.Client.Do("xtrim", workerStreamKey(workerId), "minid", "~", minId).Err()
+}
@@ -0,0 +1,200 @@
+package store_test
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/common/store"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"strconv"
+	"testing"
+	"time"
+)
+
+/// Redis store (with the redis-streams messaging method) against an embedded Redis server
+type RedisStoreSuite struct {
+	suite.Suite
+	redis *miniredis.Miniredis
+	store *store.RedisStore
+}
+
+func TestRedisStoreSuite(t *testing.T) {
+	suite.Run(t, new(RedisStoreSuite))
+}
+
+func (suite *RedisStoreSuite) SetupTest() {
+	suite.redis = miniredis.NewMiniRedis()
+	if !suite.NoError(suite.redis.Start()) {
+		return
+	}
+
+	suite.store = &store.RedisStore{
+		Client:          redis.NewClient(&redis.Options{Addr: suite.redis.Addr()}),
+		Logger:          zap.NewNop(),
+		MessagingMethod: common.MessageMethodRedisStreams,
+		StreamMaxLength: 100,
+		StreamTtl:       time.Minute,
+	}
+}
+
+func (suite *RedisStoreSuite) TearDownTest() {
+	_ = suite.store.Close()
+	suite.redis.Close()
+}
+
+/// Subscribes to the worker's stream, returning received messages
+func (suite *RedisStoreSuite) subscribe(workerId string) (chan string, store.Subscription) {
+	received := make(chan string, 10)
+
+	subscription, err := suite.store.Subscribe(workerId, func(messageType string, payload []byte) {
+		received <- string(payload)
+	}, func(string, error) {})
+	suite.Require().NoError(err)
+
+	return received, subscription
+}
+
+func (suite *RedisStoreSuite) expectMessages(received chan string, expected ...string) {
+	for _, message := range expected {
+		select {
+		case payload := <-received:
+			suite.Equal(message, payload, "Incorrect message")
+		case <-time.After(time.Second * 5):
+			suite.Fail("Message not received", message)
+			return
+		}
+	}
+}
+
+func (suite *RedisStoreSuite) TestStreamExpiresWithWorker() {
+	err := suite.store.SetWorker(&store.Worker{Id: "worker"}, time.Minute)
+	suite.Require().NoError(err)
+
+	err = suite.store.Publish([]string{"worker", "expired_worker"}, common.MessageMessageType, []byte("message"))
+	suite.Require().NoError(err)
+
+	suite.True(suite.redis.Exists("worker-stream:{worker}"), "Stream of worker should exist")
+	suite.True(suite.redis.TTL("worker-stream:{worker}") > 0, "Stream should expire")
+	suite.False(suite.redis.Exists("worker-stream:{expired_worker}"), "Stream of expired worker should not be created")
+}
+
+func (suite *RedisStoreSuite) TestStreamExpiresWithoutRefresh() {
+	// The worker subscribes, but never registers or refreshes itself (such as crashing right after starting)
+	_, subscription := suite.subscribe("worker")
+
+	suite.Require().Eventually(func() bool {
+		return suite.redis.Exists("worker-stream:{worker}")
+	}, time.Second*5, time.Millisecond*10, "Stream should be created")
+	suite.Equal(time.Minute, suite.redis.TTL("worker-stream:{worker}"), "Stream should expire with the worker's TTL")
+
+	// Crashed, without recreating the stream
+	_ = subscription.Close()
+	_ = suite.store.Client.Close()
+
+	suite.redis.FastForward(time.Minute)
+
+	suite.False(suite.redis.Exists("worker-stream:{worker}"), "Stream should be expired")
+}
+
+func (suite *RedisStoreSuite) TestStreamDurability() {
+	err := suite.store.SetWorker(&store.Worker{Id: "worker"}, time.Minute)
+	suite.Require().NoError(err)
+
+	// Messages published while the worker isn't receiving (such as disconnected from Redis) are received once it subscribes
+	err = suite.store.Publish([]string{"worker"}, common.MessageMessageType, []byte("first"))
+	suite.Require().NoError(err)
+
+	received, subscription := suite.subscribe("worker")
+	defer subscription.Close()
+
+	suite.expectMessages(received, "first")
+
+	err = suite.store.Publish([]string{"worker"}, common.MessageMessageType, []byte("second"))
+	suite.Require().NoError(err)
+
+	suite.expectMessages(received, "second")
+}
+
+func (suite *RedisStoreSuite) TestStreamRedelivery() {
+	err := suite.store.SetWorker(&store.Worker{Id: "worker"}, time.Minute)
+	suite.Require().NoError(err)
+
+	err = suite.store.Client.XGroupCreateMkStream("worker-stream:{worker}", "worker", "0").Err()
+	suite.Require().NoError(err)
+
+	err = suite.store.Publish([]string{"worker"}, common.MessageMessageType, []byte("unacknowledged"))
+	suite.Require().NoError(err)
+
+	// Delivered to the worker, which stops before acknowledging it
+	_, err = suite.store.Client.XReadGroup(&redis.XReadGroupArgs{
+		Group:    "worker",
+		Consumer: "worker",
+		Streams:  []string{"worker-stream:{worker}", ">"},
+	}).Result()
+	suite.Require().NoError(err)
+
+	received, subscription := suite.subscribe("worker")
+	defer subscription.Close()
+
+	suite.expectMessages(received, "unacknowledged")
+
+	// Acknowledged once handled
+	suite.Eventually(func() bool {
+		pending, err := suite.store.Client.XPending("worker-stream:{worker}", "worker").Result()
+		return err == nil && pending.Count == 0
+	}, time.Second*5, time.Millisecond*50, "Message should be acknowledged")
+}
+
+/// Key of the rate limit's fixed window, offset from the current one
+func rateLimitKey(key string, window time.Duration, offset int64) string {
+	return "rate-limit:{" + key + "}:" + strconv.FormatInt(time.Now().UnixNano()/int64(window)+offset, 10)
+}
+
+func (suite *RedisStoreSuite) TestRateLimit() {
+	for index := 0; index < 3; index++ {
+		rateLimit, err := suite.store.RateLimit("key", 3, time.Hour)
+		suite.Require().NoError(err)
+		suite.Require().True(rateLimit.Allowed, "Request should be allowed")
+		suite.Equal(2-index, rateLimit.Remaining, "Incorrect remaining requests")
+	}
+
+	rateLimit, err := suite.store.RateLimit("key", 3, time.Hour)
+	suite.Require().NoError(err)
+	suite.False(rateLimit.Allowed, "Request should be limited")
+	suite.Equal(0, rateLimit.Remaining, "Incorrect remaining requests")
+	suite.True(rateLimit.Reset > 0 && rateLimit.Reset <= time.Hour, "Incorrect reset")
+
+	// Limited requests aren't counted, and counts expire after the sliding window stops overlapping them
+	currentKey := rateLimitKey("key", time.Hour, 0)
+	count, err := suite.redis.Get(currentKey)
+	suite.Require().NoError(err)
+	suite.Equal("3", count, "Incorrect count")
+	suite.Equal(time.Hour*2, suite.redis.TTL(currentKey), "Incorrect count expiration")
+
+	rateLimit, err = suite.store.RateLimit("other_key", 3, time.Hour)
+	suite.Require().NoError(err)
+	suite.True(rateLimit.Allowed, "Rate limits should be separate per key")
+}
+
+func (suite *RedisStoreSuite) TestRateLimitSlidingWindow() {
+	// Requests of the previous window are counted (weighted by how much the sliding window overlaps it)
+	err := suite.redis.Set(rateLimitKey("key", time.Hour, -1), "1000000")
+	suite.Require().NoError(err)
+
+	rateLimit, err := suite.store.RateLimit("key", 3, time.Hour)
+	suite.Require().NoError(err)
+	suite.False(rateLimit.Allowed, "Request should be limited by the previous window")
+	suite.Equal(0, rateLimit.Remaining, "Incorrect remaining requests")
+	suite.False(suite.redis.Exists(rateLimitKey("key", time.Hour, 0)), "Limited request should not be counted")
+
+	// Windows before the previous one aren't counted
+	suite.redis.Del(rateLimitKey("key", time.Hour, -1))
+	err = suite.redis.Set(rateLimitKey("key", time.Hour, -2), "1000000")
+	suite.Require().NoError(err)
+
+	rateLimit, err = suite.store.RateLimit("key", 3, time.Hour)
+	suite.Require().NoError(err)
+	suite.True(rateLimit.Allowed, "Request should be allowed")
+	suite.Equal(2, rateLimit.Remaining, "Incorrect remaining requests")
+}
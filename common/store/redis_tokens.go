@@ -0,0 +1,99 @@
+package store
+
+import (
+	"encoding/json"
+	"github.com/Cretezy/dSock/common"
+	"github.com/go-redis/redis/v7"
+)
+
+/// Hash of stored API tokens (JSON, without the secret), by the hash of their secret
+const tokensKey = "tokens"
+
+/// Stores the token if no token has the same name.
+/// KEYS: tokens. ARGV: hash of the secret, name, token (JSON). Returns whether the token was stored
+var createTokenScript = redis.NewScript(`
+for _, token in ipairs(redis.call("HVALS", KEYS[1])) do
+	if cjson.decode(token).name == ARGV[2] then
+		return 0
+	end
+end
+
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[3])
+
+return 1
+`)
+
+/// Deletes the token with the name.
+/// KEYS: tokens. ARGV: name. Returns whether a token was deleted
+var deleteTokenScript = redis.NewScript(`
+local tokens = redis.call("HGETALL", KEYS[1])
+
+for index = 1, #tokens, 2 do
+	if cjson.decode(tokens[index + 1]).name == ARGV[1] then
+		redis.call("HDEL", KEYS[1], tokens[index])
+		return 1
+	end
+end
+
+return 0
+`)
+
+func (store *RedisStore) CreateToken(token *common.ApiToken) (bool, error) {
+	payload, err := json.Marshal(token)
+	if err != nil {
+		return false, err
+	}
+
+	created, err := createTokenScript.Run(store.Client,
+		[]string{tokensKey},
+		common.HashToken(token.Token), token.Name, payload,
+	).Int()
+
+	return created == 1, err
+}
+
+func (store *RedisStore) GetToken(hash string) (*common.ApiToken, error) {
+	payload, err := store.Client.HGet(tokensKey, hash).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	token := &common.ApiToken{}
+
+	err = json.Unmarshal([]byte(payload), token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (store *RedisStore) ListTokens() ([]*common.ApiToken, error) {
+	payloads, err := store.Client.HVals(tokensKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]*common.ApiToken, 0, len(payloads))
+
+	for _, payload := range payloads {
+		token := &common.ApiToken{}
+
+		err = json.Unmarshal([]byte(payload), token)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+func (store *RedisStore) DeleteToken(name string) (bool, error) {
+	deleted, err := deleteTokenScript.Run(store.Client, []string{tokensKey}, name).Int()
+
+	return deleted == 1, err
+}
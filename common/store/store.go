@@ -0,0 +1,181 @@
+package store
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"go.uber.org/zap"
+	"time"
+)
+
+type Claim struct {
+	Id         string
+	User       string
+	Session    string
+	Channels   []string
+	Expiration time.Time
+}
+
+type Connection struct {
+	Id       string
+	User     string
+	Session  string
+	WorkerId string
+	LastPing time.Time
+	Channels []string
+	/// When the connection was opened, used to find the oldest connections
+	ConnectedAt time.Time
+}
+
+type Worker struct {
+	Id       string
+	LastPing time.Time
+	/// Health status of the worker (healthy/degraded)
+	Status string
+	/// Hostname + port of the worker, when using direct messaging
+	Ip string
+	/// URL (with the scheme, without the path) the API sends direct messages to, when using direct messaging.
+	/// Empty for workers from before direct messaging URLs, reached with HTTP on Ip
+	DirectUrl string
+	/// URL clients connect to (without the path), if the worker is publicly reachable
+	PublicUrl string
+	/// Region label of the worker
+	Region string
+	Load   WorkerLoad
+}
+
+/// Returns the URL (without the path) to send direct messages to the worker, or empty if not configured for direct messaging
+func (worker *Worker) DirectMessageUrl() string {
+	if worker.DirectUrl != "" {
+		return worker.DirectUrl
+	}
+
+	if worker.Ip != "" {
+		return "http://" + worker.Ip
+	}
+
+	return ""
+}
+
+/// Load of a worker, used to steer clients to less loaded workers
+type WorkerLoad struct {
+	Connections int
+	Goroutines  int
+	/// Memory obtained from the OS, in bytes
+	Memory uint64
+	/// CPU usage, in percent of all cores
+	Cpu float64
+	/// Messages waiting to be sent, across all connections
+	QueueDepth int
+	/// Whether the worker is rejecting new connections because it is at capacity
+	AtCapacity bool
+}
+
+/// Handles a connection event (JSON encoded common.Event)
+type EventHandler func(payload []byte)
+
+/// Handles a message received for a worker. Message type is common.MessageMessageType or common.ChannelMessageType
+type MessageHandler func(messageType string, payload []byte)
+
+/// Called when a component of a subscription errors (err is set) or recovers (err is nil)
+type StatusHandler func(component string, err error)
+
+type Subscription interface {
+	Close() error
+}
+
+/// Subscription to channel topics, which can be changed while subscribed
+type ChannelSubscription interface {
+	Subscription
+	Subscribe(channels ...string) error
+	Unsubscribe(channels ...string) error
+}
+
+/// State storage for claims, connections (with users/channels), workers, and messaging between the API and workers
+type Store interface {
+	/// Creates a claim, expiring at the claim's expiration
+	CreateClaim(claim *Claim) error
+	ClaimExists(id string) (bool, error)
+	/// Gets a claim. Returns nil if the claim doesn't exist
+	GetClaim(id string) (*Claim, error)
+	/// Gets claims, skipping claims that don't exist
+	GetClaims(ids []string) ([]*Claim, error)
+	DeleteClaims(ids []string) error
+	/// Resolves the claim IDs for the target (user & session, or channel)
+	ResolveClaims(target common.ResolveOptions) ([]string, error)
+	/// Adds a channel to the claims (that exist)
+	AddClaimsChannel(ids []string, channel string) error
+	/// Removes a channel from the claims (that exist)
+	RemoveClaimsChannel(ids []string, channel string) error
+
+	/// Sets connections (with their user/session/channels), expiring after the TTL unless refreshed
+	SetConnections(connections []*Connection, ttl time.Duration) error
+	DeleteConnection(connection *Connection) error
+	/// Adds the channel to the connection. The connection's channels must already include the channel
+	AddConnectionChannel(connection *Connection, channel string) error
+	/// Removes the channel from the connection. The connection's channels must already exclude the channel
+	RemoveConnectionChannel(connection *Connection, channel string) error
+	/// Resolves the connections for the target (connection ID, channel, or user & session)
+	ResolveConnections(target common.ResolveOptions) ([]*Connection, error)
+
+	/// Sets (registers) a worker, expiring after the TTL unless refreshed
+	SetWorker(worker *Worker, ttl time.Duration) error
+	/// Gets workers, skipping workers that don't exist
+	GetWorkers(ids []string) ([]*Worker, error)
+	/// Lists all registered workers (that haven't expired)
+	ListWorkers() ([]*Worker, error)
+	DeleteWorker(id string) error
+
+	/// Stores an API token by the hash of its secret (without the secret).
+	/// Returns false if a token with the same name is already stored
+	CreateToken(token *common.ApiToken) (bool, error)
+	/// Gets a stored API token by the hash of its secret. Returns nil if the token doesn't exist
+	GetToken(hash string) (*common.ApiToken, error)
+	/// Lists stored API tokens (without their secret)
+	ListTokens() ([]*common.ApiToken, error)
+	/// Deletes the stored API token with the name. Returns false if the token doesn't exist
+	DeleteToken(name string) (bool, error)
+
+	/// Counts a request against the key's rate limit (sliding window), if the request is allowed
+	RateLimit(key string, limit int, window time.Duration) (*RateLimit, error)
+
+	/// Publishes a message to workers
+	Publish(workerIds []string, messageType string, payload []byte) error
+	/// Subscribes to messages for a worker
+	Subscribe(workerId string, handler MessageHandler, onStatus StatusHandler) (Subscription, error)
+	/// Publishes a message to the workers subscribed to the channel's topic (pubsub channel fan-out)
+	PublishChannel(channel string, messageType string, payload []byte) error
+	/// Subscribes to channel topics (pubsub channel fan-out). Starts without any channel
+	SubscribeChannels(handler MessageHandler, onStatus StatusHandler) (ChannelSubscription, error)
+	/// Publishes a connection event to event subscribers. Events are not stored
+	PublishEvent(payload []byte) error
+	/// Subscribes to connection events published by all workers
+	SubscribeEvents(handler EventHandler, onStatus StatusHandler) (Subscription, error)
+
+	/// Checks that the store is reachable
+	Ping() error
+	Close() error
+}
+
+/// Pub/sub topic for a channel's messages (pubsub channel fan-out)
+func channelTopic(channel string) string {
+	return "channel-topic:" + channel
+}
+
+/// Pub/sub topic for connection events
+const eventsTopic = "events"
+
+/// Creates the store configured in the options
+func New(options *common.DSockOptions, logger *zap.Logger) Store {
+	if options.Store == common.StoreMemory {
+		return NewMemoryStore()
+	}
+
+	return &RedisStore{
+		Client:          NewRedisClient(options),
+		Logger:          logger,
+		MessagingMethod: options.MessagingMethod,
+		StreamMaxLength: options.StreamMaxLength,
+		StreamMaxAge:    options.StreamMaxAge,
+		// Same as the worker's TTL
+		StreamTtl: options.TtlDuration * 2,
+	}
+}
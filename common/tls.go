@@ -0,0 +1,251 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+/// Loads the PEM-encoded CA certificates from the file
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	rawCerts, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(rawCerts) {
+		return nil, errors.New("no certificates found in " + file)
+	}
+
+	return pool, nil
+}
+
+/// Loads the TLS config of a client, verifying servers with the CA file (or the system's CAs if empty),
+/// and presenting the certificate & key files (for mutual TLS) if set
+func LoadClientTls(caFile string, certFile string, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	var err error
+
+	if caFile != "" {
+		config.RootCAs, err = LoadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+/// Creates the TLS config of a client from LoadClientTls, reloading the certificate & key files when they change.
+/// Files are checked for changes at most every reload interval, on new connections
+func NewClientTls(caFile string, certFile string, keyFile string, reloadInterval time.Duration, logger *zap.Logger) (*tls.Config, error) {
+	config, err := LoadClientTls(caFile, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	if certFile == "" && keyFile == "" {
+		return config, nil
+	}
+
+	reloader, err := newTlsReloader(TlsOptions{
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		ReloadInterval: reloadInterval,
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return &reloader.current().Certificates[0], nil
+	}
+
+	return config, nil
+}
+
+/// Creates the HTTP client for direct messages to workers, using the direct client TLS config if set
+func NewDirectHttpClient(options *DSockOptions) *http.Client {
+	if options.DirectClientTls == nil {
+		return http.DefaultClient
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = options.DirectClientTls
+
+	return &http.Client{
+		Transport: transport,
+	}
+}
+
+/// Certificate (and client CAs) loaded from files, reloaded when the files change (such as rotated by cert-manager)
+type tlsReloader struct {
+	options TlsOptions
+	logger  *zap.Logger
+
+	/// Protocols negotiated with ALPN, copied to the loaded config
+	nextProtos []string
+
+	mutex  sync.Mutex
+	config *tls.Config
+	/// Modification times of the files when last loaded
+	modTimes  map[string]time.Time
+	checkedAt time.Time
+}
+
+/// Creates the TLS config of a server from the TLS options, reloading the certificate & client CAs when the files change.
+/// Files are checked for changes at most every reload interval, on new connections
+func NewServerTls(options TlsOptions, logger *zap.Logger) (*tls.Config, error) {
+	reloader, err := newTlsReloader(options, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:   options.MinVersion,
+		CipherSuites: options.CipherSuites,
+		// HTTP servers only serve HTTP/2 if listed
+		NextProtos: reloader.nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return reloader.current(), nil
+		},
+		// Used by servers checking for a certificate before serving
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &reloader.current().Certificates[0], nil
+		},
+	}, nil
+}
+
+/// Creates a reloader, loading the files
+func newTlsReloader(options TlsOptions, logger *zap.Logger) (*tlsReloader, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	reloader := &tlsReloader{
+		options:    options,
+		logger:     logger,
+		nextProtos: []string{"h2", "http/1.1"},
+	}
+
+	err := reloader.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+func (reloader *tlsReloader) files() []string {
+	return RemoveEmpty([]string{reloader.options.CertFile, reloader.options.KeyFile, reloader.options.ClientCaFile})
+}
+
+/// Loads the certificate & client CAs. Must be called with the mutex locked (or before serving)
+func (reloader *tlsReloader) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range reloader.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+
+		modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(reloader.options.CertFile, reloader.options.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   reloader.options.MinVersion,
+		CipherSuites: reloader.options.CipherSuites,
+		NextProtos:   reloader.nextProtos,
+	}
+
+	if reloader.options.ClientCaFile != "" {
+		config.ClientCAs, err = LoadCertPool(reloader.options.ClientCaFile)
+		if err != nil {
+			return err
+		}
+
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		if reloader.options.ClientAuth == TlsClientAuthVerifyIfGiven {
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	reloader.config = config
+	reloader.modTimes = modTimes
+
+	return nil
+}
+
+/// If any of the files changed since last loaded
+func (reloader *tlsReloader) changed() bool {
+	for _, file := range reloader.files() {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(reloader.modTimes[file]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/// Returns the current config, reloading it if the files changed
+func (reloader *tlsReloader) current() *tls.Config {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	if reloader.options.ReloadInterval > 0 && time.Since(reloader.checkedAt) >= reloader.options.ReloadInterval {
+		reloader.checkedAt = time.Now()
+
+		if reloader.changed() {
+			// On failure (such as the certificate being updated before the key), the previous certificate is kept until the next check
+			err := reloader.load()
+			if err != nil {
+				reloader.logger.Error("Could not reload TLS certificate",
+					zap.Error(err),
+					zap.String("certFile", reloader.options.CertFile),
+				)
+			} else {
+				reloader.logger.Info("Reloaded TLS certificate",
+					zap.String("certFile", reloader.options.CertFile),
+				)
+			}
+		}
+	}
+
+	return reloader.config
+}
+
+/// Listens on the server's address, over HTTPS if the server has a TLS config
+func ListenAndServe(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		// Certificates are in the TLS config
+		return srv.ListenAndServeTLS("", "")
+	}
+
+	return srv.ListenAndServe()
+}
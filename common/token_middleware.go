@@ -2,32 +2,37 @@ package common
 
 import "github.com/gin-gonic/gin"
 
-/// Validates that token matches from query parameter or from Authorization header
-func TokenMiddleware(token string) gin.HandlerFunc {
-	isAuthorized := func(c *gin.Context) bool {
-		if token == c.Query("token") {
-			return true
-		}
+/// Context key of the token the request was authorized with
+const TokenContextKey = "token"
 
-		tokenHeader := c.GetHeader("Authorization")
-		if len(tokenHeader) > 7 {
-			// Removes "Bearer "
-			if token == tokenHeader[7:] {
-				return true
-			}
-		}
+/// Gets the token from query parameter or from Authorization header
+func GetRequestToken(c *gin.Context) string {
+	if token := c.Query("token"); token != "" {
+		return token
+	}
 
-		return false
+	tokenHeader := c.GetHeader("Authorization")
+	if len(tokenHeader) > 7 {
+		// Removes "Bearer "
+		return tokenHeader[7:]
 	}
 
+	return ""
+}
+
+/// Validates that token matches from query parameter or from Authorization header
+func TokenMiddleware(token string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if !isAuthorized(c) {
+		if GetRequestToken(c) != token {
 			apiError := ApiError{
 				StatusCode: 400,
 				ErrorCode:  ErrorInvalidAuthorization,
 			}
 
 			apiError.Send(c)
+			return
 		}
+
+		c.Set(TokenContextKey, token)
 	}
 }
@@ -0,0 +1,83 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+const ScopeSend = "send"
+const ScopeClaim = "claim"
+const ScopeInfo = "info"
+const ScopeDisconnect = "disconnect"
+const ScopeChannel = "channel"
+
+/// All scopes, given to the main token
+var Scopes = []string{ScopeSend, ScopeClaim, ScopeInfo, ScopeDisconnect, ScopeChannel}
+
+/// API token with scopes, and optional restrictions on the targets it can act on
+type ApiToken struct {
+	Name string `mapstructure:"name" json:"name"`
+	/// Secret sent by the client. Tokens are stored by the hash of their secret, without the secret
+	Token string `mapstructure:"token" json:"-"`
+	/// Scopes (send, claim, info, disconnect and channel) the token can use
+	Scopes []string `mapstructure:"scopes" json:"scopes"`
+	/// Channels the token can target. Empty to not restrict channels (unless UserPrefixes is set)
+	Channels []string `mapstructure:"channels" json:"channels,omitempty"`
+	/// Prefixes of users the token can target. Empty to not restrict users (unless Channels is set)
+	UserPrefixes []string `mapstructure:"user_prefixes" json:"userPrefixes,omitempty"`
+}
+
+/// Hashes a token's secret, to find and store tokens without their secret
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(hash[:])
+}
+
+/// Validates the token's name & scopes
+func (token *ApiToken) Validate() error {
+	if token.Name == "" {
+		return errors.New("token name is required")
+	}
+
+	if len(token.Scopes) == 0 {
+		return errors.New("token " + token.Name + " has no scopes")
+	}
+
+	for _, scope := range token.Scopes {
+		if !IncludesString(Scopes, scope) {
+			return errors.New("token " + token.Name + " has an invalid scope: " + scope)
+		}
+	}
+
+	return nil
+}
+
+func (token *ApiToken) HasScope(scope string) bool {
+	return IncludesString(token.Scopes, scope)
+}
+
+/// If the token can only target some channels or users
+func (token *ApiToken) Restricted() bool {
+	return len(token.Channels) != 0 || len(token.UserPrefixes) != 0
+}
+
+func (token *ApiToken) AllowsChannel(channel string) bool {
+	return !token.Restricted() || IncludesString(token.Channels, channel)
+}
+
+func (token *ApiToken) AllowsUser(user string) bool {
+	if !token.Restricted() {
+		return true
+	}
+
+	for _, prefix := range token.UserPrefixes {
+		if strings.HasPrefix(user, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
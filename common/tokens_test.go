@@ -0,0 +1,55 @@
+package common_test
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type TokensSuite struct {
+	suite.Suite
+}
+
+func TestTokensSuite(t *testing.T) {
+	suite.Run(t, new(TokensSuite))
+}
+
+func (suite *TokensSuite) TestValidate() {
+	suite.NoError((&common.ApiToken{Name: "a", Scopes: []string{common.ScopeSend}}).Validate())
+	suite.Error((&common.ApiToken{Scopes: []string{common.ScopeSend}}).Validate(), "Name should be required")
+	suite.Error((&common.ApiToken{Name: "a"}).Validate(), "Scopes should be required")
+	suite.Error((&common.ApiToken{Name: "a", Scopes: []string{"invalid"}}).Validate(), "Scopes should be valid")
+}
+
+func (suite *TokensSuite) TestUnrestricted() {
+	token := &common.ApiToken{Scopes: []string{common.ScopeInfo}}
+
+	suite.True(token.HasScope(common.ScopeInfo))
+	suite.False(token.HasScope(common.ScopeSend))
+	suite.False(token.Restricted())
+	suite.True(token.AllowsChannel("a"))
+	suite.True(token.AllowsUser("a"))
+}
+
+func (suite *TokensSuite) TestRestricted() {
+	token := &common.ApiToken{
+		Channels:     []string{"news"},
+		UserPrefixes: []string{"chat-"},
+	}
+
+	suite.True(token.Restricted())
+	suite.True(token.AllowsChannel("news"))
+	suite.False(token.AllowsChannel("other"))
+	suite.True(token.AllowsUser("chat-1"))
+	suite.False(token.AllowsUser("1"))
+
+	channelsToken := &common.ApiToken{Channels: []string{"news"}}
+	suite.False(channelsToken.AllowsUser("chat-1"), "Token restricted to channels should not allow users")
+}
+
+func (suite *TokensSuite) TestHashToken() {
+	suite.Equal(
+		"ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		common.HashToken("abc"),
+	)
+}
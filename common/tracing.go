@@ -0,0 +1,136 @@
+package common
+
+import (
+	"context"
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"time"
+)
+
+/// Tracer for all dSock spans
+var Tracer = otel.Tracer("github.com/Cretezy/dSock")
+
+/// Sets up W3C trace context propagation, and exporting traces through OTLP (HTTP) when `tracing_endpoint` is set.
+/// Returns a function flushing & stopping the exporter
+func SetupTracing(options *DSockOptions, serviceName string, logger *zap.Logger) (func(), error) {
+	// Always propagate, to pass through the trace context of API requests even when not exporting
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if options.Tracing.Endpoint == "" {
+		return func() {}, nil
+	}
+
+	exporterOptions := []otlptracehttp.Option{otlptracehttp.WithEndpoint(options.Tracing.Endpoint)}
+	if options.Tracing.Insecure {
+		exporterOptions = append(exporterOptions, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), exporterOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(options.Tracing.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName),
+			semconv.ServiceVersionKey.String(DSockVersion),
+		)),
+	)
+
+	otel.SetTracerProvider(tracerProvider)
+
+	logger.Info("Exporting traces",
+		zap.String("endpoint", options.Tracing.Endpoint),
+		zap.Float64("sampleRatio", options.Tracing.SampleRatio),
+	)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := tracerProvider.Shutdown(ctx); err != nil {
+			logger.Error("Could not flush traces",
+				zap.Error(err),
+			)
+		}
+	}, nil
+}
+
+/// Starts a span for the request, continuing the trace context from the request's headers
+func TracingMiddleware(c *gin.Context) {
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+	ctx, span := Tracer.Start(ctx, c.Request.Method+" "+c.FullPath(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(c.Request.Method),
+			semconv.HTTPRouteKey.String(c.FullPath()),
+			attribute.String("dsock.request_id", requestid.Get(c)),
+		),
+	)
+	defer span.End()
+
+	c.Request = c.Request.WithContext(ctx)
+
+	c.Next()
+
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(c.Writer.Status()))
+}
+
+/// Ends the span, marking it as failed with the error (if any)
+func EndSpan(span trace.Span, apiError *ApiError) {
+	if apiError != nil {
+		if apiError.InternalError != nil {
+			span.RecordError(apiError.InternalError)
+		}
+
+		span.SetStatus(codes.Error, apiError.ErrorCode)
+	}
+
+	span.End()
+}
+
+/// Trace context carried in messages between the API and workers
+type traceContextCarrier map[string]string
+
+func (carrier traceContextCarrier) Get(key string) string {
+	return carrier[key]
+}
+
+func (carrier traceContextCarrier) Set(key string, value string) {
+	carrier[key] = value
+}
+
+func (carrier traceContextCarrier) Keys() []string {
+	keys := make([]string, 0, len(carrier))
+	for key := range carrier {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+/// Returns the trace context of the context's span, to be sent with a message
+func InjectTraceContext(ctx context.Context) map[string]string {
+	carrier := make(traceContextCarrier)
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	return carrier
+}
+
+/// Returns a context continuing the trace context received with a message
+func ExtractTraceContext(traceContext map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(context.Background(), traceContextCarrier(traceContext))
+}
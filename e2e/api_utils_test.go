@@ -1,7 +0,0 @@
-package dsock_test
-
-import (
-	"github.com/Cretezy/dSock-go"
-)
-
-var dSockClient = dsock.NewClient("http://api", "abc123")
@@ -0,0 +1,63 @@
+package dsock_test
+
+import (
+	"context"
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/e2e/harness"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryCapacityRecovers(t *testing.T) {
+	memory := uint64(32 * 1024 * 1024)
+
+	testHarness := harness.Start(t, harness.Options{
+		Configure: func(options *common.DSockOptions) {
+			options.MaxMemory = 64 * 1024 * 1024
+		},
+		MemoryUsage: func() uint64 {
+			return atomic.LoadUint64(&memory)
+		},
+	})
+
+	require.Eventually(t, func() bool {
+		return !atCapacity(t, testHarness)
+	}, time.Second*5, time.Millisecond*100, "Worker should accept connections")
+
+	// Memory spike over the limit
+	atomic.StoreUint64(&memory, 128*1024*1024)
+
+	require.Eventually(t, func() bool {
+		return atCapacity(t, testHarness)
+	}, time.Second*5, time.Millisecond*100, "Worker should be at capacity")
+
+	// Once the memory is released, the worker accepts connections again
+	atomic.StoreUint64(&memory, 32*1024*1024)
+
+	require.Eventually(t, func() bool {
+		return !atCapacity(t, testHarness)
+	}, time.Second*5, time.Millisecond*100, "Worker should accept connections after memory is released")
+}
+
+/// If connecting is rejected because the worker is at capacity
+func atCapacity(t *testing.T, testHarness *harness.Harness) bool {
+	t.Helper()
+
+	claim, err := testHarness.Client.CreateClaim(context.Background(), client.ClaimOptions{User: "capacity"})
+	require.NoError(t, err, "Error during claim creation")
+
+	conn, resp, err := websocket.DefaultDialer.Dial(testHarness.Worker().ConnectUrl("claim="+claim.Id), nil)
+	if err == nil {
+		_ = conn.Close()
+		return false
+	}
+
+	require.NotNil(t, resp, "Error during connection: %s", err)
+	_ = resp.Body.Close()
+
+	return resp.StatusCode == 503
+}
@@ -9,15 +9,17 @@ import (
 )
 
 type ChannelSuite struct {
-	suite.Suite
+	e2eSuite
 }
 
 func TestChannelSuite(t *testing.T) {
-	suite.Run(t, new(ChannelSuite))
+	runSuite(t, func(e2e e2eSuite) suite.TestingSuite {
+		return &ChannelSuite{e2e}
+	})
 }
 
 func (suite *ChannelSuite) TestChannelSubscribe() {
-	claim, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:    "channel",
 		Session: "subscribe",
 	})
@@ -25,14 +27,14 @@ func (suite *ChannelSuite) TestChannelSubscribe() {
 		return
 	}
 
-	conn, resp, err := websocket.DefaultDialer.Dial("ws://worker/connect?claim="+claim.Id, nil)
+	conn, resp, err := websocket.DefaultDialer.Dial(suite.connectUrl("claim="+claim.Id), nil)
 	if !checkConnectionError(suite.Suite, err, resp) {
 		return
 	}
 
 	defer conn.Close()
 
-	err = dSockClient.SubscribeChannel(dsock.ChannelOptions{
+	err = suite.dSockClient.SubscribeChannel(dsock.ChannelOptions{
 		Target: dsock.Target{
 			User:    "channel",
 			Session: "subscribe",
@@ -46,7 +48,7 @@ func (suite *ChannelSuite) TestChannelSubscribe() {
 	// Give it some time to propagate
 	time.Sleep(time.Millisecond * 100)
 
-	info, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+	info, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 		Target: dsock.Target{
 			Channel: "channel_subscribe",
 		},
@@ -76,7 +78,7 @@ func (suite *ChannelSuite) TestChannelSubscribe() {
 }
 
 func (suite *ChannelSuite) TestChannelUnsubscribe() {
-	claim, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:     "channel",
 		Session:  "unsubscribe",
 		Channels: []string{"channel_unsubscribe"},
@@ -85,14 +87,14 @@ func (suite *ChannelSuite) TestChannelUnsubscribe() {
 		return
 	}
 
-	conn, resp, err := websocket.DefaultDialer.Dial("ws://worker/connect?claim="+claim.Id, nil)
+	conn, resp, err := websocket.DefaultDialer.Dial(suite.connectUrl("claim="+claim.Id), nil)
 	if !checkConnectionError(suite.Suite, err, resp) {
 		return
 	}
 
 	defer conn.Close()
 
-	err = dSockClient.UnsubscribeChannel(dsock.ChannelOptions{
+	err = suite.dSockClient.UnsubscribeChannel(dsock.ChannelOptions{
 		Target: dsock.Target{
 			User:    "channel",
 			Session: "unsubscribe",
@@ -103,7 +105,7 @@ func (suite *ChannelSuite) TestChannelUnsubscribe() {
 		return
 	}
 
-	info, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+	info, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 		Target: dsock.Target{
 			User:    "channel",
 			Session: "unsubscribe",
@@ -133,7 +135,7 @@ func (suite *ChannelSuite) TestChannelUnsubscribe() {
 }
 
 func (suite *ChannelSuite) TestChannelClaim() {
-	_, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	_, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:    "channel",
 		Session: "subscribe_claim",
 	})
@@ -141,7 +143,7 @@ func (suite *ChannelSuite) TestChannelClaim() {
 		return
 	}
 
-	err = dSockClient.SubscribeChannel(dsock.ChannelOptions{
+	err = suite.dSockClient.SubscribeChannel(dsock.ChannelOptions{
 		Target: dsock.Target{
 			User:    "channel",
 			Session: "subscribe_claim",
@@ -152,7 +154,7 @@ func (suite *ChannelSuite) TestChannelClaim() {
 		return
 	}
 
-	info1, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+	info1, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 		Target: dsock.Target{
 			Channel: "channel_subscribe_claim",
 		},
@@ -180,7 +182,7 @@ func (suite *ChannelSuite) TestChannelClaim() {
 		return
 	}
 
-	err = dSockClient.UnsubscribeChannel(dsock.ChannelOptions{
+	err = suite.dSockClient.UnsubscribeChannel(dsock.ChannelOptions{
 		Target: dsock.Target{
 			User:    "channel",
 			Session: "subscribe_claim",
@@ -191,7 +193,7 @@ func (suite *ChannelSuite) TestChannelClaim() {
 		return
 	}
 
-	info2, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+	info2, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 		Target: dsock.Target{
 			Channel: "channel_subscribe_claim",
 		},
@@ -205,7 +207,7 @@ func (suite *ChannelSuite) TestChannelClaim() {
 	}
 }
 func (suite *ChannelSuite) TestChannelClaimIgnore() {
-	_, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	_, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:    "channel",
 		Session: "subscribe_claim_ignore",
 	})
@@ -213,7 +215,7 @@ func (suite *ChannelSuite) TestChannelClaimIgnore() {
 		return
 	}
 
-	err = dSockClient.SubscribeChannel(dsock.ChannelOptions{
+	err = suite.dSockClient.SubscribeChannel(dsock.ChannelOptions{
 		Target: dsock.Target{
 			User:    "channel",
 			Session: "subscribe_claim_ignore",
@@ -225,7 +227,7 @@ func (suite *ChannelSuite) TestChannelClaimIgnore() {
 		return
 	}
 
-	info, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+	info, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 		Target: dsock.Target{
 			Channel: "channel_subscribe_claim_ignore",
 		},
@@ -0,0 +1,127 @@
+package dsock_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/e2e/harness"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+const connectionLimit = 2
+
+func TestConnectionLimits(t *testing.T) {
+	for _, limit := range []string{"user", "session"} {
+		for _, policy := range []string{common.ConnectionLimitPolicyReject, common.ConnectionLimitPolicyEvictOldest} {
+			limit, policy := limit, policy
+
+			t.Run(limit+"_"+policy, func(t *testing.T) {
+				testHarness := harness.Start(t, harness.Options{
+					Configure: func(options *common.DSockOptions) {
+						if limit == "user" {
+							options.MaxConnectionsPerUser = connectionLimit
+						} else {
+							options.MaxConnectionsPerSession = connectionLimit
+						}
+						options.ConnectionLimitPolicy = policy
+					},
+				})
+
+				// With the session limit, each session is limited separately
+				claimOptions := func(index int) client.ClaimOptions {
+					if limit == "user" {
+						return client.ClaimOptions{User: "limits", Session: string(rune('a' + index))}
+					}
+
+					return client.ClaimOptions{User: "limits", Session: "session"}
+				}
+
+				conns := make([]*harness.Conn, 0, connectionLimit)
+				for index := 0; index < connectionLimit; index++ {
+					conn := testHarness.ConnectClaim(t, claimOptions(index))
+					require.NotNil(t, conn, "Could not connect")
+
+					conns = append(conns, conn)
+				}
+
+				if limit == "session" {
+					// Other sessions of the user aren't limited
+					otherConn := testHarness.ConnectClaim(t, client.ClaimOptions{User: "limits", Session: "other"})
+					require.NotNil(t, otherConn, "Could not connect to other session")
+				}
+
+				if policy == common.ConnectionLimitPolicyReject {
+					expectConnectionLimit(t, testHarness, claimOptions(connectionLimit))
+
+					// Existing connections are kept
+					conns[0].ExpectNoMessage(t, harness.ReceiveTimeout/10)
+					return
+				}
+
+				newConn := testHarness.ConnectClaim(t, claimOptions(connectionLimit))
+				require.NotNil(t, newConn, "Could not connect over the limit")
+
+				conns[0].ExpectClose(t, common.CloseCodeConnectionLimit)
+				conns[1].ExpectNoMessage(t, harness.ReceiveTimeout/10)
+			})
+		}
+	}
+}
+
+func TestConnectionLimitsFailedUpgrade(t *testing.T) {
+	testHarness := harness.Start(t, harness.Options{
+		Configure: func(options *common.DSockOptions) {
+			options.MaxConnectionsPerUser = connectionLimit
+			options.ConnectionLimitPolicy = common.ConnectionLimitPolicyReject
+		},
+	})
+
+	// Connections are registered in the store before upgrading. Failing to upgrade (here, a plain HTTP request)
+	// must not leave the connection counted against the limit
+	for index := 0; index < connectionLimit; index++ {
+		claim, err := testHarness.Client.CreateClaim(context.Background(), client.ClaimOptions{User: "failed_upgrade"})
+		require.NoError(t, err, "Error during claim creation")
+
+		resp, err := http.Get(testHarness.Worker().Url + common.PathConnect + "?claim=" + claim.Id)
+		require.NoError(t, err, "Error during connect request")
+		_ = resp.Body.Close()
+
+		assert.Equal(t, 400, resp.StatusCode, "Incorrect status code for request without upgrade")
+	}
+
+	for index := 0; index < connectionLimit; index++ {
+		conn := testHarness.ConnectClaim(t, client.ClaimOptions{User: "failed_upgrade"})
+		require.NotNil(t, conn, "Could not connect after failed upgrades")
+	}
+
+	expectConnectionLimit(t, testHarness, client.ClaimOptions{User: "failed_upgrade"})
+}
+
+/// Asserts that connecting with a new claim is rejected with the connection limit error
+func expectConnectionLimit(t *testing.T, testHarness *harness.Harness, claimOptions client.ClaimOptions) {
+	t.Helper()
+
+	claim, err := testHarness.Client.CreateClaim(context.Background(), claimOptions)
+	require.NoError(t, err, "Error during claim creation")
+
+	conn, resp, err := websocket.DefaultDialer.Dial(testHarness.Worker().ConnectUrl("claim="+claim.Id), nil)
+	if err == nil {
+		_ = conn.Close()
+	}
+	require.Error(t, err, "Connection over the limit should be rejected")
+	require.NotNil(t, resp, "No response for rejected connection")
+	defer resp.Body.Close()
+
+	assert.Equal(t, 429, resp.StatusCode, "Incorrect status code")
+
+	body := struct {
+		ErrorCode string `json:"errorCode"`
+	}{}
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, common.ErrorConnectionLimit, body.ErrorCode, "Incorrect error code")
+}
@@ -0,0 +1,240 @@
+package dsock_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/e2e/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDirectAuth(t *testing.T) {
+	for _, directAuth := range []string{common.DirectAuthToken, common.DirectAuthHmac} {
+		for _, listener := range []bool{false, true} {
+			directAuth, listener := directAuth, listener
+
+			name := directAuth
+			if listener {
+				name += "_listener"
+			}
+
+			t.Run(name, func(t *testing.T) {
+				testHarness := harness.Start(t, harness.Options{
+					MessagingMethod: common.MessageMethodDirect,
+					Configure: func(options *common.DSockOptions) {
+						options.DirectAuth = directAuth
+						options.DirectHmacSecret = "direct_secret"
+						if listener {
+							options.DirectListenAddress = "127.0.0.1:0"
+						}
+					},
+				})
+				worker := testHarness.Worker()
+
+				conn := testHarness.ConnectClaim(t, client.ClaimOptions{User: "direct_" + name})
+				require.NotNil(t, conn, "Could not connect")
+
+				err := testHarness.Client.Send(context.Background(), common.ResolveOptions{
+					User: "direct_" + name,
+				}, client.MessageTypeText, []byte("Hello world!"))
+				require.NoError(t, err, "Error during sending")
+
+				conn.ExpectText(t, "Hello world!")
+
+				// Messages without the token or signature are rejected
+				resp, err := http.Post(worker.DirectUrl+common.PathReceiveMessage, "application/protobuf", strings.NewReader(""))
+				require.NoError(t, err, "Error during direct request")
+				_ = resp.Body.Close()
+
+				if directAuth == common.DirectAuthHmac {
+					assert.Equal(t, 401, resp.StatusCode, "Incorrect status code for unsigned request")
+				} else {
+					assert.Equal(t, 400, resp.StatusCode, "Incorrect status code for unauthorized request")
+				}
+
+				if listener {
+					// Direct messaging endpoints are only on the direct listener
+					resp, err := http.Post(worker.Url+common.PathReceiveMessage, "application/protobuf", strings.NewReader(""))
+					require.NoError(t, err, "Error during public request")
+					_ = resp.Body.Close()
+
+					assert.Equal(t, 404, resp.StatusCode, "Incorrect status code for public request")
+				}
+			})
+		}
+	}
+}
+
+func TestDirectAuthWithoutSecret(t *testing.T) {
+	for _, directAuth := range []string{common.DirectAuthToken, common.DirectAuthHmac} {
+		directAuth := directAuth
+
+		t.Run(directAuth, func(t *testing.T) {
+			// Options validation rejects this, but embedded servers can still be built with an empty token & secret
+			testHarness := harness.Start(t, harness.Options{
+				MessagingMethod: common.MessageMethodDirect,
+				Configure: func(options *common.DSockOptions) {
+					options.DirectAuth = directAuth
+					options.Token = ""
+					options.DirectHmacSecret = ""
+				},
+			})
+
+			// Unauthenticated requests (and requests signed with the empty secret) are rejected
+			path := common.PathReceiveMessage
+			req, err := http.NewRequest("POST", testHarness.Worker().DirectUrl+path, strings.NewReader(""))
+			require.NoError(t, err, "Error during creating direct request")
+			common.AuthorizeDirectRequest(&common.DSockOptions{DirectAuth: directAuth}, req, path, []byte{})
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err, "Error during direct request")
+			_ = resp.Body.Close()
+
+			assert.Equal(t, 401, resp.StatusCode, "Incorrect status code for unauthenticated request")
+		})
+	}
+}
+
+func TestDirectBodyLimit(t *testing.T) {
+	testHarness := harness.Start(t, harness.Options{
+		MessagingMethod: common.MessageMethodDirect,
+		Configure: func(options *common.DSockOptions) {
+			options.DirectAuth = common.DirectAuthHmac
+			options.DirectHmacSecret = "direct_secret"
+			options.DirectMaxBodySize = 1024
+		},
+	})
+
+	path := common.PathReceiveMessage
+	body := bytes.Repeat([]byte("a"), 2048)
+
+	directRequest := func(signed bool) *http.Response {
+		req, err := http.NewRequest("POST", testHarness.Worker().DirectUrl+path, bytes.NewReader(body))
+		require.NoError(t, err, "Error during creating direct request")
+		req.Header.Set("Content-Type", common.ProtobufContentType)
+		if signed {
+			req.Header.Set(common.DirectSignatureHeader, common.SignDirectRequest("direct_secret", path, body, time.Now()))
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err, "Error during direct request")
+		_ = resp.Body.Close()
+
+		return resp
+	}
+
+	// Unsigned requests are rejected before reading the body
+	assert.Equal(t, 401, directRequest(false).StatusCode, "Incorrect status code for unsigned request")
+
+	assert.Equal(t, 413, directRequest(true).StatusCode, "Incorrect status code for too large request")
+}
+
+func TestDirectWorkerToWorker(t *testing.T) {
+	testHarness := harness.Start(t, harness.Options{
+		MessagingMethod: common.MessageMethodDirect,
+		Workers:         2,
+		Configure: func(options *common.DSockOptions) {
+			options.DirectAuth = common.DirectAuthHmac
+			options.SingleConnectionPerSession = true
+		},
+	})
+
+	// The second worker asks the first worker (through direct messaging) to close the previous connection
+	firstConn := testHarness.Workers[0].ConnectClaim(t, client.ClaimOptions{User: "direct_workers", Session: "session"})
+	require.NotNil(t, firstConn, "Could not connect")
+
+	secondConn := testHarness.Workers[1].ConnectClaim(t, client.ClaimOptions{User: "direct_workers", Session: "session"})
+	require.NotNil(t, secondConn, "Could not connect")
+
+	firstConn.ExpectClose(t, common.CloseCodeConnectionLimit)
+}
+
+func TestDirectTls(t *testing.T) {
+	certificates := harness.NewCertificates(t)
+
+	var directClientTls *tls.Config
+
+	testHarness := harness.Start(t, harness.Options{
+		MessagingMethod: common.MessageMethodDirect,
+		Workers:         2,
+		Configure: func(options *common.DSockOptions) {
+			var err error
+
+			options.DirectListenAddress = "127.0.0.1:0"
+			options.DirectTls, err = common.NewServerTls(common.TlsOptions{
+				CertFile:       certificates.ServerCertFile,
+				KeyFile:        certificates.ServerKeyFile,
+				ClientCaFile:   certificates.CaFile,
+				ClientAuth:     common.TlsClientAuthRequire,
+				MinVersion:     tls.VersionTLS12,
+				ReloadInterval: time.Millisecond * 10,
+			}, nil)
+			require.NoError(t, err, "Error during loading server TLS")
+			options.DirectClientTls, err = common.NewClientTls(certificates.CaFile, certificates.ClientCertFile, certificates.ClientKeyFile, time.Millisecond*10, nil)
+			require.NoError(t, err, "Error during loading client TLS")
+
+			directClientTls = options.DirectClientTls
+		},
+	})
+
+	workers, err := testHarness.Client.Workers(context.Background())
+	require.NoError(t, err, "Error during getting workers")
+	require.Len(t, workers, 2, "Incorrect number of workers")
+	assert.True(t, strings.HasPrefix(workers[0].DirectUrl, "https://"), "Incorrect direct URL: %s", workers[0].DirectUrl)
+
+	firstConn := testHarness.Workers[0].ConnectClaim(t, client.ClaimOptions{User: "direct_tls", Session: "first"})
+	secondConn := testHarness.Workers[1].ConnectClaim(t, client.ClaimOptions{User: "direct_tls", Session: "second"})
+	require.NotNil(t, firstConn, "Could not connect")
+	require.NotNil(t, secondConn, "Could not connect")
+
+	err = testHarness.Client.Send(context.Background(), common.ResolveOptions{
+		User: "direct_tls",
+	}, client.MessageTypeText, []byte("Hello world!"))
+	require.NoError(t, err, "Error during sending")
+
+	firstConn.ExpectText(t, "Hello world!")
+	secondConn.ExpectText(t, "Hello world!")
+
+	// Clients without a certificate signed by the CA are rejected
+	clientTls, err := common.LoadClientTls(certificates.CaFile, "", "")
+	require.NoError(t, err, "Error during loading client TLS")
+
+	httpClient := common.NewDirectHttpClient(&common.DSockOptions{DirectClientTls: clientTls})
+
+	_, err = httpClient.Post(testHarness.Worker().DirectUrl+common.PathReceiveMessage, common.ProtobufContentType, strings.NewReader(""))
+	assert.Error(t, err, "Request without a client certificate should be rejected")
+
+	// Rotate the server certificate (keeping the client CA)
+	rotated := harness.NewCertificates(t)
+	copyFile(t, rotated.ServerCertFile, certificates.ServerCertFile)
+	copyFile(t, rotated.ServerKeyFile, certificates.ServerKeyFile)
+
+	rotatedServerCert, err := ioutil.ReadFile(rotated.ServerCertFile)
+	require.NoError(t, err, "Error during reading rotated certificate")
+
+	time.Sleep(time.Millisecond * 20)
+
+	directAddress := strings.TrimPrefix(testHarness.Worker().DirectUrl, "https://")
+	assert.Equal(t, rotatedServerCert, servedCertificate(t, directAddress, directClientTls), "Rotated server certificate not served")
+
+	// Rotate the client certificate
+	copyFile(t, rotated.ClientCertFile, certificates.ClientCertFile)
+	copyFile(t, rotated.ClientKeyFile, certificates.ClientKeyFile)
+
+	rotatedClientCert, err := ioutil.ReadFile(rotated.ClientCertFile)
+	require.NoError(t, err, "Error during reading rotated certificate")
+
+	time.Sleep(time.Millisecond * 20)
+
+	clientCert, err := directClientTls.GetClientCertificate(&tls.CertificateRequestInfo{})
+	require.NoError(t, err, "Error during getting client certificate")
+	assert.Equal(t, rotatedClientCert, pemCertificate(clientCert.Certificate[0]), "Rotated client certificate not presented")
+}
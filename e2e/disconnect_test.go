@@ -2,36 +2,42 @@ package dsock_test
 
 import (
 	dsock "github.com/Cretezy/dSock-go"
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/common/protos"
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/suite"
+	"strconv"
 	"testing"
 	"time"
 )
 
 type DisconnectSuite struct {
-	suite.Suite
+	e2eSuite
 }
 
 func TestDisconnectSuite(t *testing.T) {
-	suite.Run(t, new(DisconnectSuite))
+	runSuite(t, func(e2e e2eSuite) suite.TestingSuite {
+		return &DisconnectSuite{e2e}
+	})
 }
 
 func (suite *DisconnectSuite) TestUserDisconnect() {
-	claim, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User: "disconnect_user",
 	})
 	if !checkRequestError(suite.Suite, err, "claim creation") {
 		return
 	}
 
-	conn, resp, err := websocket.DefaultDialer.Dial("ws://worker/connect?claim="+claim.Id, nil)
+	conn, resp, err := websocket.DefaultDialer.Dial(suite.connectUrl("claim="+claim.Id), nil)
 	if !checkConnectionError(suite.Suite, err, resp) {
 		return
 	}
 
 	defer conn.Close()
 
-	err = dSockClient.Disconnect(dsock.DisconnectOptions{
+	err = suite.dSockClient.Disconnect(dsock.DisconnectOptions{
 		Target: dsock.Target{
 			User: "disconnect_user",
 		},
@@ -55,7 +61,7 @@ func (suite *DisconnectSuite) TestUserDisconnect() {
 }
 
 func (suite *DisconnectSuite) TestSessionDisconnect() {
-	claim, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:    "disconnect",
 		Session: "session",
 	})
@@ -63,14 +69,14 @@ func (suite *DisconnectSuite) TestSessionDisconnect() {
 		return
 	}
 
-	conn, resp, err := websocket.DefaultDialer.Dial("ws://worker/connect?claim="+claim.Id, nil)
+	conn, resp, err := websocket.DefaultDialer.Dial(suite.connectUrl("claim="+claim.Id), nil)
 	if !checkConnectionError(suite.Suite, err, resp) {
 		return
 	}
 
 	defer conn.Close()
 
-	err = dSockClient.Disconnect(dsock.DisconnectOptions{
+	err = suite.dSockClient.Disconnect(dsock.DisconnectOptions{
 		Target: dsock.Target{
 			User:    "disconnect",
 			Session: "session",
@@ -95,7 +101,7 @@ func (suite *DisconnectSuite) TestSessionDisconnect() {
 }
 
 func (suite *DisconnectSuite) TestConnectionDisconnect() {
-	claim, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:    "disconnect",
 		Session: "connection",
 	})
@@ -103,14 +109,14 @@ func (suite *DisconnectSuite) TestConnectionDisconnect() {
 		return
 	}
 
-	conn, resp, err := websocket.DefaultDialer.Dial("ws://worker/connect?claim="+claim.Id, nil)
+	conn, resp, err := websocket.DefaultDialer.Dial(suite.connectUrl("claim="+claim.Id), nil)
 	if !checkConnectionError(suite.Suite, err, resp) {
 		return
 	}
 
 	defer conn.Close()
 
-	info, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+	info, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 		Target: dsock.Target{
 			User:    "disconnect",
 			Session: "connection",
@@ -127,7 +133,7 @@ func (suite *DisconnectSuite) TestConnectionDisconnect() {
 
 	id := infoConnections[0].Id
 
-	err = dSockClient.Disconnect(dsock.DisconnectOptions{
+	err = suite.dSockClient.Disconnect(dsock.DisconnectOptions{
 		Target: dsock.Target{
 			Id: id,
 		},
@@ -151,7 +157,7 @@ func (suite *DisconnectSuite) TestConnectionDisconnect() {
 }
 
 func (suite *DisconnectSuite) TestNoSessionDisconnect() {
-	claim, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:    "disconnect",
 		Session: "no_session",
 	})
@@ -159,7 +165,7 @@ func (suite *DisconnectSuite) TestNoSessionDisconnect() {
 		return
 	}
 
-	conn, resp, err := websocket.DefaultDialer.Dial("ws://worker/connect?claim="+claim.Id, nil)
+	conn, resp, err := websocket.DefaultDialer.Dial(suite.connectUrl("claim="+claim.Id), nil)
 	if !checkConnectionError(suite.Suite, err, resp) {
 		return
 	}
@@ -172,7 +178,7 @@ func (suite *DisconnectSuite) TestNoSessionDisconnect() {
 		_, _, websocketErr = conn.ReadMessage()
 	}()
 
-	err = dSockClient.Disconnect(dsock.DisconnectOptions{
+	err = suite.dSockClient.Disconnect(dsock.DisconnectOptions{
 		Target: dsock.Target{
 			User:    "disconnect",
 			Session: "no_session_bad",
@@ -191,7 +197,7 @@ func (suite *DisconnectSuite) TestNoSessionDisconnect() {
 }
 
 func (suite *DisconnectSuite) TestDisconnectExpireClaim() {
-	_, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	_, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:    "disconnect",
 		Session: "expire_claim",
 	})
@@ -199,7 +205,7 @@ func (suite *DisconnectSuite) TestDisconnectExpireClaim() {
 		return
 	}
 
-	infoBefore, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+	infoBefore, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 		Target: dsock.Target{
 			User:    "disconnect",
 			Session: "expire_claim",
@@ -213,7 +219,7 @@ func (suite *DisconnectSuite) TestDisconnectExpireClaim() {
 		return
 	}
 
-	err = dSockClient.Disconnect(dsock.DisconnectOptions{
+	err = suite.dSockClient.Disconnect(dsock.DisconnectOptions{
 		Target: dsock.Target{
 			User:    "disconnect",
 			Session: "expire_claim",
@@ -223,7 +229,7 @@ func (suite *DisconnectSuite) TestDisconnectExpireClaim() {
 		return
 	}
 
-	infoAfter, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+	infoAfter, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 		Target: dsock.Target{
 			User:    "disconnect",
 			Session: "expire_claim",
@@ -239,14 +245,14 @@ func (suite *DisconnectSuite) TestDisconnectExpireClaim() {
 }
 
 func (suite *DisconnectSuite) TestDisconnectKeepClaim() {
-	_, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	_, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:    "disconnect",
 		Session: "keep_claim",
 	})
 	if !checkRequestError(suite.Suite, err, "claim creation") {
 		return
 	}
-	infoBefore, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+	infoBefore, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 		Target: dsock.Target{
 			User:    "disconnect",
 			Session: "keep_claim",
@@ -260,7 +266,7 @@ func (suite *DisconnectSuite) TestDisconnectKeepClaim() {
 		return
 	}
 
-	err = dSockClient.Disconnect(dsock.DisconnectOptions{
+	err = suite.dSockClient.Disconnect(dsock.DisconnectOptions{
 		Target: dsock.Target{
 			User:    "disconnect",
 			Session: "keep_claim_invalid",
@@ -271,7 +277,7 @@ func (suite *DisconnectSuite) TestDisconnectKeepClaim() {
 		return
 	}
 
-	infoAfter, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+	infoAfter, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 		Target: dsock.Target{
 			User:    "disconnect",
 			Session: "keep_claim",
@@ -287,7 +293,7 @@ func (suite *DisconnectSuite) TestDisconnectKeepClaim() {
 }
 
 func (suite *DisconnectSuite) TestChannelDisconnect() {
-	claim, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:     "disconnect",
 		Session:  "channel",
 		Channels: []string{"disconnect_channel"},
@@ -296,14 +302,14 @@ func (suite *DisconnectSuite) TestChannelDisconnect() {
 		return
 	}
 
-	conn, resp, err := websocket.DefaultDialer.Dial("ws://worker/connect?claim="+claim.Id, nil)
+	conn, resp, err := websocket.DefaultDialer.Dial(suite.connectUrl("claim="+claim.Id), nil)
 	if !checkConnectionError(suite.Suite, err, resp) {
 		return
 	}
 
 	defer conn.Close()
 
-	err = dSockClient.Disconnect(dsock.DisconnectOptions{
+	err = suite.dSockClient.Disconnect(dsock.DisconnectOptions{
 		Target: dsock.Target{
 			Channel: "disconnect_channel",
 		},
@@ -325,3 +331,30 @@ func (suite *DisconnectSuite) TestChannelDisconnect() {
 		suite.Failf("Incorrect error type: %s", err.Error())
 	}
 }
+
+func (suite *DisconnectSuite) TestDisconnectAfterSend() {
+	worker := suite.harness.Worker()
+
+	conn := worker.ConnectClaim(suite.T(), client.ClaimOptions{User: "disconnect_after_send"})
+	if !suite.NotNil(conn, "Could not connect") {
+		return
+	}
+
+	// Messages sent before a disconnect are sent before closing
+	for index := 0; index < 10; index++ {
+		deliverText(worker, "disconnect_after_send", []byte("message-"+strconv.Itoa(index)))
+	}
+
+	worker.Server.Deliver(common.MessageMessageType, &protos.Message{
+		Type:   protos.Message_DISCONNECT,
+		Target: &protos.Target{User: "disconnect_after_send"},
+	})
+
+	for index := 0; index < 10; index++ {
+		if !conn.ExpectText(suite.T(), "message-"+strconv.Itoa(index)) {
+			return
+		}
+	}
+
+	conn.ExpectClose(suite.T(), websocket.CloseNormalClosure)
+}
@@ -0,0 +1,161 @@
+package dsock_test
+
+import (
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/e2e/harness"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	drainWindow := time.Second
+	retryJitter := time.Millisecond * 500
+
+	testHarness := harness.Start(t, harness.Options{
+		Configure: func(options *common.DSockOptions) {
+			options.DrainWindow = drainWindow
+			options.DrainRetryJitter = retryJitter
+		},
+	})
+	worker := testHarness.Worker()
+
+	connectionCount := 4
+	conns := make([]*harness.Conn, 0, connectionCount)
+
+	for index := 0; index < connectionCount; index++ {
+		conn := worker.ConnectClaim(t, client.ClaimOptions{User: "drain", Session: strconv.Itoa(index)})
+		require.NotNil(t, conn, "Could not connect")
+
+		conns = append(conns, conn)
+	}
+
+	// Time at which each connection was closed, and its close error
+	closedAt := make([]time.Time, connectionCount)
+	closeErrors := make([]error, connectionCount)
+	var closedWaitGroup sync.WaitGroup
+	closedWaitGroup.Add(connectionCount)
+
+	for index, conn := range conns {
+		index := index
+		conn := conn
+
+		go func() {
+			defer closedWaitGroup.Done()
+
+			_ = conn.SetReadDeadline(time.Now().Add(drainWindow + harness.ReceiveTimeout))
+
+			for {
+				_, _, err := conn.ReadMessage()
+				if err != nil {
+					closedAt[index] = time.Now()
+					closeErrors[index] = err
+					return
+				}
+			}
+		}()
+	}
+
+	req, err := http.NewRequest("POST", worker.Url+common.PathDrain, nil)
+	require.NoError(t, err, "Error during creating drain request")
+	req.Header.Set("Authorization", "Bearer "+harness.Token)
+
+	drainedAt := time.Now()
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err, "Error during draining")
+	_ = resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode, "Incorrect status code for drain")
+
+	// Load-balancers stop sending connections to the worker
+	health := worker.Health(t)
+	assert.Equal(t, 503, health.StatusCode, "Incorrect health status code while draining")
+	assert.Equal(t, "draining", health.Status, "Incorrect health status while draining")
+
+	closedWaitGroup.Wait()
+
+	retryAfterRegexp := regexp.MustCompile(`^Reconnect;retry-after=(\d+)$`)
+
+	for index, err := range closeErrors {
+		closeError, ok := err.(*websocket.CloseError)
+		if !assert.Truef(t, ok, "Connection %d not closed: %s", index, err) {
+			continue
+		}
+
+		assert.Equal(t, common.CloseCodeReconnect, closeError.Code, "Incorrect close code")
+
+		match := retryAfterRegexp.FindStringSubmatch(closeError.Text)
+		if assert.NotNilf(t, match, "Incorrect close reason: %s", closeError.Text) {
+			retryAfter, _ := strconv.Atoi(match[1])
+			assert.Less(t, retryAfter, int(retryJitter/time.Millisecond), "Retry hint over the jitter")
+		}
+	}
+
+	// Closes are spread over the drain window (one every window / connections), not all at once
+	sort.Slice(closedAt, func(i, j int) bool {
+		return closedAt[i].Before(closedAt[j])
+	})
+
+	interval := drainWindow / time.Duration(connectionCount)
+
+	assert.Less(t, int64(closedAt[0].Sub(drainedAt)), int64(interval), "First connection should be closed right away")
+	assert.GreaterOrEqual(t, int64(closedAt[connectionCount-1].Sub(closedAt[0])), int64(interval*time.Duration(connectionCount-1)*8/10),
+		"Connections should be closed over the drain window")
+	assert.Less(t, int64(closedAt[connectionCount-1].Sub(drainedAt)), int64(drainWindow+interval), "Connections should be closed within the drain window")
+}
+
+func TestDrainWithoutToken(t *testing.T) {
+	testHarness := harness.Start(t, harness.Options{
+		Configure: func(options *common.DSockOptions) {
+			options.Token = ""
+		},
+	})
+	worker := testHarness.Worker()
+
+	// Anyone could send an empty token
+	resp, err := http.Post(worker.Url+common.PathDrain, "", nil)
+	require.NoError(t, err, "Error during draining")
+	_ = resp.Body.Close()
+
+	assert.Equal(t, 404, resp.StatusCode, "Drain endpoint should not be served without a token")
+	assert.Equal(t, 200, worker.Health(t).StatusCode, "Worker should not be draining")
+}
+
+func TestDrainShutdown(t *testing.T) {
+	testHarness := harness.Start(t, harness.Options{
+		Configure: func(options *common.DSockOptions) {
+			options.DrainWindow = time.Minute
+		},
+	})
+	worker := testHarness.Worker()
+
+	for index := 0; index < 2; index++ {
+		conn := worker.ConnectClaim(t, client.ClaimOptions{User: "drain_shutdown", Session: strconv.Itoa(index)})
+		require.NotNil(t, conn, "Could not connect")
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+
+		worker.Server.Drain()
+	}()
+
+	// Shutting down stops draining, instead of waiting for the rest of the drain window
+	time.Sleep(time.Millisecond * 100)
+	worker.Server.Shutdown()
+
+	select {
+	case <-drained:
+	case <-time.After(harness.ReceiveTimeout):
+		assert.Fail(t, "Draining not stopped by shutdown")
+	}
+}
@@ -0,0 +1,131 @@
+package harness
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/// PEM files of a test CA, and of server (for 127.0.0.1) & client certificates signed by it
+type Certificates struct {
+	CaFile         string
+	ServerCertFile string
+	ServerKeyFile  string
+	ClientCertFile string
+	ClientKeyFile  string
+}
+
+/// Generates a CA, and server & client certificates signed by it, in a temporary directory
+func NewCertificates(t testing.TB) *Certificates {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "dsock-certificates")
+	if err != nil {
+		t.Fatalf("Could not create certificates directory: %s", err)
+	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	certificates := &Certificates{
+		CaFile:         filepath.Join(dir, "ca.pem"),
+		ServerCertFile: filepath.Join(dir, "server.pem"),
+		ServerKeyFile:  filepath.Join(dir, "server-key.pem"),
+		ClientCertFile: filepath.Join(dir, "client.pem"),
+		ClientKeyFile:  filepath.Join(dir, "client-key.pem"),
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "dSock test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caKey := generateKey(t)
+	caCert := createCertificate(t, caTemplate, caTemplate, caKey, caKey, certificates.CaFile, "")
+
+	serverTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "dSock test server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	createCertificate(t, serverTemplate, caCert, generateKey(t), caKey, certificates.ServerCertFile, certificates.ServerKeyFile)
+
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "dSock test client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	createCertificate(t, clientTemplate, caCert, generateKey(t), caKey, certificates.ClientCertFile, certificates.ClientKeyFile)
+
+	return certificates
+}
+
+func generateKey(t testing.TB) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate key: %s", err)
+	}
+
+	return key
+}
+
+/// Creates the certificate signed by the parent, writing it (and its key, if keyFile is set) as PEM
+func createCertificate(t testing.TB, template *x509.Certificate, parent *x509.Certificate, key *ecdsa.PrivateKey, parentKey crypto.Signer, certFile string, keyFile string) *x509.Certificate {
+	t.Helper()
+
+	rawCert, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatalf("Could not create certificate: %s", err)
+	}
+
+	writePem(t, certFile, "CERTIFICATE", rawCert)
+
+	if keyFile != "" {
+		rawKey, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatalf("Could not marshal key: %s", err)
+		}
+
+		writePem(t, keyFile, "EC PRIVATE KEY", rawKey)
+	}
+
+	cert, err := x509.ParseCertificate(rawCert)
+	if err != nil {
+		t.Fatalf("Could not parse certificate: %s", err)
+	}
+
+	return cert
+}
+
+func writePem(t testing.TB, file string, blockType string, data []byte) {
+	t.Helper()
+
+	err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), 0600)
+	if err != nil {
+		t.Fatalf("Could not write %s: %s", file, err)
+	}
+}
@@ -0,0 +1,139 @@
+package harness
+
+import (
+	"context"
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+/// How long to wait for a message before failing
+const ReceiveTimeout = time.Second * 5
+
+/// WebSocket connection to a worker, with assertion helpers
+type Conn struct {
+	*websocket.Conn
+	/// Response to the WebSocket upgrade request
+	Response *http.Response
+}
+
+/// Returns the WebSocket URL to connect to the worker with the query (such as "claim=abc")
+func (worker *Worker) ConnectUrl(query string) string {
+	return "ws" + strings.TrimPrefix(worker.Url, "http") + common.PathConnect + "?" + query
+}
+
+/// Connects to the worker with the query (such as "claim=abc"). Returns nil (failing the test) if rejected
+func (worker *Worker) Connect(t testing.TB, query string) *Conn {
+	t.Helper()
+
+	conn, resp, err := websocket.DefaultDialer.Dial(worker.ConnectUrl(query), nil)
+	if err != nil {
+		body := ""
+		if resp != nil {
+			rawBody, _ := ioutil.ReadAll(resp.Body)
+			body = string(rawBody)
+		}
+
+		t.Errorf("Could not connect: %s (%s)", err, body)
+		return nil
+	}
+
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	// Connections are set in the store right after upgrading
+	time.Sleep(time.Millisecond * 10)
+
+	return &Conn{
+		Conn:     conn,
+		Response: resp,
+	}
+}
+
+/// Creates a claim and connects to the worker with it. Returns nil (failing the test) if either fails
+func (worker *Worker) ConnectClaim(t testing.TB, claimOptions client.ClaimOptions) *Conn {
+	t.Helper()
+
+	claim, err := worker.harness.Client.CreateClaim(context.Background(), claimOptions)
+	if !assert.NoError(t, err, "Error during claim creation") {
+		return nil
+	}
+
+	return worker.Connect(t, "claim="+claim.Id)
+}
+
+/// Creates a claim and connects to the first worker with it
+func (harness *Harness) ConnectClaim(t testing.TB, claimOptions client.ClaimOptions) *Conn {
+	t.Helper()
+
+	return harness.Worker().ConnectClaim(t, claimOptions)
+}
+
+/// Asserts that the next message has the type & data
+func (conn *Conn) ExpectMessage(t testing.TB, messageType int, expected string) bool {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(ReceiveTimeout))
+
+	receivedType, data, err := conn.ReadMessage()
+	if !assert.NoError(t, err, "Error during receiving message") {
+		return false
+	}
+
+	return assert.Equal(t, messageType, receivedType, "Incorrect message type") &&
+		assert.Equal(t, expected, string(data), "Incorrect message data")
+}
+
+/// Asserts that the next message is a text message with the data
+func (conn *Conn) ExpectText(t testing.TB, expected string) bool {
+	t.Helper()
+
+	return conn.ExpectMessage(t, websocket.TextMessage, expected)
+}
+
+/// Asserts that no message is received for the duration. The connection can't be read from afterwards
+func (conn *Conn) ExpectNoMessage(t testing.TB, wait time.Duration) bool {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(wait))
+
+	_, data, err := conn.ReadMessage()
+	if err == nil {
+		return assert.Failf(t, "Received unexpected message", "Message: %s", string(data))
+	}
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+
+	return assert.NoError(t, err, "Error during receiving message")
+}
+
+/// Asserts that the connection is closed with the close code, skipping messages received before
+func (conn *Conn) ExpectClose(t testing.TB, code int) bool {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(ReceiveTimeout))
+
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+
+		closeError, ok := err.(*websocket.CloseError)
+		if !ok {
+			return assert.Failf(t, "Connection not closed", "Error: %s", err)
+		}
+
+		return assert.Equal(t, code, closeError.Code, "Incorrect close code")
+	}
+}
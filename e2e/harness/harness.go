@@ -0,0 +1,235 @@
+package harness
+
+import (
+	"crypto/tls"
+	"github.com/Cretezy/dSock/api"
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/worker"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+/// Token of the API (and JWT secret of the workers)
+const Token = "abc123"
+
+/// All messaging methods, to run tests with each of them
+var MessagingMethods = []string{
+	common.MessageMethodDirect,
+	common.MessageMethodRedis,
+	common.MessageMethodRedisStreams,
+}
+
+type Options struct {
+	/// Defaults to direct
+	MessagingMethod string
+	/// Number of workers. Defaults to 1
+	Workers int
+	/// Changes the options of the API and each worker (after the defaults are set)
+	Configure func(options *common.DSockOptions)
+	/// Defaults to a no-op logger
+	Logger *zap.Logger
+	/// Memory used by each worker (in bytes). Defaults to the process's memory
+	MemoryUsage func() uint64
+}
+
+/// API and workers running in-process, against an embedded Redis server
+type Harness struct {
+	/// Embedded Redis-compatible server
+	Redis *miniredis.Miniredis
+	Api   *api.Server
+	/// URL of the API (without the path)
+	ApiUrl  string
+	Workers []*Worker
+	/// Client for the API
+	Client *client.Client
+
+	t         testing.TB
+	apiServer *httptest.Server
+}
+
+type Worker struct {
+	Server *worker.Server
+	/// URL of the worker (without the path)
+	Url string
+	/// URL of the direct messaging endpoints (without the path). Same as Url unless direct_listen_address is set
+	DirectUrl string
+
+	harness      *Harness
+	httpServer   *httptest.Server
+	directServer *httptest.Server
+}
+
+/// Returns the options of the API or a worker, with the default options (and the development config's token,
+/// JWT secret and `default_channels`)
+func (harness *Harness) newOptions(harnessOptions Options) *common.DSockOptions {
+	options, err := common.DefaultOptions(true)
+	if err != nil {
+		harness.t.Fatalf("Could not get default options: %s", err)
+	}
+
+	options.RedisOptions.Addrs = []string{harness.Redis.Addr()}
+	options.Token = Token
+	options.DirectHmacSecret = Token
+	options.Jwt.JwtSecret = Token
+	options.DefaultChannels = []string{"global"}
+	options.MessagingMethod = harnessOptions.MessagingMethod
+	// Faster shutdown (draining connections)
+	options.DrainWindow = time.Second
+
+	if options.MessagingMethod == "" {
+		options.MessagingMethod = common.MessageMethodDirect
+	}
+
+	if harnessOptions.Configure != nil {
+		harnessOptions.Configure(options)
+	}
+
+	return options
+}
+
+/// Starts the embedded Redis server, the API and the workers. Stopped when the test finishes
+func Start(t testing.TB, harnessOptions Options) *Harness {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+
+	logger := harnessOptions.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Could not start Redis: %s", err)
+	}
+
+	harness := &Harness{
+		Redis: redisServer,
+		t:     t,
+	}
+
+	t.Cleanup(harness.Close)
+
+	workerCount := harnessOptions.Workers
+	if workerCount == 0 {
+		workerCount = 1
+	}
+
+	for index := 0; index < workerCount; index++ {
+		options := harness.newOptions(harnessOptions)
+
+		// The API reaches the worker directly on the worker's own port (or direct listener, if direct_listen_address is set)
+		listener := listen(t)
+		directListener := listener
+		if options.DirectListenAddress != "" {
+			directListener = listen(t)
+			options.DirectListenAddress = directListener.Addr().String()
+		}
+
+		options.DirectHostname = "127.0.0.1"
+		options.DirectPort = directListener.Addr().(*net.TCPAddr).Port
+		options.PublicUrl = "http://" + listener.Addr().String()
+
+		workerServer := worker.NewServer(worker.ServerOptions{
+			Options:     options,
+			Logger:      logger,
+			MemoryUsage: harnessOptions.MemoryUsage,
+		})
+
+		testWorker := &Worker{
+			Server:     workerServer,
+			harness:    harness,
+			httpServer: serve(workerServer.Handler(), listener, nil),
+		}
+		testWorker.Url = testWorker.httpServer.URL
+		testWorker.DirectUrl = testWorker.Url
+
+		if options.DirectListenAddress != "" {
+			testWorker.directServer = serve(workerServer.DirectHandler(), directListener, options.DirectTls)
+			testWorker.DirectUrl = testWorker.directServer.URL
+		}
+
+		workerServer.Start()
+
+		harness.Workers = append(harness.Workers, testWorker)
+	}
+
+	harness.Api = api.NewServer(api.ServerOptions{
+		Options: harness.newOptions(harnessOptions),
+		Logger:  logger,
+	})
+	harness.apiServer = httptest.NewServer(harness.Api.Handler())
+	harness.ApiUrl = harness.apiServer.URL
+
+	harness.Client = client.New(client.Options{
+		Url:   harness.ApiUrl,
+		Token: Token,
+	})
+
+	return harness
+}
+
+/// Listens on a random local port
+func listen(t testing.TB) net.Listener {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+
+	return listener
+}
+
+/// Serves the handler on the listener, with TLS if tlsConfig is set
+func serve(handler http.Handler, listener net.Listener, tlsConfig *tls.Config) *httptest.Server {
+	server := httptest.NewUnstartedServer(handler)
+	_ = server.Listener.Close()
+	server.Listener = listener
+
+	if tlsConfig != nil {
+		server.TLS = tlsConfig
+		server.StartTLS()
+	} else {
+		server.Start()
+	}
+
+	return server
+}
+
+/// Stops the API, the workers and the Redis server. Called automatically when the test finishes
+func (harness *Harness) Close() {
+	if harness.apiServer != nil {
+		harness.apiServer.Close()
+		harness.Api.Shutdown()
+		harness.apiServer = nil
+	}
+
+	for _, worker := range harness.Workers {
+		if worker.httpServer == nil {
+			continue
+		}
+
+		worker.Server.Shutdown()
+		worker.httpServer.Close()
+		worker.httpServer = nil
+
+		if worker.directServer != nil {
+			worker.directServer.Close()
+		}
+	}
+
+	harness.Redis.Close()
+}
+
+/// Returns the first worker
+func (harness *Harness) Worker() *Worker {
+	return harness.Workers[0]
+}
@@ -0,0 +1,41 @@
+package harness
+
+import (
+	"encoding/json"
+	"github.com/Cretezy/dSock/common"
+	"net/http"
+	"testing"
+)
+
+/// Response of the worker's `/health` endpoint
+type Health struct {
+	/// HTTP status code of the response
+	StatusCode int    `json:"-"`
+	Status     string `json:"status"`
+	SendQueues struct {
+		Depth        int    `json:"depth"`
+		MaxDepth     int    `json:"maxDepth"`
+		Dropped      uint64 `json:"dropped"`
+		Disconnected uint64 `json:"disconnected"`
+	} `json:"sendQueues"`
+}
+
+/// Gets the worker's health. Fails the test if the request fails
+func (worker *Worker) Health(t testing.TB) *Health {
+	t.Helper()
+
+	resp, err := http.Get(worker.Url + common.PathHealth)
+	if err != nil {
+		t.Fatalf("Could not get health: %s", err)
+	}
+	defer resp.Body.Close()
+
+	health := &Health{StatusCode: resp.StatusCode}
+
+	err = json.NewDecoder(resp.Body).Decode(health)
+	if err != nil {
+		t.Fatalf("Could not decode health: %s", err)
+	}
+
+	return health
+}
@@ -0,0 +1,42 @@
+package dsock_test
+
+import (
+	dsock "github.com/Cretezy/dSock-go"
+	"github.com/Cretezy/dSock/e2e/harness"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+/// Suite running against an in-process API & worker (with an embedded Redis server), using the messaging method
+type e2eSuite struct {
+	suite.Suite
+	messagingMethod string
+	/// Number of workers. Defaults to 1
+	workers     int
+	harness     *harness.Harness
+	dSockClient *dsock.DSockClient
+}
+
+func (suite *e2eSuite) SetupSuite() {
+	suite.harness = harness.Start(suite.T(), harness.Options{
+		MessagingMethod: suite.messagingMethod,
+		Workers:         suite.workers,
+	})
+	suite.dSockClient = dsock.NewClient(suite.harness.ApiUrl, harness.Token)
+}
+
+/// Returns the WebSocket URL to connect to the worker with the query
+func (suite *e2eSuite) connectUrl(query string) string {
+	return suite.harness.Worker().ConnectUrl(query)
+}
+
+/// Runs the suite with each messaging method
+func runSuite(t *testing.T, newSuite func(e2e e2eSuite) suite.TestingSuite) {
+	for _, messagingMethod := range harness.MessagingMethods {
+		messagingMethod := messagingMethod
+
+		t.Run(messagingMethod, func(t *testing.T) {
+			suite.Run(t, newSuite(e2eSuite{messagingMethod: messagingMethod}))
+		})
+	}
+}
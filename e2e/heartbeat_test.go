@@ -0,0 +1,117 @@
+package dsock_test
+
+import (
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/e2e/harness"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+const heartbeatPingInterval = time.Millisecond * 100
+const heartbeatPongTimeout = time.Millisecond * 100
+
+func startHeartbeatHarness(t *testing.T, idleTimeout time.Duration) *harness.Harness {
+	t.Helper()
+
+	return harness.Start(t, harness.Options{
+		Configure: func(options *common.DSockOptions) {
+			options.PingInterval = heartbeatPingInterval
+			options.PongTimeout = heartbeatPongTimeout
+			options.IdleTimeout = idleTimeout
+		},
+	})
+}
+
+/// Reads until the connection is closed, returning how long it stayed open since connectedAt and its close code
+func waitClose(t *testing.T, conn *harness.Conn, connectedAt time.Time) (time.Duration, int) {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(harness.ReceiveTimeout))
+
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+
+		closeError, ok := err.(*websocket.CloseError)
+		require.Truef(t, ok, "Connection not closed: %s", err)
+
+		return time.Since(connectedAt), closeError.Code
+	}
+}
+
+func TestPongTimeout(t *testing.T) {
+	testHarness := startHeartbeatHarness(t, 0)
+
+	// Clients answering pings stay connected
+	responsiveConn := testHarness.ConnectClaim(t, client.ClaimOptions{User: "heartbeat_responsive"})
+	require.NotNil(t, responsiveConn, "Could not connect")
+
+	connectedAt := time.Now()
+
+	unresponsiveConn := testHarness.ConnectClaim(t, client.ClaimOptions{User: "heartbeat_unresponsive"})
+	require.NotNil(t, unresponsiveConn, "Could not connect")
+
+	// Ignore pings (without answering with a pong), like a dead peer
+	unresponsiveConn.SetPingHandler(func(string) error {
+		return nil
+	})
+
+	// Read (answering pings) from the responsive client meanwhile
+	responsiveDone := make(chan struct{})
+	go func() {
+		defer close(responsiveDone)
+
+		responsiveConn.ExpectNoMessage(t, (heartbeatPingInterval+heartbeatPongTimeout)*3)
+	}()
+
+	openFor, code := waitClose(t, unresponsiveConn, connectedAt)
+
+	assert.Equal(t, common.CloseCodePongTimeout, code, "Incorrect close code")
+	assert.GreaterOrEqual(t, int64(openFor), int64(heartbeatPingInterval+heartbeatPongTimeout), "Closed before the pong timeout")
+	assert.Less(t, int64(openFor), int64((heartbeatPingInterval+heartbeatPongTimeout)*3), "Not closed after the pong timeout")
+
+	<-responsiveDone
+}
+
+func TestIdleTimeout(t *testing.T) {
+	idleTimeout := time.Millisecond * 400
+	testHarness := startHeartbeatHarness(t, idleTimeout)
+
+	connectedAt := time.Now()
+
+	conn := testHarness.ConnectClaim(t, client.ClaimOptions{User: "idle"})
+	require.NotNil(t, conn, "Could not connect")
+
+	// Answering pings doesn't keep the connection from being idle
+	openFor, code := waitClose(t, conn, connectedAt)
+
+	assert.Equal(t, common.CloseCodeIdleTimeout, code, "Incorrect close code")
+	assert.GreaterOrEqual(t, int64(openFor), int64(idleTimeout), "Closed before the idle timeout")
+	assert.Less(t, int64(openFor), int64(idleTimeout+heartbeatPingInterval*3), "Not closed after the idle timeout")
+
+	// Messages keep the connection active
+	activeConn := testHarness.ConnectClaim(t, client.ClaimOptions{User: "idle_active"})
+	require.NotNil(t, activeConn, "Could not connect")
+
+	activeDone := make(chan struct{})
+	go func() {
+		defer close(activeDone)
+
+		activeConn.ExpectNoMessage(t, idleTimeout*2)
+	}()
+
+	for index := 0; index < 3; index++ {
+		time.Sleep(idleTimeout / 2)
+
+		err := activeConn.WriteMessage(websocket.TextMessage, []byte("active"))
+		require.NoError(t, err, "Error during sending message")
+	}
+
+	<-activeDone
+}
@@ -0,0 +1,117 @@
+package dsock_test
+
+import (
+	"context"
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/e2e/harness"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMaxFrameSize(t *testing.T) {
+	testHarness := harness.Start(t, harness.Options{
+		Configure: func(options *common.DSockOptions) {
+			options.MaxFrameSize = 1024
+		},
+	})
+
+	conn := testHarness.ConnectClaim(t, client.ClaimOptions{User: "frame_size"})
+	require.NotNil(t, conn, "Could not connect")
+
+	// Messages up to the limit are accepted
+	err := conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("a", 1024)))
+	require.NoError(t, err, "Error during sending message")
+	conn.ExpectNoMessage(t, harness.ReceiveTimeout/10)
+
+	overConn := testHarness.ConnectClaim(t, client.ClaimOptions{User: "frame_size_over"})
+	require.NotNil(t, overConn, "Could not connect")
+
+	err = overConn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("a", 1025)))
+	require.NoError(t, err, "Error during sending message")
+
+	overConn.ExpectClose(t, websocket.CloseMessageTooBig)
+}
+
+func TestMaxMessagesPerSecond(t *testing.T) {
+	maxMessagesPerSecond := 5
+
+	testHarness := harness.Start(t, harness.Options{
+		Configure: func(options *common.DSockOptions) {
+			options.MaxMessagesPerSecond = maxMessagesPerSecond
+		},
+	})
+
+	conn := testHarness.ConnectClaim(t, client.ClaimOptions{User: "message_rate"})
+	require.NotNil(t, conn, "Could not connect")
+
+	// Bursts up to the limit are accepted
+	for index := 0; index < maxMessagesPerSecond; index++ {
+		err := conn.WriteMessage(websocket.TextMessage, []byte("message"))
+		require.NoError(t, err, "Error during sending message")
+	}
+	conn.ExpectNoMessage(t, harness.ReceiveTimeout/10)
+
+	overConn := testHarness.ConnectClaim(t, client.ClaimOptions{User: "message_rate_over"})
+	require.NotNil(t, overConn, "Could not connect")
+
+	for index := 0; index < maxMessagesPerSecond*2; index++ {
+		err := overConn.WriteMessage(websocket.TextMessage, []byte("message"))
+		require.NoError(t, err, "Error during sending message")
+	}
+
+	overConn.ExpectClose(t, websocket.ClosePolicyViolation)
+}
+
+func TestMaxConnectsPerIp(t *testing.T) {
+	for _, trustedProxy := range []bool{false, true} {
+		trustedProxy := trustedProxy
+
+		name := "untrusted"
+		if trustedProxy {
+			name = "trusted_proxy"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			testHarness := harness.Start(t, harness.Options{
+				Configure: func(options *common.DSockOptions) {
+					options.MaxConnectsPerIp = 2
+					if trustedProxy {
+						options.TrustedProxies, _ = common.ParseTrustedProxies("127.0.0.1")
+					}
+				},
+			})
+
+			// Each attempt claims to be from a different client
+			statusCodes := make([]int, 0, 3)
+			for index := 0; index < 3; index++ {
+				claim, err := testHarness.Client.CreateClaim(context.Background(), client.ClaimOptions{User: "connects_per_ip"})
+				require.NoError(t, err, "Error during claim creation")
+
+				header := http.Header{}
+				header.Set("X-Forwarded-For", "203.0.113."+strconv.Itoa(index))
+
+				conn, resp, err := websocket.DefaultDialer.Dial(testHarness.Worker().ConnectUrl("claim="+claim.Id), header)
+				if err == nil {
+					_ = conn.Close()
+				}
+				require.NotNil(t, resp, "No response: %s", err)
+
+				statusCodes = append(statusCodes, resp.StatusCode)
+			}
+
+			if trustedProxy {
+				// Forwarded IPs are used from trusted proxies
+				assert.Equal(t, []int{101, 101, 101}, statusCodes, "Incorrect status codes")
+			} else {
+				// The spoofed header is ignored, all attempts count for the connection's IP
+				assert.Equal(t, []int{101, 101, 429}, statusCodes, "Incorrect status codes")
+			}
+		})
+	}
+}
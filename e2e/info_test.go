@@ -8,15 +8,17 @@ import (
 )
 
 type InfoSuite struct {
-	suite.Suite
+	e2eSuite
 }
 
 func TestInfoSuite(t *testing.T) {
-	suite.Run(t, new(InfoSuite))
+	runSuite(t, func(e2e e2eSuite) suite.TestingSuite {
+		return &InfoSuite{e2e}
+	})
 }
 
 func (suite *InfoSuite) TestInfoClaim() {
-	claim, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:       "info",
 		Session:    "claim",
 		Expiration: 2147485545,
@@ -25,7 +27,7 @@ func (suite *InfoSuite) TestInfoClaim() {
 		return
 	}
 
-	info, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+	info, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 		Target: dsock.Target{
 			User:    "info",
 			Session: "claim",
@@ -68,7 +70,7 @@ func (suite *InfoSuite) TestInfoClaim() {
 }
 
 func (suite *InfoSuite) TestInfoClaimInvalidExpiration() {
-	_, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	_, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:       "info",
 		Session:    "invalid_expiration",
 		Expiration: 1,
@@ -79,7 +81,7 @@ func (suite *InfoSuite) TestInfoClaimInvalidExpiration() {
 }
 
 func (suite *InfoSuite) TestInfoClaimNegativeExpiration() {
-	_, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	_, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:       "info",
 		Session:    "negative_expiration",
 		Expiration: -1,
@@ -90,7 +92,7 @@ func (suite *InfoSuite) TestInfoClaimNegativeExpiration() {
 }
 
 func (suite *InfoSuite) TestInfoClaimNegativeDuration() {
-	_, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	_, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:     "info",
 		Session:  "negative_duration",
 		Duration: -1,
@@ -101,7 +103,7 @@ func (suite *InfoSuite) TestInfoClaimNegativeDuration() {
 }
 
 func (suite *InfoSuite) TestInfoConnection() {
-	claim, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:    "info",
 		Session: "connection",
 	})
@@ -109,14 +111,14 @@ func (suite *InfoSuite) TestInfoConnection() {
 		return
 	}
 
-	conn, resp, err := websocket.DefaultDialer.Dial("ws://worker/connect?claim="+claim.Id, nil)
+	conn, resp, err := websocket.DefaultDialer.Dial(suite.connectUrl("claim="+claim.Id), nil)
 	if !checkConnectionError(suite.Suite, err, resp) {
 		return
 	}
 
 	defer conn.Close()
 
-	info, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+	info, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 		Target: dsock.Target{
 			User:    "info",
 			Session: "connection",
@@ -150,7 +152,7 @@ func (suite *InfoSuite) TestInfoConnection() {
 
 // Broken test? `unexpected end of JSON input`
 //func (suite *InfoSuite) TestInfoMissing() {
-//	info, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+//	info, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 //		Target: dsock.Target{
 //			User:    "info",
 //			Session: "missing",
@@ -170,14 +172,14 @@ func (suite *InfoSuite) TestInfoConnection() {
 //}
 
 func (suite *InfoSuite) TestInfoNoTarget() {
-	_, err := dSockClient.GetInfo(dsock.GetInfoOptions{})
+	_, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{})
 	if !checkRequestNoError(suite.Suite, err, "MISSING_TARGET", "getting info") {
 		return
 	}
 }
 
 func (suite *InfoSuite) TestInfoChannel() {
-	claim, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:     "info",
 		Session:  "channel",
 		Channels: []string{"info_channel"},
@@ -186,14 +188,14 @@ func (suite *InfoSuite) TestInfoChannel() {
 		return
 	}
 
-	conn, resp, err := websocket.DefaultDialer.Dial("ws://worker/connect?claim="+claim.Id, nil)
+	conn, resp, err := websocket.DefaultDialer.Dial(suite.connectUrl("claim="+claim.Id), nil)
 	if !checkConnectionError(suite.Suite, err, resp) {
 		return
 	}
 
 	defer conn.Close()
 
-	info, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+	info, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 		Target: dsock.Target{
 			Channel: "info_channel",
 		},
@@ -227,7 +229,7 @@ func (suite *InfoSuite) TestInfoChannel() {
 }
 
 func (suite *InfoSuite) TestInfoChannelClaim() {
-	claim, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:     "info",
 		Session:  "channel_claim",
 		Channels: []string{"info_channel_claim"},
@@ -236,7 +238,7 @@ func (suite *InfoSuite) TestInfoChannelClaim() {
 		return
 	}
 
-	info, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+	info, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 		Target: dsock.Target{
 			Channel: "info_channel_claim",
 		},
@@ -270,7 +272,7 @@ func (suite *InfoSuite) TestInfoChannelClaim() {
 }
 
 func (suite *InfoSuite) TestInfoClaimEmptyId() {
-	claim, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		Id:      "",
 		User:    "info",
 		Session: "claim_empty_id",
@@ -279,7 +281,7 @@ func (suite *InfoSuite) TestInfoClaimEmptyId() {
 		return
 	}
 
-	info, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+	info, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 		Target: dsock.Target{
 			User:    "info",
 			Session: "claim_empty_id",
@@ -305,7 +307,7 @@ func (suite *InfoSuite) TestInfoClaimEmptyId() {
 }
 
 func (suite *InfoSuite) TestInfoClaimId() {
-	claim, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		Id:      "test_claim_id",
 		User:    "info",
 		Session: "claim_id",
@@ -314,7 +316,7 @@ func (suite *InfoSuite) TestInfoClaimId() {
 		return
 	}
 
-	info, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+	info, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 		Target: dsock.Target{
 			User:    "info",
 			Session: "claim_id",
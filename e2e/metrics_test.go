@@ -0,0 +1,52 @@
+package dsock_test
+
+import (
+	"context"
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/e2e/harness"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestApiRequestRejections(t *testing.T) {
+	testHarness := harness.Start(t, harness.Options{})
+
+	before := apiRequestRejections(t, common.ErrorInvalidAuthorization)
+
+	invalidClient := client.New(client.Options{
+		Url:   testHarness.ApiUrl,
+		Token: "invalid",
+	})
+
+	_, err := invalidClient.Workers(context.Background())
+	require.Error(t, err, "Request with an invalid token should be rejected")
+
+	assert.Equal(t, before+1, apiRequestRejections(t, common.ErrorInvalidAuthorization), "Rejection not counted")
+}
+
+/// Returns the number of API requests rejected with the error code (metrics are shared by all harnesses)
+func apiRequestRejections(t *testing.T, errorCode string) float64 {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err, "Error during gathering metrics")
+
+	for _, family := range families {
+		if family.GetName() != "dsock_api_request_rejections_total" {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "error_code" && label.GetValue() == errorCode {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,212 @@
+package dsock_test
+
+import (
+	dsock "github.com/Cretezy/dSock-go"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/common/protos"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/suite"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type OrderingSuite struct {
+	e2eSuite
+}
+
+func TestOrderingSuite(t *testing.T) {
+	runSuite(t, func(e2e e2eSuite) suite.TestingSuite {
+		return &OrderingSuite{e2e}
+	})
+}
+
+/// Number of messages sent back-to-back. Lower than the default send queue size, so none are dropped
+const orderingMessageCount = 200
+
+func (suite *OrderingSuite) TestUserSendOrdering() {
+	connectionCount := 3
+	conns := make([]*websocket.Conn, 0, connectionCount)
+
+	for index := 0; index < connectionCount; index++ {
+		claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
+			User:    "ordering",
+			Session: strconv.Itoa(index),
+		})
+		if !checkRequestError(suite.Suite, err, "claim creation") {
+			return
+		}
+
+		conn, resp, err := websocket.DefaultDialer.Dial(suite.connectUrl("claim="+claim.Id), nil)
+		if !checkConnectionError(suite.Suite, err, resp) {
+			return
+		}
+
+		defer conn.Close()
+
+		conns = append(conns, conn)
+	}
+
+	// Read all connections concurrently while sending
+	received := make([][]string, connectionCount)
+	var receivedWaitGroup sync.WaitGroup
+	receivedWaitGroup.Add(connectionCount)
+
+	for index, conn := range conns {
+		index := index
+		conn := conn
+
+		go func() {
+			defer receivedWaitGroup.Done()
+
+			_ = conn.SetReadDeadline(time.Now().Add(time.Second * 30))
+
+			for len(received[index]) < orderingMessageCount {
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+
+				received[index] = append(received[index], string(data))
+			}
+		}()
+	}
+
+	expected := make([]string, orderingMessageCount)
+
+	for index := 0; index < orderingMessageCount; index++ {
+		expected[index] = strconv.Itoa(index)
+
+		err := suite.dSockClient.SendMessage(dsock.SendMessageOptions{
+			Target: dsock.Target{
+				User: "ordering",
+			},
+			Type:    "text",
+			Message: []byte(expected[index]),
+		})
+		if !checkRequestError(suite.Suite, err, "sending") {
+			return
+		}
+	}
+
+	receivedWaitGroup.Wait()
+
+	for index := range conns {
+		if !suite.Equalf(expected, received[index], "Incorrect message order for connection %d", index) {
+			return
+		}
+	}
+}
+
+/// Senders sending concurrently through the API, and through the worker's in-process delivery (as the standalone binary does)
+const orderingApiSenders = 3
+const orderingDirectSenders = 1
+
+/// Messages sent by each sender. In total lower than the default send queue size, so none are dropped
+const orderingLoadMessageCount = 50
+
+func (suite *OrderingSuite) TestConcurrentSendOrdering() {
+	connectionCount := 20
+	conns := make([]*websocket.Conn, 0, connectionCount)
+
+	for index := 0; index < connectionCount; index++ {
+		claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
+			User:    "ordering_load",
+			Session: strconv.Itoa(index),
+		})
+		if !checkRequestError(suite.Suite, err, "claim creation") {
+			return
+		}
+
+		conn, resp, err := websocket.DefaultDialer.Dial(suite.connectUrl("claim="+claim.Id), nil)
+		if !checkConnectionError(suite.Suite, err, resp) {
+			return
+		}
+
+		defer conn.Close()
+
+		conns = append(conns, conn)
+	}
+
+	senderCount := orderingApiSenders + orderingDirectSenders
+	messageCount := senderCount * orderingLoadMessageCount
+
+	// Messages received by each connection, per sender
+	received := make([]map[string][]string, connectionCount)
+	var receivedWaitGroup sync.WaitGroup
+	receivedWaitGroup.Add(connectionCount)
+
+	for index, conn := range conns {
+		index := index
+		conn := conn
+		received[index] = make(map[string][]string, senderCount)
+
+		go func() {
+			defer receivedWaitGroup.Done()
+
+			_ = conn.SetReadDeadline(time.Now().Add(time.Second * 30))
+
+			for count := 0; count < messageCount; count++ {
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+
+				parts := strings.SplitN(string(data), ":", 2)
+				received[index][parts[0]] = append(received[index][parts[0]], parts[1])
+			}
+		}()
+	}
+
+	expected := make([]string, orderingLoadMessageCount)
+	for index := range expected {
+		expected[index] = strconv.Itoa(index)
+	}
+
+	var sendersWaitGroup sync.WaitGroup
+	sendersWaitGroup.Add(senderCount)
+
+	for sender := 0; sender < senderCount; sender++ {
+		sender := sender
+
+		go func() {
+			defer sendersWaitGroup.Done()
+
+			for _, message := range expected {
+				if sender < orderingApiSenders {
+					err := suite.dSockClient.SendMessage(dsock.SendMessageOptions{
+						Target: dsock.Target{
+							User: "ordering_load",
+						},
+						Type:    "text",
+						Message: []byte("api" + strconv.Itoa(sender) + ":" + message),
+					})
+					if !checkRequestError(suite.Suite, err, "sending") {
+						return
+					}
+				} else {
+					suite.harness.Worker().Server.Deliver(common.MessageMessageType, &protos.Message{
+						Type:   protos.Message_TEXT,
+						Body:   []byte("direct" + strconv.Itoa(sender) + ":" + message),
+						Target: &protos.Target{User: "ordering_load"},
+					})
+				}
+			}
+		}()
+	}
+
+	sendersWaitGroup.Wait()
+	receivedWaitGroup.Wait()
+
+	for index := range conns {
+		suite.Lenf(received[index], senderCount, "Incorrect number of senders for connection %d", index)
+
+		for sender, messages := range received[index] {
+			if !suite.Equalf(expected, messages, "Incorrect message order from %s for connection %d", sender, index) {
+				return
+			}
+		}
+	}
+}
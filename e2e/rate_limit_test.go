@@ -0,0 +1,64 @@
+package dsock_test
+
+import (
+	"encoding/json"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/e2e/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendRateLimit(t *testing.T) {
+	testHarness := harness.Start(t, harness.Options{
+		Configure: func(options *common.DSockOptions) {
+			options.RateLimit.Window = time.Minute
+			options.RateLimit.Send = 2
+		},
+	})
+
+	send := func() *http.Response {
+		req, err := http.NewRequest("POST", testHarness.ApiUrl+common.PathSend+"?user=rate_limit&type=text", strings.NewReader("Hello world!"))
+		require.NoError(t, err, "Error during creating request")
+		req.Header.Set("Authorization", "Bearer "+harness.Token)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err, "Error during sending")
+
+		return resp
+	}
+
+	rejectionsBefore := apiRequestRejections(t, common.ErrorRateLimited)
+
+	for index := 0; index < 2; index++ {
+		resp := send()
+		_ = resp.Body.Close()
+
+		require.Equal(t, 200, resp.StatusCode, "Request under the limit should be allowed")
+		assert.Equal(t, "2", resp.Header.Get("X-RateLimit-Limit"), "Incorrect limit header")
+		assert.Equal(t, strconv.Itoa(1-index), resp.Header.Get("X-RateLimit-Remaining"), "Incorrect remaining header")
+		assert.Empty(t, resp.Header.Get("Retry-After"), "Allowed request should not have a retry header")
+	}
+
+	resp := send()
+	defer resp.Body.Close()
+
+	require.Equal(t, 429, resp.StatusCode, "Request over the limit should be rate limited")
+	assert.Equal(t, "2", resp.Header.Get("X-RateLimit-Limit"), "Incorrect limit header")
+	assert.Equal(t, "0", resp.Header.Get("X-RateLimit-Remaining"), "Incorrect remaining header")
+
+	reset, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Reset"))
+	require.NoError(t, err, "Invalid reset header")
+	assert.True(t, reset > 0 && reset <= 60, "Reset should be within the window: %d", reset)
+	assert.Equal(t, resp.Header.Get("X-RateLimit-Reset"), resp.Header.Get("Retry-After"), "Retry header should match the reset")
+
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body), "Error during decoding body")
+	assert.Equal(t, common.ErrorRateLimited, body["errorCode"], "Incorrect error code")
+
+	assert.Equal(t, rejectionsBefore+1, apiRequestRejections(t, common.ErrorRateLimited), "Rejection not counted")
+}
@@ -0,0 +1,138 @@
+package dsock_test
+
+import (
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/common/protos"
+	"github.com/Cretezy/dSock/e2e/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sendQueueSize = 4
+
+/// Messages sent once the slow client's send queue is full
+const sendQueueMarkers = sendQueueSize + 3
+
+func TestSendQueue(t *testing.T) {
+	t.Run(common.SendQueuePolicyDropNewest, func(t *testing.T) {
+		testHarness, conn := startSlowClient(t, common.SendQueuePolicyDropNewest)
+		worker := testHarness.Worker()
+
+		dropped := worker.Health(t).SendQueues.Dropped
+		sendMarkers(worker, "slow_"+common.SendQueuePolicyDropNewest)
+
+		assert.Equal(t, dropped+sendQueueMarkers, worker.Health(t).SendQueues.Dropped, "Incorrect dropped messages")
+		assert.Empty(t, readMarkers(t, conn), "Messages sent while the queue is full should be dropped")
+	})
+
+	t.Run(common.SendQueuePolicyDropOldest, func(t *testing.T) {
+		testHarness, conn := startSlowClient(t, common.SendQueuePolicyDropOldest)
+		worker := testHarness.Worker()
+
+		dropped := worker.Health(t).SendQueues.Dropped
+		sendMarkers(worker, "slow_"+common.SendQueuePolicyDropOldest)
+
+		assert.Equal(t, dropped+sendQueueMarkers, worker.Health(t).SendQueues.Dropped, "Incorrect dropped messages")
+
+		// Only the newest messages are kept
+		expected := make([]string, 0, sendQueueSize)
+		for index := sendQueueMarkers - sendQueueSize; index < sendQueueMarkers; index++ {
+			expected = append(expected, "marker-"+strconv.Itoa(index))
+		}
+
+		assert.Equal(t, expected, readMarkers(t, conn), "Incorrect messages received")
+	})
+
+	t.Run(common.SendQueuePolicyDisconnect, func(t *testing.T) {
+		testHarness, conn := startSlowClient(t, common.SendQueuePolicyDisconnect)
+		worker := testHarness.Worker()
+
+		assert.Equal(t, uint64(1), worker.Health(t).SendQueues.Disconnected, "Incorrect disconnected connections")
+		assert.Zero(t, worker.Health(t).SendQueues.Dropped, "Messages should not be dropped")
+
+		conn.ExpectClose(t, common.CloseCodeSendQueueFull)
+	})
+}
+
+/// Starts a worker with the send queue policy, and connects a client that doesn't read until its send queue is full
+/// (with the disconnect policy, until it is disconnected)
+func startSlowClient(t *testing.T, policy string) (*harness.Harness, *harness.Conn) {
+	t.Helper()
+
+	testHarness := harness.Start(t, harness.Options{
+		Configure: func(options *common.DSockOptions) {
+			options.SendQueueSize = sendQueueSize
+			options.SendQueuePolicy = policy
+			// Writes to the slow client must block (instead of timing out) for the whole test
+			options.PongTimeout = time.Minute
+		},
+	})
+	worker := testHarness.Worker()
+
+	conn := testHarness.ConnectClaim(t, client.ClaimOptions{User: "slow_" + policy})
+	require.NotNil(t, conn, "Could not connect")
+
+	// Fill the socket buffers with large messages, until the writer is blocked and the queue is full
+	body := []byte(strings.Repeat("a", 64*1024))
+
+	for index := 0; ; index++ {
+		require.Less(t, index, 10000, "Send queue never filled")
+
+		deliverText(worker, "slow_"+policy, body)
+
+		health := worker.Health(t)
+		if policy == common.SendQueuePolicyDisconnect {
+			if health.SendQueues.Disconnected > 0 {
+				return testHarness, conn
+			}
+		} else if health.SendQueues.Dropped > 0 {
+			return testHarness, conn
+		}
+	}
+}
+
+/// Delivers the text message to the user's connections on the worker, as if sent through the API
+func deliverText(worker *harness.Worker, user string, body []byte) {
+	worker.Server.Deliver(common.MessageMessageType, &protos.Message{
+		Type:   protos.Message_TEXT,
+		Body:   body,
+		Target: &protos.Target{User: user},
+	})
+}
+
+/// Sends the marker messages to the user
+func sendMarkers(worker *harness.Worker, user string) {
+	for index := 0; index < sendQueueMarkers; index++ {
+		deliverText(worker, user, []byte("marker-"+strconv.Itoa(index)))
+	}
+}
+
+/// Reads all messages until none are received, returning the marker messages
+func readMarkers(t *testing.T, conn *harness.Conn) []string {
+	t.Helper()
+
+	markers := make([]string, 0)
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+				assert.NoError(t, err, "Error during receiving message")
+			}
+
+			return markers
+		}
+
+		if strings.HasPrefix(string(data), "marker-") {
+			markers = append(markers, string(data))
+		}
+	}
+}
@@ -8,29 +8,31 @@ import (
 )
 
 type SendSuite struct {
-	suite.Suite
+	e2eSuite
 }
 
 func TestSendSuite(t *testing.T) {
-	suite.Run(t, new(SendSuite))
+	runSuite(t, func(e2e e2eSuite) suite.TestingSuite {
+		return &SendSuite{e2e}
+	})
 }
 
 func (suite *SendSuite) TestUserSend() {
-	claim, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User: "send_user",
 	})
 	if !checkRequestError(suite.Suite, err, "claim creation") {
 		return
 	}
 
-	conn, resp, err := websocket.DefaultDialer.Dial("ws://worker/connect?claim="+claim.Id, nil)
+	conn, resp, err := websocket.DefaultDialer.Dial(suite.connectUrl("claim="+claim.Id), nil)
 	if !checkConnectionError(suite.Suite, err, resp) {
 		return
 	}
 
 	defer conn.Close()
 
-	err = dSockClient.SendMessage(dsock.SendMessageOptions{
+	err = suite.dSockClient.SendMessage(dsock.SendMessageOptions{
 		Target: dsock.Target{
 			User: "send_user",
 		},
@@ -56,7 +58,7 @@ func (suite *SendSuite) TestUserSend() {
 }
 
 func (suite *SendSuite) TestUserSessionSend() {
-	claim, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:    "send",
 		Session: "session",
 	})
@@ -64,14 +66,14 @@ func (suite *SendSuite) TestUserSessionSend() {
 		return
 	}
 
-	conn, resp, err := websocket.DefaultDialer.Dial("ws://worker/connect?claim="+claim.Id, nil)
+	conn, resp, err := websocket.DefaultDialer.Dial(suite.connectUrl("claim="+claim.Id), nil)
 	if !checkConnectionError(suite.Suite, err, resp) {
 		return
 	}
 
 	defer conn.Close()
 
-	err = dSockClient.SendMessage(dsock.SendMessageOptions{
+	err = suite.dSockClient.SendMessage(dsock.SendMessageOptions{
 		Target: dsock.Target{
 			User:    "send",
 			Session: "session",
@@ -98,7 +100,7 @@ func (suite *SendSuite) TestUserSessionSend() {
 }
 
 func (suite *SendSuite) TestConnectionSend() {
-	claim, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:    "send",
 		Session: "connection",
 	})
@@ -106,14 +108,14 @@ func (suite *SendSuite) TestConnectionSend() {
 		return
 	}
 
-	conn, resp, err := websocket.DefaultDialer.Dial("ws://worker/connect?claim="+claim.Id, nil)
+	conn, resp, err := websocket.DefaultDialer.Dial(suite.connectUrl("claim="+claim.Id), nil)
 	if !checkConnectionError(suite.Suite, err, resp) {
 		return
 	}
 
 	defer conn.Close()
 
-	info, err := dSockClient.GetInfo(dsock.GetInfoOptions{
+	info, err := suite.dSockClient.GetInfo(dsock.GetInfoOptions{
 		Target: dsock.Target{
 			User:    "send",
 			Session: "connection",
@@ -128,7 +130,7 @@ func (suite *SendSuite) TestConnectionSend() {
 		return
 	}
 
-	err = dSockClient.SendMessage(dsock.SendMessageOptions{
+	err = suite.dSockClient.SendMessage(dsock.SendMessageOptions{
 		Target: dsock.Target{
 			Id: infoConnections[0].Id,
 		},
@@ -154,14 +156,14 @@ func (suite *SendSuite) TestConnectionSend() {
 }
 
 func (suite *SendSuite) TestSendNoTarget() {
-	err := dSockClient.SendMessage(dsock.SendMessageOptions{})
+	err := suite.dSockClient.SendMessage(dsock.SendMessageOptions{})
 	if !checkRequestNoError(suite.Suite, err, "MISSING_TARGET", "sending") {
 		return
 	}
 }
 
 func (suite *SendSuite) TestSendNoType() {
-	err := dSockClient.SendMessage(dsock.SendMessageOptions{
+	err := suite.dSockClient.SendMessage(dsock.SendMessageOptions{
 		Target: dsock.Target{
 			Id: "a",
 		},
@@ -172,7 +174,7 @@ func (suite *SendSuite) TestSendNoType() {
 }
 
 func (suite *SendSuite) TestConnectionChannel() {
-	claim, err := dSockClient.CreateClaim(dsock.CreateClaimOptions{
+	claim, err := suite.dSockClient.CreateClaim(dsock.CreateClaimOptions{
 		User:     "send",
 		Session:  "channel",
 		Channels: []string{"send_channel"},
@@ -181,14 +183,14 @@ func (suite *SendSuite) TestConnectionChannel() {
 		return
 	}
 
-	conn, resp, err := websocket.DefaultDialer.Dial("ws://worker/connect?claim="+claim.Id, nil)
+	conn, resp, err := websocket.DefaultDialer.Dial(suite.connectUrl("claim="+claim.Id), nil)
 	if !checkConnectionError(suite.Suite, err, resp) {
 		return
 	}
 
 	defer conn.Close()
 
-	err = dSockClient.SendMessage(dsock.SendMessageOptions{
+	err = suite.dSockClient.SendMessage(dsock.SendMessageOptions{
 		Target: dsock.Target{
 			Channel: "send_channel",
 		},
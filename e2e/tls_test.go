@@ -0,0 +1,150 @@
+package dsock_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/e2e/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTls(t *testing.T) {
+	certificates := harness.NewCertificates(t)
+	testHarness := harness.Start(t, harness.Options{})
+
+	tlsConfig, err := common.NewServerTls(common.TlsOptions{
+		CertFile:       certificates.ServerCertFile,
+		KeyFile:        certificates.ServerKeyFile,
+		ClientCaFile:   certificates.CaFile,
+		ClientAuth:     common.TlsClientAuthRequire,
+		MinVersion:     tls.VersionTLS12,
+		ReloadInterval: time.Millisecond * 10,
+	}, nil)
+	require.NoError(t, err, "Error during loading TLS")
+
+	server := httptest.NewUnstartedServer(testHarness.Api.Handler())
+	server.TLS = tlsConfig
+	server.StartTLS()
+	defer server.Close()
+
+	clientTls, err := common.LoadClientTls(certificates.CaFile, certificates.ClientCertFile, certificates.ClientKeyFile)
+	require.NoError(t, err, "Error during loading client TLS")
+
+	tlsClient := client.New(client.Options{
+		Url:        server.URL,
+		Token:      harness.Token,
+		HttpClient: common.NewDirectHttpClient(&common.DSockOptions{DirectClientTls: clientTls}),
+	})
+
+	_, err = tlsClient.Workers(context.Background())
+	assert.NoError(t, err, "Error during getting workers")
+
+	// Clients without a certificate are rejected
+	noCertTls, err := common.LoadClientTls(certificates.CaFile, "", "")
+	require.NoError(t, err, "Error during loading client TLS")
+
+	noCertClient := client.New(client.Options{
+		Url:        server.URL,
+		Token:      harness.Token,
+		HttpClient: &http.Client{Transport: &http.Transport{TLSClientConfig: noCertTls}},
+	})
+
+	_, err = noCertClient.Workers(context.Background())
+	assert.Error(t, err, "Request without a client certificate should be rejected")
+
+	// Rotate the server certificate (keeping the client CA)
+	rotated := harness.NewCertificates(t)
+	copyFile(t, rotated.ServerCertFile, certificates.ServerCertFile)
+	copyFile(t, rotated.ServerKeyFile, certificates.ServerKeyFile)
+
+	rotatedCert, err := ioutil.ReadFile(rotated.ServerCertFile)
+	require.NoError(t, err, "Error during reading rotated certificate")
+
+	time.Sleep(time.Millisecond * 20)
+
+	assert.Equal(t, rotatedCert, servedCertificate(t, server.Listener.Addr().String(), clientTls), "Rotated certificate not served")
+}
+
+func TestTlsHttp2(t *testing.T) {
+	certificates := harness.NewCertificates(t)
+
+	tlsConfig, err := common.NewServerTls(common.TlsOptions{
+		CertFile:       certificates.ServerCertFile,
+		KeyFile:        certificates.ServerKeyFile,
+		MinVersion:     tls.VersionTLS12,
+		ReloadInterval: time.Millisecond * 10,
+	}, nil)
+	require.NoError(t, err, "Error during loading TLS")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Error during listening")
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			_, _ = io.WriteString(writer, request.Proto)
+		}),
+		TLSConfig: tlsConfig,
+	}
+	go func() {
+		_ = server.ServeTLS(listener, "", "")
+	}()
+	defer server.Close()
+
+	clientTls, err := common.LoadClientTls(certificates.CaFile, "", "")
+	require.NoError(t, err, "Error during loading client TLS")
+
+	httpClient := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: clientTls, ForceAttemptHTTP2: true},
+	}
+
+	resp, err := httpClient.Get("https://" + listener.Addr().String())
+	require.NoError(t, err, "Error during request")
+	defer resp.Body.Close()
+
+	assert.Equal(t, "HTTP/2.0", resp.Proto, "HTTP/2 not negotiated")
+}
+
+func copyFile(t *testing.T, from string, to string) {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(from)
+	require.NoError(t, err, "Error during reading %s", from)
+
+	err = ioutil.WriteFile(to, data, 0600)
+	require.NoError(t, err, "Error during writing %s", to)
+}
+
+/// Returns the PEM-encoded certificate served at the address (without verifying it)
+func servedCertificate(t *testing.T, address string, clientTls *tls.Config) []byte {
+	t.Helper()
+
+	config := clientTls.Clone()
+	config.InsecureSkipVerify = true
+
+	conn, err := tls.Dial("tcp", address, config)
+	require.NoError(t, err, "Error during TLS connection")
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	require.NotEmpty(t, certs, "No certificate served")
+
+	return pemCertificate(certs[0].Raw)
+}
+
+func pemCertificate(raw []byte) []byte {
+	var buffer bytes.Buffer
+	_ = pem.Encode(&buffer, &pem.Block{Type: "CERTIFICATE", Bytes: raw})
+
+	return buffer.Bytes()
+}
@@ -0,0 +1,60 @@
+package dsock_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/e2e/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestStoredTokens(t *testing.T) {
+	testHarness := harness.Start(t, harness.Options{
+		Configure: func(options *common.DSockOptions) {
+			options.StoreTokens = true
+		},
+	})
+
+	ctx := context.Background()
+
+	storedToken, err := testHarness.Client.CreateToken(ctx, client.TokenOptions{
+		Name:     "tokens_analytics",
+		Scopes:   []string{common.ScopeInfo},
+		Channels: []string{"tokens_channel"},
+	})
+	require.NoError(t, err, "Error during token creation")
+
+	_, err = testHarness.Client.CreateToken(ctx, client.TokenOptions{
+		Name:   "tokens_analytics",
+		Scopes: []string{common.ScopeSend},
+	})
+	assert.True(t, errors.Is(err, client.ErrTokenNameAlreadyUsed), "Incorrect error: %v", err)
+
+	tokens, err := testHarness.Client.Tokens(ctx)
+	require.NoError(t, err, "Error during getting tokens")
+	require.Len(t, tokens, 1, "Incorrect number of tokens")
+	assert.Equal(t, []string{"tokens_channel"}, tokens[0].Channels, "Incorrect token channels")
+
+	tokenClient := client.New(client.Options{
+		Url:   testHarness.ApiUrl,
+		Token: storedToken.Token,
+	})
+
+	_, err = tokenClient.Info(ctx, common.ResolveOptions{Channel: "tokens_channel"})
+	assert.NoError(t, err, "Error during getting info")
+
+	_, err = tokenClient.Info(ctx, common.ResolveOptions{Channel: "tokens_other_channel"})
+	assert.True(t, errors.Is(err, client.ErrTargetNotAllowed), "Incorrect error: %v", err)
+
+	err = tokenClient.Disconnect(ctx, common.ResolveOptions{Channel: "tokens_channel"}, false)
+	assert.True(t, errors.Is(err, client.ErrMissingScope), "Incorrect error: %v", err)
+
+	err = testHarness.Client.RevokeToken(ctx, "tokens_analytics")
+	require.NoError(t, err, "Error during token revocation")
+
+	_, err = tokenClient.Info(ctx, common.ResolveOptions{Channel: "tokens_channel"})
+	assert.True(t, errors.Is(err, client.ErrInvalidAuthorization), "Incorrect error: %v", err)
+}
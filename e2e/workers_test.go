@@ -0,0 +1,98 @@
+package dsock_test
+
+import (
+	"context"
+	"github.com/Cretezy/dSock/client"
+	"github.com/Cretezy/dSock/common"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+type WorkersSuite struct {
+	e2eSuite
+}
+
+func TestWorkersSuite(t *testing.T) {
+	runSuite(t, func(e2e e2eSuite) suite.TestingSuite {
+		e2e.workers = 2
+		return &WorkersSuite{e2e}
+	})
+}
+
+func (suite *WorkersSuite) TestWorkers() {
+	workers, err := suite.harness.Client.Workers(context.Background())
+	if !checkRequestError(suite.Suite, err, "getting workers") {
+		return
+	}
+
+	suite.Len(workers, 2, "Incorrect number of workers")
+}
+
+func (suite *WorkersSuite) TestUserSend() {
+	firstConn := suite.harness.Workers[0].ConnectClaim(suite.T(), client.ClaimOptions{User: "workers_send"})
+	secondConn := suite.harness.Workers[1].ConnectClaim(suite.T(), client.ClaimOptions{User: "workers_send"})
+	if firstConn == nil || secondConn == nil {
+		return
+	}
+
+	err := suite.harness.Client.Send(context.Background(), common.ResolveOptions{
+		User: "workers_send",
+	}, client.MessageTypeText, []byte("Hello world!"))
+	if !checkRequestError(suite.Suite, err, "sending") {
+		return
+	}
+
+	firstConn.ExpectText(suite.T(), "Hello world!")
+	secondConn.ExpectText(suite.T(), "Hello world!")
+}
+
+func (suite *WorkersSuite) TestChannelSend() {
+	firstConn := suite.harness.Workers[0].ConnectClaim(suite.T(), client.ClaimOptions{
+		User:     "workers_channel",
+		Session:  "first",
+		Channels: []string{"workers_channel"},
+	})
+	secondConn := suite.harness.Workers[1].ConnectClaim(suite.T(), client.ClaimOptions{
+		User:     "workers_channel",
+		Session:  "second",
+		Channels: []string{"workers_channel"},
+	})
+	otherConn := suite.harness.Workers[1].ConnectClaim(suite.T(), client.ClaimOptions{
+		User:    "workers_channel",
+		Session: "other",
+	})
+	if firstConn == nil || secondConn == nil || otherConn == nil {
+		return
+	}
+
+	err := suite.harness.Client.Send(context.Background(), common.ResolveOptions{
+		Channel: "workers_channel",
+	}, client.MessageTypeBinary, []byte("Hello world!"))
+	if !checkRequestError(suite.Suite, err, "sending") {
+		return
+	}
+
+	firstConn.ExpectMessage(suite.T(), websocket.BinaryMessage, "Hello world!")
+	secondConn.ExpectMessage(suite.T(), websocket.BinaryMessage, "Hello world!")
+	otherConn.ExpectNoMessage(suite.T(), time.Millisecond*200)
+}
+
+func (suite *WorkersSuite) TestDisconnect() {
+	firstConn := suite.harness.Workers[0].ConnectClaim(suite.T(), client.ClaimOptions{User: "workers_disconnect"})
+	secondConn := suite.harness.Workers[1].ConnectClaim(suite.T(), client.ClaimOptions{User: "workers_disconnect"})
+	if firstConn == nil || secondConn == nil {
+		return
+	}
+
+	err := suite.harness.Client.Disconnect(context.Background(), common.ResolveOptions{
+		User: "workers_disconnect",
+	}, false)
+	if !checkRequestError(suite.Suite, err, "disconnecting") {
+		return
+	}
+
+	firstConn.ExpectClose(suite.T(), websocket.CloseNormalClosure)
+	secondConn.ExpectClose(suite.T(), websocket.CloseNormalClosure)
+}
@@ -1,11 +1,10 @@
-package main
+package worker
 
 import (
 	"github.com/Cretezy/dSock/common"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-contrib/requestid"
 	"github.com/gin-gonic/gin"
-	"strings"
 	"time"
 )
 
@@ -15,30 +14,30 @@ type Authentication struct {
 	Channels []string
 }
 
-func authenticate(c *gin.Context) (*Authentication, *common.ApiError) {
+func (server *Server) authenticate(c *gin.Context) (*Authentication, *common.ApiError) {
 	if claim := c.Query("claim"); claim != "" {
 		// Validate claim
-		claimData := redisClient.HGetAll("claim:" + claim)
+		claimData, err := server.dataStore.GetClaim(claim)
 
-		if claimData.Err() != nil {
+		if err != nil {
 			return nil, &common.ApiError{
-				InternalError: claimData.Err(),
+				InternalError: err,
 				ErrorCode:     common.ErrorGettingClaim,
 				StatusCode:    500,
 				RequestId:     requestid.Get(c),
 			}
 		}
 
-		if len(claimData.Val()) == 0 {
+		if claimData == nil {
 			// Claim doesn't exist
 			return nil, &common.ApiError{
 				ErrorCode:  common.ErrorMissingClaim,
 				StatusCode: 400,
+				RequestId:  requestid.Get(c),
 			}
 		}
 
-		user, hasUser := claimData.Val()["user"]
-		if !hasUser {
+		if claimData.User == "" {
 			// Invalid claim (missing user)
 			return nil, &common.ApiError{
 				ErrorCode:  common.ErrorMissingClaim,
@@ -47,19 +46,17 @@ func authenticate(c *gin.Context) (*Authentication, *common.ApiError) {
 			}
 		}
 
-		expirationTime, err := time.Parse(time.RFC3339, claimData.Val()["expiration"])
-		if err != nil {
+		if claimData.Expiration.IsZero() {
 			// Invalid expiration (can't parse)
 			return nil, &common.ApiError{
-				InternalError: err,
-				ErrorCode:     common.ErrorInvalidExpiration,
-				StatusCode:    500,
-				RequestId:     requestid.Get(c),
+				ErrorCode:  common.ErrorInvalidExpiration,
+				StatusCode: 500,
+				RequestId:  requestid.Get(c),
 			}
 		}
 
 		// Double check that claim is not expired
-		if expirationTime.Before(time.Now()) {
+		if claimData.Expiration.Before(time.Now()) {
 			return nil, &common.ApiError{
 				ErrorCode:  common.ErrorExpiredClaim,
 				StatusCode: 400,
@@ -67,27 +64,26 @@ func authenticate(c *gin.Context) (*Authentication, *common.ApiError) {
 			}
 		}
 
-		session := claimData.Val()["session"]
-
 		// Expire claim instantly
-		redisClient.Del("claim:" + claim)
-		redisClient.SRem("claim-user:"+user, claim)
-		if session != "" {
-			redisClient.SRem("claim-user-session:"+user+"-"+session, claim)
-		}
-		for _, channel := range strings.Split(claimData.Val()["channels"], ",") {
-			redisClient.SRem("claim-channel:"+channel, claim)
+		err = server.dataStore.DeleteClaims([]string{claim})
+		if err != nil {
+			return nil, &common.ApiError{
+				InternalError: err,
+				ErrorCode:     common.ErrorDeletingClaim,
+				StatusCode:    500,
+				RequestId:     requestid.Get(c),
+			}
 		}
 
 		return &Authentication{
-			User:     user,
-			Session:  session,
-			Channels: common.RemoveEmpty(strings.Split(claimData.Val()["channels"], ",")),
+			User:     claimData.User,
+			Session:  claimData.Session,
+			Channels: claimData.Channels,
 		}, nil
-	} else if jwtToken := c.Query("jwt"); jwtToken != "" && options.Jwt.JwtSecret != "" {
+	} else if jwtToken := c.Query("jwt"); jwtToken != "" && server.options.Jwt.JwtSecret != "" {
 		// Valid JWT (only enabled if `jwt_secret` is set)
 		token, err := jwt.ParseWithClaims(jwtToken, &JwtClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(options.Jwt.JwtSecret), nil
+			return []byte(server.options.Jwt.JwtSecret), nil
 		})
 		if err != nil {
 			return nil, &common.ApiError{
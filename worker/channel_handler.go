@@ -1,18 +1,29 @@
-package main
+package worker
 
 import (
 	"github.com/Cretezy/dSock/common"
 	"github.com/Cretezy/dSock/common/protos"
 	"github.com/gin-contrib/requestid"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 	"google.golang.org/protobuf/proto"
 	"io/ioutil"
-	"strings"
 )
 
-func handleChannel(channelAction *protos.ChannelAction) {
+func (server *Server) handleChannel(channelAction *protos.ChannelAction) {
+	_, span := common.Tracer.Start(common.ExtractTraceContext(channelAction.TraceContext), "handleChannel",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("dsock.worker_id", server.id),
+			attribute.String("dsock.channel", channelAction.Channel),
+		),
+	)
+	defer span.End()
+
 	// Resolve all local connections for message target
-	connections, ok := resolveConnections(common.ResolveOptions{
+	connections, ok := server.resolveConnections(common.ResolveOptions{
 		Connection: channelAction.Target.Connection,
 		User:       channelAction.Target.User,
 		Session:    channelAction.Target.Session,
@@ -26,28 +37,44 @@ func handleChannel(channelAction *protos.ChannelAction) {
 	// Apply to all connections for target
 	for _, connection := range connections {
 		connectionChannels := connection.GetChannels()
+		var err error
+
 		if channelAction.Type == protos.ChannelAction_SUBSCRIBE && !common.IncludesString(connectionChannels, channelAction.Channel) {
 			connection.SetChannels(append(connectionChannels, channelAction.Channel))
 
-			channels.Add(channelAction.Channel, connection.Id)
+			server.channels.Add(channelAction.Channel, connection.Id)
+			server.syncChannelTopic(channelAction.Channel)
 
-			redisClient.SAdd("channel:"+channelAction.Channel, connection.Id)
+			err = server.dataStore.AddConnectionChannel(connection.Info(), channelAction.Channel)
 		} else if channelAction.Type == protos.ChannelAction_UNSUBSCRIBE && common.IncludesString(connectionChannels, channelAction.Channel) {
 			connection.SetChannels(common.RemoveString(connectionChannels, channelAction.Channel))
 
-			channels.Remove(channelAction.Channel, connection.Id)
+			server.channels.Remove(channelAction.Channel, connection.Id)
+			server.syncChannelTopic(channelAction.Channel)
 
-			redisClient.SRem("channel:"+channelAction.Channel, connection.Id)
+			err = server.dataStore.RemoveConnectionChannel(connection.Info(), channelAction.Channel)
 		} else {
-			// Don't set in Redis
-			return
+			// Don't set in store
+			continue
 		}
 
-		redisClient.HSet("conn:"+connection.Id, "channels", strings.Join(connection.GetChannels(), ","))
+		if err != nil {
+			server.logger.Error("Could not set connection channels in store",
+				zap.String("id", connection.Id),
+				zap.String("channel", channelAction.Channel),
+				zap.Error(err),
+			)
+		}
+
+		eventType := common.EventSubscribe
+		if channelAction.Type == protos.ChannelAction_UNSUBSCRIBE {
+			eventType = common.EventUnsubscribe
+		}
+		server.connectionEvent(eventType, connection, channelAction.Channel, 0)
 	}
 }
 
-func channelMessageHandler(c *gin.Context) {
+func (server *Server) channelMessageHandler(c *gin.Context) {
 	requestId := requestid.Get(c)
 
 	if c.ContentType() != common.ProtobufContentType {
@@ -88,7 +115,7 @@ func channelMessageHandler(c *gin.Context) {
 		return
 	}
 
-	handleChannel(&message)
+	server.handleChannel(&message)
 
 	c.AbortWithStatusJSON(200, gin.H{
 		"success": true,
@@ -1,61 +1,138 @@
-package main
+package worker
 
 import (
+	"github.com/Cretezy/dSock/common"
 	"github.com/Cretezy/dSock/common/protos"
+	"github.com/Cretezy/dSock/common/store"
 	"github.com/gin-contrib/requestid"
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v7"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"net"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-func connectHandler(c *gin.Context) {
-	logger.Info("Getting new connection request",
+/// Sends the error for a rejected connection request, counting it in metrics
+func rejectConnection(c *gin.Context, apiError *common.ApiError) {
+	connectRejectionsTotal.WithLabelValues(apiError.ErrorCode).Inc()
+
+	apiError.Send(c)
+}
+
+func (server *Server) connectHandler(c *gin.Context) {
+	server.logger.Info("Getting new connection request",
 		zap.String("requestId", requestid.Get(c)),
 		zap.String("claim", c.Query("claim")),
 		zap.String("jwt", c.Query("jwt")),
 	)
 
+	if server.drain.Draining() {
+		// Tell the client (or load-balancer) to connect to another worker
+		c.Header("Retry-After", "1")
+
+		apiError := &common.ApiError{
+			ErrorCode:  common.ErrorWorkerDraining,
+			StatusCode: 503,
+			RequestId:  requestid.Get(c),
+		}
+		rejectConnection(c, apiError)
+		return
+	}
+
+	if apiError := server.checkConnectRateLimit(c); apiError != nil {
+		rejectConnection(c, apiError)
+		return
+	}
+
+	if reason := server.load.AtCapacity(); reason != "" {
+		server.logger.Warn("Rejecting connection, worker is at capacity",
+			zap.String("requestId", requestid.Get(c)),
+			zap.String("workerId", server.id),
+			zap.String("reason", reason),
+		)
+
+		c.Header("Retry-After", atCapacityRetryAfter)
+
+		apiError := &common.ApiError{
+			ErrorCode:  common.ErrorWorkerAtCapacity,
+			StatusCode: 503,
+			RequestId:  requestid.Get(c),
+		}
+		rejectConnection(c, apiError)
+		return
+	}
+
 	// Authenticate client and get user/session
-	authentication, apiError := authenticate(c)
+	authentication, apiError := server.authenticate(c)
 	if apiError != nil {
-		apiError.Send(c)
+		rejectConnection(c, apiError)
 		return
 	}
 
-	logger.Info("Authenticated connection request",
+	server.logger.Info("Authenticated connection request",
 		zap.String("requestId", requestid.Get(c)),
 		zap.String("user", authentication.User),
 		zap.String("session", authentication.Session),
 		zap.Strings("channels", authentication.Channels),
 	)
 
-	authentication.Channels = append(authentication.Channels, options.DefaultChannels...)
+	authentication.Channels = append(authentication.Channels, server.options.DefaultChannels...)
+
+	// Generate connection ID (random UUIDv4, can't be guessed)
+	connId := uuid.New().String()
+	connectedAt := time.Now()
+
+	// Registers the connection before upgrading to be able to reject it
+	apiError = server.checkConnectionLimits(&store.Connection{
+		Id:          connId,
+		User:        authentication.User,
+		Session:     authentication.Session,
+		WorkerId:    server.id,
+		LastPing:    connectedAt,
+		Channels:    authentication.Channels,
+		ConnectedAt: connectedAt,
+	}, requestid.Get(c))
+	if apiError != nil {
+		rejectConnection(c, apiError)
+		return
+	}
 
 	// Upgrade to a WebSocket connection
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		logger.Warn("Could not upgrade request to WebSocket",
+		server.logger.Warn("Could not upgrade request to WebSocket",
 			zap.String("requestId", requestid.Get(c)),
 			zap.Error(err),
 		)
+
+		if server.hasConnectionLimits() {
+			_ = server.dataStore.DeleteConnection(&store.Connection{
+				Id:       connId,
+				User:     authentication.User,
+				Session:  authentication.Session,
+				Channels: authentication.Channels,
+			})
+		}
 		return
 	}
 
-	// Generate connection ID (random UUIDv4, can't be guessed)
-	connId := uuid.New().String()
-
-	logger.Info("Upgraded connection request",
+	server.logger.Info("Upgraded connection request",
 		zap.String("requestId", requestid.Get(c)),
 		zap.String("id", connId),
 	)
 
-	// Channel that will be used to handleSend messages to the client
-	sender := make(chan *protos.Message)
+	connectsTotal.Inc()
+
+	// Queue of messages to send to the client, bounded by the send queue size
+	sender := make(chan *protos.Message, server.options.SendQueueSize)
 
 	// Add to memory cache
 	connection := SockConnection{
@@ -66,66 +143,146 @@ func connectHandler(c *gin.Context) {
 		Sender:       sender,
 		CloseChannel: make(chan struct{}),
 		channels:     authentication.Channels,
-		lastPing:     time.Now(),
+		lastPing:     connectedAt,
+		lastActivity: connectedAt.UnixNano(),
+		connectedAt:  connectedAt,
+		server:       server,
 	}
 
-	connections.Add(&connection)
-	users.Add(connection.User, connId)
+	server.connections.Add(&connection)
+	server.users.Add(connection.User, connId)
 	for _, channel := range connection.channels {
-		channels.Add(channel, connId)
+		server.channels.Add(channel, connId)
+		server.syncChannelTopic(channel)
 	}
 
-	connection.Refresh(redisClient)
+	connection.Refresh()
+
+	server.connectionEvent(common.EventConnect, &connection, "", 0)
 
 	sendMutex := sync.Mutex{}
 
-	// Send ping every minute
+	// Connection is considered dead if nothing (including pongs) is received for a ping interval and the pong timeout
+	readTimeout := server.options.PingInterval + server.options.PongTimeout
+
+	extendReadDeadline := func() {
+		_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
+	}
+
+	receivedHeartbeat := func() {
+		extendReadDeadline()
+
+		// Stored on the next TTL refresh
+		connection.lock.Lock()
+		connection.lastPing = time.Now()
+		connection.lock.Unlock()
+	}
+
+	extendReadDeadline()
+
+	if server.options.MaxFrameSize > 0 {
+		// Larger messages close the connection with 1009 (message too big)
+		conn.SetReadLimit(server.options.MaxFrameSize)
+	}
+
+	conn.SetPongHandler(func(string) error {
+		receivedHeartbeat()
+		return nil
+	})
+
+	conn.SetPingHandler(func(data string) error {
+		receivedHeartbeat()
+
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(server.options.PongTimeout))
+		if err == websocket.ErrCloseSent {
+			return nil
+		} else if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+			return nil
+		}
+
+		return err
+	})
+
+	// Stops sending pings once the send loop is done
+	heartbeatDone := make(chan struct{})
+	defer close(heartbeatDone)
+
+	// Send pings every ping interval, and disconnect idle connections
 	go func() {
+		ticker := time.NewTicker(server.options.PingInterval)
+		defer ticker.Stop()
+
 		for {
-			time.Sleep(time.Second * 30)
+			select {
+			case <-heartbeatDone:
+				return
+			case <-ticker.C:
+			}
 
-			if connection.CloseChannel == nil {
-				break
+			if server.options.IdleTimeout > 0 && connection.IdleFor() >= server.options.IdleTimeout {
+				server.logger.Info("Connection idle, disconnecting",
+					zap.String("id", connId),
+					zap.Duration("idleTimeout", server.options.IdleTimeout),
+				)
+
+				connection.CloseWith(common.CloseCodeIdleTimeout, "Idle timeout")
+				return
 			}
 
-			sendMutex.Lock()
-			_ = conn.WriteMessage(websocket.PingMessage, []byte{})
-			sendMutex.Unlock()
+			_ = conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(server.options.PongTimeout))
 		}
 	}()
 
-	// Message receiving loop (from client)
+	// Message receiving loop (from client). Pings, pongs & close messages are handled by the handlers above.
+	// Messages are only passed to the OnMessage hook
 	go func() {
-	ReceiveLoop:
+		limiter := newInboundLimiter(server.options.MaxMessagesPerSecond)
+
 		for {
-			messageType, _, err := conn.ReadMessage()
+			messageType, data, err := conn.ReadMessage()
 
 			if err != nil {
-				// Disconnect on error
-				if connection.CloseChannel != nil {
+				if err == websocket.ErrReadLimit {
+					// The close message was already sent by the WebSocket library
+					server.logger.Warn("Connection sent a message over the maximum frame size, disconnecting",
+						zap.String("id", connId),
+						zap.String("user", connection.User),
+						zap.Int64("maxFrameSize", server.options.MaxFrameSize),
+					)
+
+					connection.CloseWith(websocket.CloseMessageTooBig, "Message too big")
+				} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					// Dead peer (half-open connection): no message or pong within the read timeout
+					server.logger.Info("Connection timed out, disconnecting",
+						zap.String("id", connId),
+						zap.Duration("readTimeout", readTimeout),
+					)
+
+					connection.CloseWith(common.CloseCodePongTimeout, "Pong timeout")
+				} else if connection.CloseChannel != nil {
+					// Disconnect on error (including close)
 					connection.CloseChannel <- struct{}{}
 				}
 				break
 			}
 
-			switch messageType {
-			case websocket.CloseMessage:
-				if connection.CloseChannel != nil {
-					connection.CloseChannel <- struct{}{}
-				}
-				break ReceiveLoop
-			// Handling receiving ping/pong
-			case websocket.PingMessage:
-				fallthrough
-			case websocket.PongMessage:
-				connection.lock.Lock()
-				connection.lastPing = time.Now()
-				connection.lock.Unlock()
-
-				connection.Refresh(redisClient)
+			if !limiter.Allow() {
+				server.logger.Warn("Connection exceeded the message rate, disconnecting",
+					zap.String("id", connId),
+					zap.String("user", connection.User),
+					zap.Int("maxMessagesPerSecond", server.options.MaxMessagesPerSecond),
+				)
+
+				connection.CloseWith(websocket.ClosePolicyViolation, "Message rate exceeded")
 				break
 			}
 
+			extendReadDeadline()
+			connection.active()
+
+			if server.hooks.OnMessage != nil {
+				server.hooks.OnMessage(connection.Info(), messageType, data)
+			}
 		}
 	}()
 
@@ -134,60 +291,186 @@ SendLoop:
 	for {
 		select {
 		case message := <-sender:
+			if message == disconnectMessage {
+				// Disconnect once the messages queued before it are sent
+				break SendLoop
+			}
+
+			var span trace.Span
+			if len(message.TraceContext) != 0 {
+				_, span = common.Tracer.Start(common.ExtractTraceContext(message.TraceContext), "conn.WriteMessage",
+					trace.WithAttributes(
+						attribute.String("dsock.connection_id", connId),
+						attribute.Int("dsock.bytes", len(message.Body)),
+					),
+				)
+			}
+
 			sendMutex.Lock()
-			_ = conn.WriteMessage(int(message.Type), message.Body)
+			// Don't block the send loop on a dead peer
+			_ = conn.SetWriteDeadline(time.Now().Add(server.options.PongTimeout))
+			err := conn.WriteMessage(int(message.Type), message.Body)
 			sendMutex.Unlock()
+
+			if span != nil {
+				if err != nil {
+					span.RecordError(err)
+					span.SetStatus(codes.Error, "write failed")
+				}
+				span.End()
+			}
+
+			if err == nil {
+				messageType := strings.ToLower(message.Type.String())
+				messagesSentTotal.WithLabelValues(messageType).Inc()
+				messageBytesSentTotal.WithLabelValues(messageType).Add(float64(len(message.Body)))
+			}
+
+			connection.active()
 			break
 		case <-connection.CloseChannel:
-			logger.Info("Disconnecting user",
-				zap.String("requestId", requestid.Get(c)),
-				zap.String("id", connId),
-			)
+			break SendLoop
+		}
+	}
 
-			connection.CloseChannel = nil
+	server.logger.Info("Disconnecting user",
+		zap.String("requestId", requestid.Get(c)),
+		zap.String("id", connId),
+	)
 
-			sendMutex.Lock()
+	connection.CloseChannel = nil
 
-			// Send close message with 1000
-			_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-			// Sleep a tiny bit to allow message to be sent before closing connection
-			time.Sleep(time.Millisecond)
-			_ = conn.Close()
+	sendMutex.Lock()
 
-			redisClient.Del("conn:" + connId)
-			redisClient.SRem("user:"+connection.User, connId)
-			if connection.Session != "" {
-				redisClient.SRem("user-session:"+connection.User+"-"+connection.Session, connId)
-			}
+	// Send close message with 1000, unless closed for a specific reason
+	closeCode, closeReason := connection.Close()
+	_ = conn.SetWriteDeadline(time.Now().Add(server.options.PongTimeout))
+	_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, closeReason))
+	// Sleep a tiny bit to allow message to be sent before closing connection
+	time.Sleep(time.Millisecond)
+	_ = conn.Close()
 
-			connections.Remove(connId)
+	disconnectsTotal.WithLabelValues(strconv.Itoa(closeCode)).Inc()
 
-			users.Remove(connection.User, connId)
+	err = server.dataStore.DeleteConnection(connection.Info())
+	if err != nil {
+		server.logger.Error("Could not delete connection from store",
+			zap.String("requestId", requestid.Get(c)),
+			zap.String("id", connId),
+			zap.Error(err),
+		)
+	}
 
-			for _, channel := range connection.GetChannels() {
-				channels.Remove(channel, connId)
+	server.connections.Remove(connId)
 
-				redisClient.SRem("channel:"+channel, connId)
-			}
+	server.users.Remove(connection.User, connId)
 
-			break SendLoop
-		}
+	for _, channel := range connection.GetChannels() {
+		server.channels.Remove(channel, connId)
+		server.syncChannelTopic(channel)
 	}
+
+	server.connectionEvent(common.EventDisconnect, &connection, "", closeCode)
 }
 
 type SockConnection struct {
+	/// Messages dropped because the send queue was full. First for 64-bit alignment (atomic)
+	droppedMessages uint64
+	/// Last time a message was sent or received (Unix nanoseconds, atomic)
+	lastActivity int64
 	/// WebSocket connection
 	Conn    *websocket.Conn
 	Id      string
 	User    string
 	Session string
-	/// Message sending channel. Messages sent to it will be sent to the connection
+	/// Message sending queue. Messages sent to it will be sent to the connection. Use Send to not block when full
 	Sender chan *protos.Message
 	/// Channel to close the connect. nil when connection is closed/closing
 	CloseChannel chan struct{}
 	channels     []string
 	lastPing     time.Time
-	lock         sync.RWMutex
+	connectedAt  time.Time
+	/// WebSocket close code & reason, when closed for a specific reason
+	closeCode   int
+	closeReason string
+	lock        sync.RWMutex
+	server      *Server
+}
+
+/// Sets the close code & reason sent when the connection is closed.
+/// Returns false if already set
+func (connection *SockConnection) SetClose(code int, reason string) bool {
+	connection.lock.Lock()
+	defer connection.lock.Unlock()
+
+	if connection.closeCode != 0 {
+		return false
+	}
+
+	connection.closeCode = code
+	connection.closeReason = reason
+
+	return true
+}
+
+/// Marks the connection as active (message sent or received)
+func (connection *SockConnection) active() {
+	atomic.StoreInt64(&connection.lastActivity, time.Now().UnixNano())
+}
+
+/// Returns how long since a message was last sent or received
+func (connection *SockConnection) IdleFor() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&connection.lastActivity)))
+}
+
+/// Closes the connection with the close code & reason, without blocking.
+/// Returns false if the connection is already being closed for a specific reason
+func (connection *SockConnection) CloseWith(code int, reason string) bool {
+	if !connection.SetClose(code, reason) {
+		return false
+	}
+
+	connection.closeNow()
+
+	return true
+}
+
+/// Signals the send loop to close the connection, without blocking
+func (connection *SockConnection) closeNow() {
+	closeChannel := connection.CloseChannel
+	if closeChannel != nil {
+		go func() {
+			closeChannel <- struct{}{}
+		}()
+	}
+}
+
+/// Closes the connection with the close code & reason (normal closure if 0) after the messages already queued are sent,
+/// or right away if the send queue is full. Returns false if the connection is already being closed for a specific reason
+func (connection *SockConnection) Disconnect(code int, reason string) bool {
+	if code != 0 && !connection.SetClose(code, reason) {
+		return false
+	}
+
+	select {
+	case connection.Sender <- disconnectMessage:
+	default:
+		connection.closeNow()
+	}
+
+	return true
+}
+
+/// Returns the close code & reason (normal closure if none is set)
+func (connection *SockConnection) Close() (int, string) {
+	connection.lock.RLock()
+	defer connection.lock.RUnlock()
+
+	if connection.closeCode == 0 {
+		return websocket.CloseNormalClosure, ""
+	}
+
+	return connection.closeCode, connection.closeReason
 }
 
 func (connection *SockConnection) SetChannels(channels []string) {
@@ -204,29 +487,29 @@ func (connection *SockConnection) GetChannels() []string {
 	return connection.channels
 }
 
-func (connection *SockConnection) Refresh(redisCmdable redis.Cmdable) {
+/// Returns the connection's information for the store
+func (connection *SockConnection) Info() *store.Connection {
 	connection.lock.RLock()
 	defer connection.lock.RUnlock()
 
-	redisConnection := map[string]interface{}{
-		"user":     connection.User,
-		"workerId": workerId,
-		"lastPing": connection.lastPing.Format(time.RFC3339),
-		"channels": strings.Join(connection.channels, ","),
-	}
-	if connection.Session != "" {
-		redisConnection["session"] = connection.Session
+	return &store.Connection{
+		Id:          connection.Id,
+		User:        connection.User,
+		Session:     connection.Session,
+		WorkerId:    connection.server.id,
+		LastPing:    connection.lastPing,
+		Channels:    connection.channels,
+		ConnectedAt: connection.connectedAt,
 	}
+}
 
-	redisCmdable.HSet("conn:"+connection.Id, redisConnection)
-	redisCmdable.Expire("conn:"+connection.Id, options.TtlDuration*2)
-
-	// Add user/session to Redis
-	for _, channel := range connection.channels {
-		redisCmdable.SAdd("channel:"+channel, connection.Id)
-	}
-	redisCmdable.SAdd("user:"+connection.User, connection.Id)
-	if connection.Session != "" {
-		redisCmdable.SAdd("user-session:"+connection.User+"-"+connection.Session, connection.Id)
+/// Sets the connection in the store, refreshing its TTL
+func (connection *SockConnection) Refresh() {
+	err := connection.server.dataStore.SetConnections([]*store.Connection{connection.Info()}, connection.server.options.TtlDuration*2)
+	if err != nil {
+		connection.server.logger.Error("Could not refresh connection",
+			zap.String("id", connection.Id),
+			zap.Error(err),
+		)
 	}
 }
@@ -0,0 +1,161 @@
+package worker
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/common/protos"
+	"github.com/Cretezy/dSock/common/store"
+	"go.uber.org/zap"
+	"sort"
+)
+
+func (server *Server) hasConnectionLimits() bool {
+	return server.options.MaxConnectionsPerUser > 0 || server.options.MaxConnectionsPerSession > 0 || server.options.SingleConnectionPerSession
+}
+
+/// Registers the new connection in the store, then enforces the per-user & per-session connection limits
+/// across all workers. Returns an error if the new connection is rejected.
+/// Concurrent connections all see each other once registered, so only the newest are rejected/kept
+func (server *Server) checkConnectionLimits(connection *store.Connection, requestId string) *common.ApiError {
+	if !server.hasConnectionLimits() {
+		return nil
+	}
+
+	err := server.dataStore.SetConnections([]*store.Connection{connection}, server.options.TtlDuration*2)
+	if err != nil {
+		server.logger.Error("Could not register connection to check limits",
+			zap.String("requestId", requestId),
+			zap.String("id", connection.Id),
+			zap.Error(err),
+		)
+		// Allow the connection, limits are best-effort when the store is unavailable
+		return nil
+	}
+
+	userConnections, err := server.dataStore.ResolveConnections(common.ResolveOptions{User: connection.User})
+	if err != nil {
+		server.logger.Error("Could not get user connections to check limits",
+			zap.String("requestId", requestId),
+			zap.String("id", connection.Id),
+			zap.Error(err),
+		)
+		return nil
+	}
+
+	// Oldest first
+	sort.Slice(userConnections, func(i, j int) bool {
+		if userConnections[i].ConnectedAt.Equal(userConnections[j].ConnectedAt) {
+			return userConnections[i].Id < userConnections[j].Id
+		}
+
+		return userConnections[i].ConnectedAt.Before(userConnections[j].ConnectedAt)
+	})
+
+	evict := make([]*store.Connection, 0)
+	reject := false
+
+	apply := func(limitedConnections []*store.Connection, limit int, policy string) {
+		if limit <= 0 || len(limitedConnections) <= limit {
+			return
+		}
+
+		if policy == common.ConnectionLimitPolicyEvictOldest {
+			for _, limitedConnection := range limitedConnections[:len(limitedConnections)-limit] {
+				if limitedConnection.Id != connection.Id {
+					evict = append(evict, limitedConnection)
+				}
+			}
+
+			return
+		}
+
+		// Reject if the new connection isn't one of the oldest (allowed) connections
+		for _, limitedConnection := range limitedConnections[limit:] {
+			if limitedConnection.Id == connection.Id {
+				reject = true
+			}
+		}
+	}
+
+	if connection.Session != "" {
+		sessionConnections := make([]*store.Connection, 0)
+		for _, userConnection := range userConnections {
+			if userConnection.Session == connection.Session {
+				sessionConnections = append(sessionConnections, userConnection)
+			}
+		}
+
+		if server.options.SingleConnectionPerSession {
+			apply(sessionConnections, 1, common.ConnectionLimitPolicyEvictOldest)
+		} else {
+			apply(sessionConnections, server.options.MaxConnectionsPerSession, server.options.ConnectionLimitPolicy)
+		}
+	}
+
+	apply(userConnections, server.options.MaxConnectionsPerUser, server.options.ConnectionLimitPolicy)
+
+	if reject {
+		server.logger.Info("Connection limit reached, rejecting connection",
+			zap.String("requestId", requestId),
+			zap.String("id", connection.Id),
+			zap.String("user", connection.User),
+			zap.String("session", connection.Session),
+		)
+
+		err := server.dataStore.DeleteConnection(connection)
+		if err != nil {
+			server.logger.Error("Could not delete rejected connection from store",
+				zap.String("requestId", requestId),
+				zap.String("id", connection.Id),
+				zap.Error(err),
+			)
+		}
+
+		return &common.ApiError{
+			ErrorCode:  common.ErrorConnectionLimit,
+			StatusCode: 429,
+			RequestId:  requestId,
+		}
+	}
+
+	evicted := make(map[string]bool)
+
+	for _, evictedConnection := range evict {
+		if evicted[evictedConnection.Id] {
+			continue
+		}
+		evicted[evictedConnection.Id] = true
+
+		server.logger.Info("Connection limit reached, evicting oldest connection",
+			zap.String("requestId", requestId),
+			zap.String("id", evictedConnection.Id),
+			zap.String("newId", connection.Id),
+			zap.String("user", evictedConnection.User),
+			zap.String("session", evictedConnection.Session),
+		)
+
+		server.disconnectConnection(evictedConnection, common.CloseCodeConnectionLimit, "Connection limit reached")
+	}
+
+	return nil
+}
+
+/// Disconnects a connection held by this worker or another worker, with the close code & reason
+func (server *Server) disconnectConnection(connection *store.Connection, closeCode int, closeReason string) {
+	if connection.WorkerId == server.id {
+		localConnection, exists := server.connections.Get(connection.Id)
+		if exists {
+			localConnection.CloseWith(closeCode, closeReason)
+		}
+
+		return
+	}
+
+	server.sendToWorker(connection.WorkerId, &protos.Message{
+		Type: protos.Message_DISCONNECT,
+		Target: &protos.Target{
+			Connection: connection.Id,
+		},
+		CloseCode:   int32(closeCode),
+		CloseReason: closeReason,
+	})
+}
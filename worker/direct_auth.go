@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"bytes"
+	"github.com/Cretezy/dSock/common"
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+/// Authenticates requests to the direct messaging endpoints, with the token or an HMAC signature of the body
+func (server *Server) directAuthMiddleware() gin.HandlerFunc {
+	secret := server.options.Token
+	if server.options.DirectAuth == common.DirectAuthHmac {
+		secret = server.options.DirectHmacSecret
+	}
+
+	if secret == "" {
+		// Anyone could authenticate with an empty token or secret (options validation prevents this, except when embedding)
+		return func(c *gin.Context) {
+			apiError := &common.ApiError{
+				ErrorCode:  common.ErrorInvalidAuthorization,
+				StatusCode: 401,
+				RequestId:  requestid.Get(c),
+			}
+			apiError.Send(c)
+		}
+	}
+
+	if server.options.DirectAuth != common.DirectAuthHmac {
+		return common.TokenMiddleware(server.options.Token)
+	}
+
+	return func(c *gin.Context) {
+		requestId := requestid.Get(c)
+
+		signature := c.GetHeader(common.DirectSignatureHeader)
+
+		// Rejected before reading the body
+		if _, _, ok := common.ParseDirectSignature(signature); !ok {
+			apiError := &common.ApiError{
+				ErrorCode:  common.ErrorInvalidSignature,
+				StatusCode: 401,
+				RequestId:  requestId,
+			}
+			apiError.Send(c)
+			return
+		}
+
+		maxBodySize := server.options.DirectMaxBodySize
+		if maxBodySize > 0 {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodySize)
+		}
+
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			apiError := &common.ApiError{
+				InternalError: err,
+				ErrorCode:     common.ErrorReadingBody,
+				StatusCode:    400,
+				RequestId:     requestId,
+			}
+
+			// Reading stops at the limit
+			if maxBodySize > 0 && int64(len(body)) == maxBodySize {
+				apiError.ErrorCode = common.ErrorBodyTooLarge
+				apiError.StatusCode = 413
+			}
+
+			apiError.Send(c)
+			return
+		}
+
+		// Restored for the handler
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		if !common.VerifyDirectRequest(server.options.DirectHmacSecret, c.Request.URL.Path, body, signature, time.Now()) {
+			server.logger.Warn("Invalid direct message signature",
+				zap.String("requestId", requestId),
+				zap.String("workerId", server.id),
+				zap.String("path", c.Request.URL.Path),
+			)
+
+			apiError := &common.ApiError{
+				ErrorCode:  common.ErrorInvalidSignature,
+				StatusCode: 401,
+				RequestId:  requestId,
+			}
+			apiError.Send(c)
+			return
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type drainState struct {
+	/// 1 when draining (atomic)
+	draining int32
+	once     sync.Once
+	/// Closed once all connections have been closed
+	done chan struct{}
+	/// Only used by drainConnections (not safe for concurrent use)
+	random *rand.Rand
+}
+
+func (drain *drainState) Draining() bool {
+	return atomic.LoadInt32(&drain.draining) == 1
+}
+
+/// Starts draining (closing the connections) if not already started, without waiting for it to finish
+func (drain *drainState) Start(drainConnections func()) {
+	drain.once.Do(func() {
+		atomic.StoreInt32(&drain.draining, 1)
+
+		go drainConnections()
+	})
+}
+
+/// Stops accepting connections and gradually closes all connections over `drain_window`,
+/// asking clients to reconnect (to another worker). Blocks until all connections are closed
+func (server *Server) Drain() {
+	server.drain.Start(server.drainConnections)
+
+	<-server.drain.done
+}
+
+func (server *Server) drainConnections() {
+	defer close(server.drain.done)
+
+	// Stop advertising the worker as available
+	server.refreshWorker()
+
+	drainingConnections := server.connections.List()
+
+	server.logger.Info("Draining worker",
+		zap.String("workerId", server.id),
+		zap.Int("connections", len(drainingConnections)),
+		zap.Duration("drainWindow", server.options.DrainWindow),
+	)
+
+	if len(drainingConnections) == 0 {
+		return
+	}
+
+	// Spread closing connections evenly over the window, so clients don't all reconnect at once
+	interval := server.options.DrainWindow / time.Duration(len(drainingConnections))
+
+	for index, connection := range drainingConnections {
+		if index != 0 && interval > 0 && !server.wait(interval) {
+			// Shut down while draining, remaining connections are disconnected by the shutdown
+			break
+		}
+
+		connection.CloseWith(common.CloseCodeReconnect, server.reconnectReason())
+	}
+
+	server.logger.Info("Drained worker",
+		zap.String("workerId", server.id),
+	)
+}
+
+/// Close reason hinting the client to reconnect after a random delay (in milliseconds), up to `drain_retry_jitter`
+func (server *Server) reconnectReason() string {
+	retryAfter := time.Duration(0)
+	if server.options.DrainRetryJitter > 0 {
+		retryAfter = time.Duration(server.drain.random.Int63n(int64(server.options.DrainRetryJitter)))
+	}
+
+	return "Reconnect;retry-after=" + strconv.FormatInt(int64(retryAfter/time.Millisecond), 10)
+}
+
+func (server *Server) drainHandler(c *gin.Context) {
+	server.drain.Start(server.drainConnections)
+
+	c.AbortWithStatusJSON(200, gin.H{
+		"success": true,
+	})
+}
@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"encoding/json"
+	"github.com/Cretezy/dSock/common"
+	"go.uber.org/zap"
+	"time"
+)
+
+/// Calls the hook for the connection event, and publishes the event if publish_events is enabled
+func (server *Server) connectionEvent(eventType string, connection *SockConnection, channel string, closeCode int) {
+	hooks := server.hooks
+
+	switch {
+	case eventType == common.EventConnect && hooks.OnConnect != nil:
+		hooks.OnConnect(connection.Info())
+	case eventType == common.EventDisconnect && hooks.OnDisconnect != nil:
+		hooks.OnDisconnect(connection.Info(), closeCode)
+	case eventType == common.EventSubscribe && hooks.OnSubscribe != nil:
+		hooks.OnSubscribe(connection.Info(), channel)
+	case eventType == common.EventUnsubscribe && hooks.OnUnsubscribe != nil:
+		hooks.OnUnsubscribe(connection.Info(), channel)
+	}
+
+	if server.options.PublishEvents {
+		server.publishEvent(eventType, connection, channel, closeCode)
+	}
+}
+
+/// Publishes a connection event to the store
+func (server *Server) publishEvent(eventType string, connection *SockConnection, channel string, closeCode int) {
+	payload, err := json.Marshal(common.Event{
+		Type:       eventType,
+		Time:       time.Now().UnixNano() / int64(time.Millisecond),
+		Worker:     server.id,
+		Connection: connection.Id,
+		User:       connection.User,
+		Session:    connection.Session,
+		Channels:   connection.GetChannels(),
+		Channel:    channel,
+		CloseCode:  closeCode,
+	})
+	if err != nil {
+		server.logger.Error("Could not marshal event",
+			zap.String("type", eventType),
+			zap.String("id", connection.Id),
+			zap.Error(err),
+		)
+		return
+	}
+
+	err = server.dataStore.PublishEvent(payload)
+	if err != nil {
+		server.logger.Error("Could not publish event",
+			zap.String("type", eventType),
+			zap.String("id", connection.Id),
+			zap.Error(err),
+		)
+	}
+}
@@ -0,0 +1,143 @@
+package worker
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	HealthStatusHealthy  = common.WorkerStatusHealthy
+	HealthStatusDegraded = "degraded"
+	HealthStatusDraining = "draining"
+)
+
+type healthState struct {
+	/// Reason for each degraded component (such as a Redis subscription)
+	degraded map[string]string
+	/// Time when the worker became degraded
+	degradedSince time.Time
+	mutex         sync.RWMutex
+	drain         *drainState
+}
+
+func (health *healthState) SetDegraded(component string, reason string) {
+	health.mutex.Lock()
+	defer health.mutex.Unlock()
+
+	if len(health.degraded) == 0 {
+		health.degradedSince = time.Now()
+	}
+
+	health.degraded[component] = reason
+}
+
+func (health *healthState) SetHealthy(component string) {
+	health.mutex.Lock()
+	defer health.mutex.Unlock()
+
+	delete(health.degraded, component)
+}
+
+func (health *healthState) Status() string {
+	health.mutex.RLock()
+	defer health.mutex.RUnlock()
+
+	if health.drain.Draining() {
+		return HealthStatusDraining
+	}
+
+	if len(health.degraded) != 0 {
+		return HealthStatusDegraded
+	}
+
+	return HealthStatusHealthy
+}
+
+/// Returns how long the worker has been degraded for (0 if healthy)
+func (health *healthState) DegradedFor() time.Duration {
+	health.mutex.RLock()
+	defer health.mutex.RUnlock()
+
+	if len(health.degraded) == 0 {
+		return 0
+	}
+
+	return time.Since(health.degradedSince)
+}
+
+func (health *healthState) Reasons() map[string]string {
+	health.mutex.RLock()
+	defer health.mutex.RUnlock()
+
+	reasons := make(map[string]string, len(health.degraded))
+	for component, reason := range health.degraded {
+		reasons[component] = reason
+	}
+
+	return reasons
+}
+
+func (server *Server) healthHandler(c *gin.Context) {
+	status := server.health.Status()
+
+	statusCode := 200
+	if status != HealthStatusHealthy {
+		// Degraded or draining, load-balancers should stop sending new connections
+		statusCode = 503
+	}
+
+	queueDepth, maxQueueDepth := server.sendQueue.Depth()
+
+	c.AbortWithStatusJSON(statusCode, gin.H{
+		"success":  status == HealthStatusHealthy,
+		"status":   status,
+		"degraded": server.health.Reasons(),
+		"sendQueues": gin.H{
+			"depth":        queueDepth,
+			"maxDepth":     maxQueueDepth,
+			"dropped":      server.sendQueue.Dropped(),
+			"disconnected": server.sendQueue.Disconnected(),
+		},
+		"load": server.load.Json(),
+	})
+}
+
+/// Disconnects all clients once the worker has been degraded for longer than `degraded_disconnect_after`,
+/// so they can reconnect to a healthy worker
+func (server *Server) monitorHealth() {
+	if server.options.DegradedDisconnectAfter <= 0 {
+		return
+	}
+
+	disconnected := false
+
+	for {
+		if !server.wait(time.Second) {
+			return
+		}
+
+		degradedFor := server.health.DegradedFor()
+
+		if degradedFor == 0 {
+			disconnected = false
+			continue
+		}
+
+		if disconnected || degradedFor < server.options.DegradedDisconnectAfter {
+			continue
+		}
+
+		server.logger.Warn("Worker is degraded, disconnecting all connections",
+			zap.String("workerId", server.id),
+			zap.Duration("degradedFor", degradedFor),
+			zap.Any("degraded", server.health.Reasons()),
+		)
+
+		server.disconnectAll()
+
+		disconnected = true
+	}
+}
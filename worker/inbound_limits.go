@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"math"
+	"strconv"
+	"time"
+)
+
+/// Limits connection attempts per client IP (`max_connects_per_ip` per `connect_rate_window`), across workers
+func (server *Server) checkConnectRateLimit(c *gin.Context) *common.ApiError {
+	if server.options.MaxConnectsPerIp <= 0 {
+		return nil
+	}
+
+	// Not gin's ClientIP, which trusts the forwarded headers from any client (allowing to bypass the limit)
+	ip := common.ClientIp(c.Request, server.options.TrustedProxies)
+
+	rateLimit, err := server.dataStore.RateLimit("connect:"+ip, server.options.MaxConnectsPerIp, server.options.ConnectRateWindow)
+	if err != nil {
+		// Fail open, the store being unavailable shouldn't block all connections
+		server.logger.Error("Could not check connect rate limit",
+			zap.String("requestId", requestid.Get(c)),
+			zap.String("ip", ip),
+			zap.Error(err),
+		)
+		return nil
+	}
+
+	if rateLimit.Allowed {
+		return nil
+	}
+
+	server.logger.Warn("Rejecting connection, too many connection attempts from IP",
+		zap.String("requestId", requestid.Get(c)),
+		zap.String("ip", ip),
+		zap.Int("maxConnectsPerIp", server.options.MaxConnectsPerIp),
+	)
+
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(rateLimit.Reset.Seconds()))))
+
+	return &common.ApiError{
+		ErrorCode:  common.ErrorRateLimited,
+		StatusCode: 429,
+		RequestId:  requestid.Get(c),
+	}
+}
+
+/// Token bucket limiting the messages received from a connection (`max_messages_per_second`).
+/// Only used by the connection's receiving loop (not safe for concurrent use)
+type inboundLimiter struct {
+	/// Messages allowed per second, and burst size. 0 to disable
+	perSecond float64
+	tokens    float64
+	last      time.Time
+}
+
+func newInboundLimiter(perSecond int) *inboundLimiter {
+	return &inboundLimiter{
+		perSecond: float64(perSecond),
+		tokens:    float64(perSecond),
+		last:      time.Now(),
+	}
+}
+
+/// Counts a received message. Returns false if the connection is over its limit
+func (limiter *inboundLimiter) Allow() bool {
+	if limiter.perSecond <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	limiter.tokens = math.Min(limiter.perSecond, limiter.tokens+now.Sub(limiter.last).Seconds()*limiter.perSecond)
+	limiter.last = now
+
+	if limiter.tokens < 1 {
+		return false
+	}
+
+	limiter.tokens--
+
+	return true
+}
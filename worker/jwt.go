@@ -1,4 +1,4 @@
-package main
+package worker
 
 import "github.com/dgrijalva/jwt-go"
 
@@ -0,0 +1,141 @@
+package worker
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/common/store"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"math"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+/// Seconds clients are told to wait before retrying when the worker is at capacity
+const atCapacityRetryAfter = "5"
+
+/// Sampled process usage, refreshed every second by monitorLoad
+type loadState struct {
+	/// Memory obtained from the OS and not yet released back to it, in bytes (atomic)
+	memory uint64
+	/// CPU usage in percent of all cores, as float64 bits (atomic)
+	cpu uint64
+	/// Process CPU time and wall time at the last sample. Only used by Sample (not safe for concurrent use)
+	lastCpuTime time.Duration
+	lastSample  time.Time
+	/// Returns the memory used, in bytes
+	memoryUsage func() uint64
+
+	options     *common.DSockOptions
+	connections *connectionsState
+	sendQueue   *sendQueueStats
+}
+
+/// Returns the memory obtained from the OS and not yet released back to it, in bytes
+func processMemory() uint64 {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	// Sys only grows, so memory released back to the OS is subtracted (allowing the worker to recover from a spike)
+	return memStats.Sys - memStats.HeapReleased
+}
+
+func (load *loadState) Sample() {
+	atomic.StoreUint64(&load.memory, load.memoryUsage())
+
+	now := time.Now()
+	cpuTime := processCpuTime()
+
+	if !load.lastSample.IsZero() {
+		elapsed := now.Sub(load.lastSample) * time.Duration(runtime.NumCPU())
+		cpu := 0.0
+		if elapsed > 0 {
+			cpu = float64(cpuTime-load.lastCpuTime) / float64(elapsed) * 100
+		}
+
+		atomic.StoreUint64(&load.cpu, math.Float64bits(cpu))
+	}
+
+	load.lastCpuTime = cpuTime
+	load.lastSample = now
+}
+
+func (load *loadState) Memory() uint64 {
+	return atomic.LoadUint64(&load.memory)
+}
+
+func (load *loadState) Cpu() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&load.cpu))
+}
+
+/// Returns why the worker is at capacity, or an empty string if it can accept new connections
+func (load *loadState) AtCapacity() string {
+	if load.options.MaxConnections > 0 && load.connections.Count() >= load.options.MaxConnections {
+		return "connections"
+	}
+
+	if load.options.MaxGoroutines > 0 && runtime.NumGoroutine() >= load.options.MaxGoroutines {
+		return "goroutines"
+	}
+
+	if load.options.MaxMemory > 0 && load.Memory() >= load.options.MaxMemory {
+		return "memory"
+	}
+
+	return ""
+}
+
+func (load *loadState) Current() store.WorkerLoad {
+	queueDepth, _ := load.sendQueue.Depth()
+
+	return store.WorkerLoad{
+		Connections: load.connections.Count(),
+		Goroutines:  runtime.NumGoroutine(),
+		Memory:      load.Memory(),
+		Cpu:         load.Cpu(),
+		QueueDepth:  queueDepth,
+		AtCapacity:  load.AtCapacity() != "",
+	}
+}
+
+func (load *loadState) Json() gin.H {
+	current := load.Current()
+
+	return gin.H{
+		"connections": current.Connections,
+		"goroutines":  current.Goroutines,
+		"memory":      current.Memory,
+		"cpu":         current.Cpu,
+		"queueDepth":  current.QueueDepth,
+		"atCapacity":  current.AtCapacity,
+	}
+}
+
+/// Samples the process usage every second, and publishes the worker's load every `load_report_interval`
+func (server *Server) monitorLoad() {
+	server.load.Sample()
+
+	lastReport := time.Now()
+
+	for {
+		if !server.wait(time.Second) {
+			return
+		}
+
+		server.load.Sample()
+
+		if time.Since(lastReport) < server.options.LoadReportInterval {
+			continue
+		}
+
+		lastReport = time.Now()
+
+		err := server.dataStore.SetWorker(server.workerInfo(), server.options.TtlDuration*2)
+		if err != nil {
+			server.logger.Error("Could not publish worker load",
+				zap.Error(err),
+				zap.String("workerId", server.id),
+			)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package worker
+
+import (
+	"syscall"
+	"time"
+)
+
+/// Returns the CPU time (user + system) used by the process
+func processCpuTime() time.Duration {
+	var usage syscall.Rusage
+
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
@@ -0,0 +1,8 @@
+package worker
+
+import "time"
+
+/// CPU usage is not reported on Windows
+func processCpuTime() time.Duration {
+	return 0
+}
@@ -0,0 +1,167 @@
+package worker
+
+import (
+	"bytes"
+	"errors"
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/common/protos"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+/// Handles a message received from the store (Redis pub/sub or streams).
+/// Called sequentially by the subscription (in the order received) and never blocks, to keep messages in order
+func (server *Server) handleMessage(messageType string, payload []byte) {
+	if messageType == common.ChannelMessageType {
+		var channelAction protos.ChannelAction
+
+		err := proto.Unmarshal(payload, &channelAction)
+		if err != nil {
+			// Couldn't parse channel action
+			server.logger.Error("Invalid message received from store",
+				zap.Error(err),
+				zap.String("workerId", server.id),
+			)
+			return
+		}
+
+		server.handleChannel(&channelAction)
+	} else {
+		var message protos.Message
+
+		err := proto.Unmarshal(payload, &message)
+		if err != nil {
+			// Couldn't parse message
+			server.logger.Error("Invalid message received from store",
+				zap.Error(err),
+				zap.String("workerId", server.id),
+			)
+			return
+		}
+
+		server.handleSend(&message)
+	}
+}
+
+/// Marks the worker as degraded while receiving messages fails
+func (server *Server) handleMessagingStatus(component string, err error) {
+	if err != nil {
+		server.health.SetDegraded(component, err.Error())
+	} else {
+		server.health.SetHealthy(component)
+	}
+}
+
+/// Delivers a message from an API running in the same process, skipping the messaging method
+func (server *Server) Deliver(messageType string, message proto.Message) {
+	switch message := message.(type) {
+	case *protos.ChannelAction:
+		server.handleChannel(message)
+	case *protos.Message:
+		server.handleSend(message)
+	default:
+		server.logger.Error("Invalid message delivered locally",
+			zap.String("messageType", messageType),
+			zap.String("workerId", server.id),
+		)
+	}
+}
+
+/// Subscribes to the channel's topic when the worker holds at least one of its connections,
+/// and unsubscribes once it holds none (pubsub channel fan-out)
+func (server *Server) syncChannelTopic(channel string) {
+	if server.channelSubscription == nil {
+		return
+	}
+
+	server.channelTopicsMutex.Lock()
+	defer server.channelTopicsMutex.Unlock()
+
+	channelConnections, _ := server.channels.Get(channel)
+	_, subscribed := server.channelTopics[channel]
+
+	var err error
+
+	if len(channelConnections) != 0 && !subscribed {
+		err = server.channelSubscription.Subscribe(channel)
+		if err == nil {
+			server.channelTopics[channel] = struct{}{}
+		}
+	} else if len(channelConnections) == 0 && subscribed {
+		err = server.channelSubscription.Unsubscribe(channel)
+		if err == nil {
+			delete(server.channelTopics, channel)
+		}
+	}
+
+	if err != nil {
+		server.logger.Error("Could not update channel topic subscription",
+			zap.Error(err),
+			zap.String("workerId", server.id),
+			zap.String("channel", channel),
+		)
+	}
+}
+
+/// Sends a message to another worker, using the messaging method
+func (server *Server) sendToWorker(targetWorkerId string, message *protos.Message) {
+	rawMessage, err := proto.Marshal(message)
+	if err != nil {
+		server.logger.Error("Could not marshal message for worker",
+			zap.Error(err),
+			zap.String("targetWorkerId", targetWorkerId),
+		)
+		return
+	}
+
+	if server.options.MessagingMethod != common.MessageMethodDirect {
+		err = server.dataStore.Publish([]string{targetWorkerId}, common.MessageMessageType, rawMessage)
+	} else {
+		err = server.sendToWorkerDirect(targetWorkerId, rawMessage)
+	}
+
+	if err != nil {
+		server.logger.Error("Could not send message to worker",
+			zap.Error(err),
+			zap.String("workerId", server.id),
+			zap.String("targetWorkerId", targetWorkerId),
+		)
+	}
+}
+
+func (server *Server) sendToWorkerDirect(targetWorkerId string, rawMessage []byte) error {
+	workers, err := server.dataStore.GetWorkers([]string{targetWorkerId})
+	if err != nil {
+		return err
+	}
+
+	if len(workers) == 0 || workers[0].DirectMessageUrl() == "" {
+		return errors.New("worker not found or has no direct messaging URL")
+	}
+
+	req, err := http.NewRequest("POST", workers[0].DirectMessageUrl()+common.PathReceiveMessage, bytes.NewReader(rawMessage))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", common.ProtobufContentType)
+	common.AuthorizeDirectRequest(server.options, req, common.PathReceiveMessage, rawMessage)
+
+	resp, err := server.directClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	// Read the body to reuse the connection
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return errors.New(resp.Status)
+	}
+
+	return nil
+}
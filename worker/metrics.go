@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"sync"
+)
+
+/// Started workers, summed in the metrics (metrics are shared by all workers of the process)
+var metricsServers = make(map[*Server]struct{})
+var metricsServersMutex sync.RWMutex
+
+func addMetricsServer(server *Server) {
+	metricsServersMutex.Lock()
+	defer metricsServersMutex.Unlock()
+
+	metricsServers[server] = struct{}{}
+}
+
+func removeMetricsServer(server *Server) {
+	metricsServersMutex.Lock()
+	defer metricsServersMutex.Unlock()
+
+	delete(metricsServers, server)
+}
+
+/// Sums the value across all started workers
+func sumMetricsServers(value func(server *Server) uint64) float64 {
+	metricsServersMutex.RLock()
+	defer metricsServersMutex.RUnlock()
+
+	sum := uint64(0)
+	for server := range metricsServers {
+		sum += value(server)
+	}
+
+	return float64(sum)
+}
+
+var (
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "dsock_worker_connections",
+		Help: "Active connections on the worker",
+	}, func() float64 {
+		return sumMetricsServers(func(server *Server) uint64 {
+			return uint64(server.connections.Count())
+		})
+	})
+	connectsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dsock_worker_connects_total",
+		Help: "Connections accepted (upgraded to WebSocket)",
+	})
+	disconnectsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dsock_worker_disconnects_total",
+		Help: "Connections closed, by WebSocket close code",
+	}, []string{"code"})
+	connectRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dsock_worker_connect_rejections_total",
+		Help: "Connection requests rejected (including authentication failures), by error code",
+	}, []string{"error_code"})
+	messagesSentTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dsock_worker_messages_sent_total",
+		Help: "Messages sent to connections, by message type (text or binary)",
+	}, []string{"type"})
+	messageBytesSentTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dsock_worker_message_bytes_sent_total",
+		Help: "Bytes of messages sent to connections, by message type (text or binary)",
+	}, []string{"type"})
+	_ = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "dsock_worker_send_queue_dropped_total",
+		Help: "Messages dropped because a connection's send queue was full",
+	}, func() float64 {
+		return sumMetricsServers(func(server *Server) uint64 {
+			return server.sendQueue.Dropped()
+		})
+	})
+	_ = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "dsock_worker_send_queue_disconnected_total",
+		Help: "Connections disconnected because their send queue was full",
+	}, func() float64 {
+		return sumMetricsServers(func(server *Server) uint64 {
+			return server.sendQueue.Disconnected()
+		})
+	})
+	ttlRefreshDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "dsock_worker_ttl_refresh_duration_seconds",
+		Help:    "Duration of refreshing the worker's and its connections' TTLs",
+		Buckets: prometheus.DefBuckets,
+	})
+)
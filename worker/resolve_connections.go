@@ -1,10 +1,10 @@
-package main
+package worker
 
 import "github.com/Cretezy/dSock/common"
 
-func resolveConnections(options common.ResolveOptions) ([]*SockConnection, bool) {
-	if options.Connection != "" {
-		connectionEntry, connectionExists := connections.Get(options.Connection)
+func (server *Server) resolveConnections(target common.ResolveOptions) ([]*SockConnection, bool) {
+	if target.Connection != "" {
+		connectionEntry, connectionExists := server.connections.Get(target.Connection)
 
 		if !connectionExists {
 			// Connection doesnt' exist
@@ -12,8 +12,8 @@ func resolveConnections(options common.ResolveOptions) ([]*SockConnection, bool)
 		}
 
 		return []*SockConnection{connectionEntry}, true
-	} else if options.Channel != "" {
-		channelEntry, exists := channels.Get(options.Channel)
+	} else if target.Channel != "" {
+		channelEntry, exists := server.channels.Get(target.Channel)
 
 		if !exists {
 			// User doesn't exist
@@ -23,16 +23,16 @@ func resolveConnections(options common.ResolveOptions) ([]*SockConnection, bool)
 		senders := make([]*SockConnection, 0)
 
 		for _, connectionId := range channelEntry {
-			connection, connectionExists := connections.Get(connectionId)
+			connection, connectionExists := server.connections.Get(connectionId)
 			// Target a specific session for a user if set
-			if connectionExists && (options.Session == "" || connection.Session == options.Session) {
+			if connectionExists && (target.Session == "" || connection.Session == target.Session) {
 				senders = append(senders, connection)
 			}
 		}
 
 		return senders, true
-	} else if options.User != "" {
-		usersEntry, exists := users.Get(options.User)
+	} else if target.User != "" {
+		usersEntry, exists := server.users.Get(target.User)
 
 		if !exists {
 			// User doesn't exist
@@ -42,9 +42,9 @@ func resolveConnections(options common.ResolveOptions) ([]*SockConnection, bool)
 		senders := make([]*SockConnection, 0)
 
 		for _, connectionId := range usersEntry {
-			connection, connectionExists := connections.Get(connectionId)
+			connection, connectionExists := server.connections.Get(connectionId)
 			// Target a specific session for a user if set
-			if connectionExists && (options.Session == "" || connection.Session == options.Session) {
+			if connectionExists && (target.Session == "" || connection.Session == target.Session) {
 				senders = append(senders, connection)
 			}
 		}
@@ -1,17 +1,19 @@
-package main
+package worker
 
 import (
 	"github.com/Cretezy/dSock/common"
 	"github.com/Cretezy/dSock/common/protos"
 	"github.com/gin-contrib/requestid"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/proto"
 	"io/ioutil"
 )
 
-func handleSend(message *protos.Message) {
-	logger.Info("Received send message",
+func (server *Server) handleSend(message *protos.Message) {
+	server.logger.Info("Received send message",
 		zap.String("target.connection", message.Target.Connection),
 		zap.String("target.user", message.Target.User),
 		zap.String("target.session", message.Target.Session),
@@ -19,8 +21,14 @@ func handleSend(message *protos.Message) {
 		zap.String("type", message.Type.String()),
 	)
 
+	ctx, span := common.Tracer.Start(common.ExtractTraceContext(message.TraceContext), "handleSend",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("dsock.worker_id", server.id)),
+	)
+	defer span.End()
+
 	// Resolve all local connections for message target
-	connections, ok := resolveConnections(common.ResolveOptions{
+	connections, ok := server.resolveConnections(common.ResolveOptions{
 		Connection: message.Target.Connection,
 		User:       message.Target.User,
 		Session:    message.Target.Session,
@@ -31,25 +39,31 @@ func handleSend(message *protos.Message) {
 		return
 	}
 
+	span.SetAttributes(attribute.Int("dsock.connections", len(connections)))
+
+	if span.SpanContext().IsValid() {
+		// Writing to the connections continues this span
+		message.TraceContext = common.InjectTraceContext(ctx)
+	}
+
 	// Send to all connections for target
 	for _, connection := range connections {
 		if connection.Sender == nil || connection.CloseChannel == nil {
 			continue
 		}
 
-		connection := connection
-
-		go func() {
-			if message.Type == protos.Message_DISCONNECT {
-				connection.CloseChannel <- struct{}{}
-			} else {
-				connection.Sender <- message
-			}
-		}()
+		if message.Type == protos.Message_DISCONNECT {
+			// Queued after the messages sent before it
+			connection.Disconnect(int(message.CloseCode), message.CloseReason)
+		} else {
+			// Never blocks, applying the send queue policy when full.
+			// Queued in the order received, then sent in order by the connection's send loop
+			connection.Send(message)
+		}
 	}
 }
 
-func sendMessageHandler(c *gin.Context) {
+func (server *Server) sendMessageHandler(c *gin.Context) {
 	requestId := requestid.Get(c)
 
 	if c.ContentType() != common.ProtobufContentType {
@@ -90,7 +104,7 @@ func sendMessageHandler(c *gin.Context) {
 		return
 	}
 
-	handleSend(&message)
+	server.handleSend(&message)
 
 	c.AbortWithStatusJSON(200, gin.H{
 		"success": true,
@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/common/protos"
+	"go.uber.org/zap"
+	"sync/atomic"
+)
+
+/// Queued by Disconnect to close the connection once the messages queued before it are sent
+var disconnectMessage = &protos.Message{Type: protos.Message_DISCONNECT}
+
+/// Counters for the connections' send queues, across all connections of the worker
+type sendQueueStats struct {
+	/// Messages dropped because a send queue was full
+	dropped uint64
+	/// Connections disconnected because their send queue was full
+	disconnected uint64
+	connections  *connectionsState
+}
+
+func (stats *sendQueueStats) Dropped() uint64 {
+	return atomic.LoadUint64(&stats.dropped)
+}
+
+func (stats *sendQueueStats) Disconnected() uint64 {
+	return atomic.LoadUint64(&stats.disconnected)
+}
+
+/// Returns the total and largest number of messages waiting to be sent, across all connections
+func (stats *sendQueueStats) Depth() (total int, max int) {
+	for _, connection := range stats.connections.List() {
+		depth := len(connection.Sender)
+
+		total += depth
+		if depth > max {
+			max = depth
+		}
+	}
+
+	return total, max
+}
+
+/// Queues a message to be sent to the connection, without blocking.
+/// When the queue is full, applies the `send_queue_policy`
+func (connection *SockConnection) Send(message *protos.Message) {
+	select {
+	case connection.Sender <- message:
+		return
+	default:
+	}
+
+	switch connection.server.options.SendQueuePolicy {
+	case common.SendQueuePolicyDropOldest:
+		// Make room by dropping the oldest message. If the queue filled up again, drop this message instead
+		select {
+		case oldest := <-connection.Sender:
+			if oldest == disconnectMessage {
+				// Everything queued before the disconnect was sent, close now instead
+				connection.closeNow()
+			}
+		default:
+		}
+
+		select {
+		case connection.Sender <- message:
+		default:
+		}
+
+		connection.dropped()
+	case common.SendQueuePolicyDisconnect:
+		if !connection.CloseWith(common.CloseCodeSendQueueFull, "Send queue full") {
+			// Already disconnecting
+			return
+		}
+
+		atomic.AddUint64(&connection.server.sendQueue.disconnected, 1)
+
+		connection.server.logger.Warn("Send queue full, disconnecting connection",
+			zap.String("id", connection.Id),
+			zap.String("user", connection.User),
+			zap.Int("queueSize", connection.server.options.SendQueueSize),
+		)
+	default:
+		connection.dropped()
+	}
+}
+
+func (connection *SockConnection) dropped() {
+	dropped := atomic.AddUint64(&connection.droppedMessages, 1)
+	atomic.AddUint64(&connection.server.sendQueue.dropped, 1)
+
+	// Only log the first drop (and then every 1000) to not flood logs for a slow connection
+	if dropped%1000 == 1 {
+		connection.server.logger.Warn("Send queue full, dropped message",
+			zap.String("id", connection.Id),
+			zap.String("user", connection.User),
+			zap.String("policy", connection.server.options.SendQueuePolicy),
+			zap.Uint64("dropped", dropped),
+		)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package worker
 
 import (
 	"github.com/Cretezy/dSock/common"
@@ -32,6 +32,25 @@ func (connections *connectionsState) Get(id string) (*SockConnection, bool) {
 	return connectionEntry, connectionExists
 }
 
+func (connections *connectionsState) List() []*SockConnection {
+	connections.mutex.RLock()
+	defer connections.mutex.RUnlock()
+
+	list := make([]*SockConnection, 0, len(connections.state))
+	for _, connection := range connections.state {
+		list = append(list, connection)
+	}
+
+	return list
+}
+
+func (connections *connectionsState) Count() int {
+	connections.mutex.RLock()
+	defer connections.mutex.RUnlock()
+
+	return len(connections.state)
+}
+
 type usersState struct {
 	state map[string][]string
 	mutex sync.RWMutex
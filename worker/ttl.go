@@ -1,39 +1,48 @@
-package main
+package worker
 
 import (
-	"github.com/go-redis/redis/v7"
+	"github.com/Cretezy/dSock/common/store"
 	"go.uber.org/zap"
 	"time"
 )
 
-func RefreshTtls() {
+/// Refreshes the TTLs of the worker and its connections every `ttl_duration`, until shut down
+func (server *Server) refreshTtls() {
 	nextTime := time.Now()
 
 	for {
-		nextTime = nextTime.Add(options.TtlDuration)
-		time.Sleep(time.Until(nextTime))
+		nextTime = nextTime.Add(server.options.TtlDuration)
+		if !server.wait(time.Until(nextTime)) {
+			return
+		}
+
+		refreshStart := time.Now()
 
-		_, err := redisClient.Pipelined(func(pipeliner redis.Pipeliner) error {
-			RefreshWorker(pipeliner)
+		err := server.dataStore.SetWorker(server.workerInfo(), server.options.TtlDuration*2)
 
-			for _, connection := range connections.state {
-				connection.Refresh(pipeliner)
+		if err == nil {
+			activeConnections := server.connections.List()
+			storeConnections := make([]*store.Connection, len(activeConnections))
+			for index, connection := range activeConnections {
+				storeConnections[index] = connection.Info()
 			}
 
-			return nil
-		})
+			err = server.dataStore.SetConnections(storeConnections, server.options.TtlDuration*2)
+		}
 
 		if err != nil {
-			logger.Error("Could not refresh TTLs",
+			server.logger.Error("Could not refresh TTLs",
 				zap.Error(err),
-				zap.String("workerId", workerId),
+				zap.String("workerId", server.id),
 			)
 
 			continue
 		}
 
-		logger.Info("Refreshed TTLs",
-			zap.String("workerId", workerId),
+		ttlRefreshDuration.Observe(time.Since(refreshStart).Seconds())
+
+		server.logger.Info("Refreshed TTLs",
+			zap.String("workerId", server.id),
 		)
 	}
 }
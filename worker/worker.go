@@ -0,0 +1,363 @@
+package worker
+
+import (
+	"github.com/Cretezy/dSock/common"
+	"github.com/Cretezy/dSock/common/store"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+	EnableCompression: true,
+}
+
+/// Called on connection events. Hooks are called synchronously and should not block
+/// (OnMessage blocks receiving the connection's next message)
+type Hooks struct {
+	/// Called after a connection is opened
+	OnConnect func(connection *store.Connection)
+	/// Called after a connection is closed, with the WebSocket close code
+	OnDisconnect func(connection *store.Connection, closeCode int)
+	/// Called after a connection subscribes to a channel
+	OnSubscribe func(connection *store.Connection, channel string)
+	/// Called after a connection unsubscribes from a channel
+	OnUnsubscribe func(connection *store.Connection, channel string)
+	/// Called when a connection sends a message (otherwise ignored), with the WebSocket message type
+	OnMessage func(connection *store.Connection, messageType int, data []byte)
+}
+
+type ServerOptions struct {
+	/// Options, usually from common.GetOptions (with worker options)
+	Options *common.DSockOptions
+	/// Defaults to a no-op logger
+	Logger *zap.Logger
+	/// Store shared with the API. If nil, a store is created from the options (and closed on shutdown)
+	Store store.Store
+	Hooks Hooks
+	/// Returns the memory used by the worker (in bytes), checked against max_memory_mb.
+	/// Defaults to the memory obtained from the OS and not released back to it
+	MemoryUsage func() uint64
+}
+
+/// dSock worker. Multiple workers can run in the same process (metrics are shared by all workers)
+type Server struct {
+	id        string
+	options   *common.DSockOptions
+	logger    *zap.Logger
+	dataStore store.Store
+	/// If the store was created by the server (closed on shutdown)
+	ownsStore bool
+	hooks     Hooks
+	/// HTTP client for direct messages to other workers
+	directClient *http.Client
+
+	users       usersState
+	channels    channelsState
+	connections connectionsState
+	sendQueue   *sendQueueStats
+	load        *loadState
+	drain       drainState
+	health      healthState
+
+	/// Cleans up the store messaging subscription on shutdown
+	closeMessaging func()
+	/// Subscription to the topics of channels with local connections (pubsub channel fan-out)
+	channelSubscription store.ChannelSubscription
+	/// Channels for which the worker is subscribed to the topic
+	channelTopics      map[string]struct{}
+	channelTopicsMutex sync.Mutex
+
+	/// Closed on shutdown, stopping the background work
+	quit         chan struct{}
+	shutdownOnce sync.Once
+}
+
+func NewServer(serverOptions ServerOptions) *Server {
+	server := &Server{
+		id:        uuid.New().String(),
+		options:   serverOptions.Options,
+		logger:    serverOptions.Logger,
+		dataStore: serverOptions.Store,
+		hooks:     serverOptions.Hooks,
+
+		directClient: common.NewDirectHttpClient(serverOptions.Options),
+		users: usersState{
+			state: make(map[string][]string),
+		},
+		channels: channelsState{
+			state: make(map[string][]string),
+		},
+		connections: connectionsState{
+			state: make(map[string]*SockConnection),
+		},
+		drain: drainState{
+			done:   make(chan struct{}),
+			random: rand.New(rand.NewSource(time.Now().UnixNano())),
+		},
+		health: healthState{
+			degraded: make(map[string]string),
+		},
+		closeMessaging: func() {},
+		channelTopics:  make(map[string]struct{}),
+		quit:           make(chan struct{}),
+	}
+
+	server.sendQueue = &sendQueueStats{
+		connections: &server.connections,
+	}
+	server.load = &loadState{
+		memoryUsage: serverOptions.MemoryUsage,
+		options:     server.options,
+		connections: &server.connections,
+		sendQueue:   server.sendQueue,
+	}
+	server.health.drain = &server.drain
+
+	if server.logger == nil {
+		server.logger = zap.NewNop()
+	}
+
+	if server.load.memoryUsage == nil {
+		server.load.memoryUsage = processMemory
+	}
+
+	if server.dataStore == nil {
+		server.dataStore = store.New(server.options, server.logger)
+		server.ownsStore = true
+	}
+
+	return server
+}
+
+func (server *Server) Id() string {
+	return server.id
+}
+
+/// Registers the worker routes (health, connect, drain, and the direct messaging endpoints when enabled,
+/// unless served on direct_listen_address)
+func (server *Server) RegisterRoutes(router gin.IRoutes) {
+	router.GET(common.PathHealth, server.healthHandler)
+	router.GET(common.PathConnect, server.connectHandler)
+
+	// Without a token, anyone could drain the worker (SIGTERM still drains it)
+	if server.options.Token != "" {
+		router.POST(common.PathDrain, common.TokenMiddleware(server.options.Token), server.drainHandler)
+	}
+
+	if server.options.DirectListenAddress == "" {
+		server.RegisterDirectRoutes(router)
+	}
+}
+
+/// Registers the direct messaging endpoints (when enabled), authenticated with the token or an HMAC signature
+func (server *Server) RegisterDirectRoutes(router gin.IRoutes) {
+	if server.options.MessagingMethod == common.MessageMethodDirect {
+		router.POST(common.PathReceiveMessage, common.TracingMiddleware, server.directAuthMiddleware(), server.sendMessageHandler)
+		router.POST(common.PathReceiveChannelMessage, common.TracingMiddleware, server.directAuthMiddleware(), server.channelMessageHandler)
+	}
+}
+
+/// Returns the handler serving the worker (including ping & metrics)
+func (server *Server) Handler() http.Handler {
+	router := common.NewGinEngine(server.logger, server.options)
+	router.Use(common.RequestIdMiddleware)
+
+	router.Any(common.PathPing, common.PingHandler)
+	common.RegisterMetricsRoute(router, server.options)
+	server.RegisterRoutes(router)
+
+	return router
+}
+
+/// Returns the handler serving the direct messaging endpoints (including ping), to serve on direct_listen_address
+func (server *Server) DirectHandler() http.Handler {
+	router := common.NewGinEngine(server.logger, server.options)
+	router.Use(common.RequestIdMiddleware)
+
+	router.Any(common.PathPing, common.PingHandler)
+	server.RegisterDirectRoutes(router)
+
+	return router
+}
+
+/// Serves the direct messaging endpoints on direct_listen_address (when set). Returns the HTTP server to shut down, or nil
+func (server *Server) ServeDirect() *http.Server {
+	if server.options.DirectListenAddress == "" || server.options.MessagingMethod != common.MessageMethodDirect {
+		return nil
+	}
+
+	srv := &http.Server{
+		Addr:      server.options.DirectListenAddress,
+		Handler:   server.DirectHandler(),
+		TLSConfig: server.options.DirectTls,
+	}
+
+	go func() {
+		if err := common.ListenAndServe(srv); err != nil && err != http.ErrServerClosed {
+			server.logger.Error("Failed listening for direct messages",
+				zap.Error(err),
+				zap.String("workerId", server.id),
+			)
+			server.options.QuitChannel <- struct{}{}
+		}
+	}()
+
+	server.logger.Info("Listening for direct messages",
+		zap.String("address", server.options.DirectListenAddress),
+		zap.Bool("tls", srv.TLSConfig != nil),
+		zap.String("workerId", server.id),
+	)
+
+	return srv
+}
+
+/// Registers the worker, starts refreshing TTLs and starts receiving messages from the store.
+/// Must be called before serving connections
+func (server *Server) Start() {
+	addMetricsServer(server)
+
+	server.refreshWorker()
+
+	go server.refreshTtls()
+	go server.monitorHealth()
+	go server.monitorLoad()
+
+	if server.options.MessagingMethod == common.MessageMethodRedis || server.options.MessagingMethod == common.MessageMethodRedisStreams {
+		server.logger.Info("Starting store messaging method",
+			zap.String("workerId", server.id),
+			zap.String("messagingMethod", server.options.MessagingMethod),
+		)
+
+		// Receives messages & channel actions from the store
+		subscription, err := server.dataStore.Subscribe(server.id, server.handleMessage, server.handleMessagingStatus)
+		if err != nil {
+			server.logger.Error("Could not subscribe to messages",
+				zap.Error(err),
+				zap.String("workerId", server.id),
+			)
+		} else {
+			server.closeMessaging = func() {
+				_ = subscription.Close()
+			}
+		}
+	} else {
+		server.logger.Info("Starting direct messaging method",
+			zap.String("workerId", server.id),
+			zap.String("directHostname", server.options.DirectHostname),
+			zap.Int("directPort", server.options.DirectPort),
+		)
+	}
+
+	if server.options.ChannelFanout == common.ChannelFanoutPubSub {
+		// Receives channel messages from the topics of channels with local connections
+		subscription, err := server.dataStore.SubscribeChannels(server.handleMessage, server.handleMessagingStatus)
+		if err != nil {
+			server.logger.Error("Could not subscribe to channel topics",
+				zap.Error(err),
+				zap.String("workerId", server.id),
+			)
+		} else {
+			server.channelSubscription = subscription
+		}
+	}
+}
+
+/// Stops the background work and receiving messages, unregisters the worker and disconnects all connections.
+/// Closes the store if it was created by the server
+func (server *Server) Shutdown() {
+	server.shutdownOnce.Do(func() {
+		close(server.quit)
+
+		server.closeMessaging()
+		if server.channelSubscription != nil {
+			_ = server.channelSubscription.Close()
+		}
+		_ = server.dataStore.DeleteWorker(server.id)
+
+		// Disconnect all connections
+		server.disconnectAll()
+
+		// Allow time to disconnect & clear from store
+		time.Sleep(time.Second)
+
+		removeMetricsServer(server)
+
+		if server.ownsStore {
+			_ = server.dataStore.Close()
+		}
+	})
+}
+
+/// Waits for the duration. Returns false if the worker was shut down in the meantime
+func (server *Server) wait(duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-server.quit:
+		return false
+	}
+}
+
+/// Returns the worker's registration
+func (server *Server) workerInfo() *store.Worker {
+	worker := &store.Worker{
+		Id:       server.id,
+		LastPing: time.Now(),
+		Status:   server.health.Status(),
+		Load:     server.load.Current(),
+
+		PublicUrl: server.options.PublicUrl,
+		Region:    server.options.Region,
+	}
+	if server.options.MessagingMethod == common.MessageMethodDirect {
+		worker.Ip = server.options.DirectHostname + ":" + strconv.Itoa(server.options.DirectPort)
+
+		// Direct messaging endpoints are served with the direct listener's TLS, or the main port's TLS
+		scheme := "http"
+		if server.options.DirectTls != nil ||
+			(server.options.DirectListenAddress == "" && server.options.Tls.CertFile != "") {
+			scheme = "https"
+		}
+		worker.DirectUrl = scheme + "://" + worker.Ip
+	}
+
+	return worker
+}
+
+func (server *Server) refreshWorker() {
+	err := server.dataStore.SetWorker(server.workerInfo(), server.options.TtlDuration*2)
+	if err != nil {
+		server.logger.Error("Could not refresh worker",
+			zap.Error(err),
+			zap.String("workerId", server.id),
+		)
+	}
+}
+
+/// Disconnects all connections held by this worker
+func (server *Server) disconnectAll() {
+	for _, connection := range server.connections.List() {
+		connection := connection
+
+		go func() {
+			if connection.CloseChannel != nil {
+				connection.CloseChannel <- struct{}{}
+			}
+		}()
+	}
+}